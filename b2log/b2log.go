@@ -3,6 +3,7 @@
 modification history
 --------------------
 2014/11/4, by Zhang Miao, create
+2026/10/18, by agent, add header of version 2, with checksum and record type
 */
 /*
 DESCRIPTION
@@ -10,25 +11,47 @@ DESCRIPTION
 package b2log
 
 import (
-    "unsafe"
+    "encoding/binary"
+    "hash/crc32"
 )
 
 // magic number
-// This can only work in little-endian machine (e.g., x86)
+// Header is encoded in little-endian explicitly, so MAGIC_NUMBER_STR is
+// MAGIC_NUMBER in little-endian.
 // Remember to make MAGIC_NUMBER and MAGIC_NUMBER_STR consistent
 const (
 	MAGIC_NUMBER	= 0xB0AEBEA7
-	HEADER_VERSION 	= 1
+	HEADER_VERSION 	= HEADER_VERSION_V1     // default version of header
 )
 
 var   MAGIC_NUMBER_STR  = []byte{0xA7, 0xBE, 0xAE, 0xB0}
 
+// version of header
+// - version 1: MagicNumber, Version, UnCompressLen, CompressLen, TimeStamp
+// - version 2: version 1, plus Checksum, RecordType
+const (
+    HEADER_VERSION_V1   = 1
+    HEADER_VERSION_V2   = 2
+)
+
 // size of Header
-var HEADER_SIZE = int(unsafe.Sizeof(demoHeader))
-var demoHeader Header       // this var is only for getting size of Header
+const (
+    HEADER_SIZE_V1  = 24
+    HEADER_SIZE_V2  = 32
+    HEADER_SIZE     = HEADER_SIZE_V1    // size of header in default version
+)
 
 const MAX_RECORD_LEN    = 100 * 1024    // max length of single b2log record
 
+// compress type of record
+// It is kept in the high 16 bits of Header.Version, and the low 16 bits
+// is the version of header. For compatibility, compressed record is
+// bypassed by old readers, since Header.CompressLen is not zero.
+const (
+    COMPRESS_NONE   = 0     // not compressed
+    COMPRESS_ZLIB   = 1     // compressed with zlib
+)
+
 // header for b2log record
 type Header struct {
     MagicNumber   uint32    // magic number
@@ -36,8 +59,86 @@ type Header struct {
     UnCompressLen uint32    // length of upcompress log
     CompressLen   uint32    // length of compress log
     TimeStamp     uint64    // timestamp the log generated
+    Checksum      uint32    // CRC32C of data in record, only for version 2
+    RecordType    uint32    // type of record, only for version 2
+}
+
+// get version of header
+func (h *Header) HeaderVersion() uint32 {
+    return h.Version & 0xffff
+}
+
+// get compress type of record
+func (h *Header) CompressType() uint32 {
+    return h.Version >> 16
+}
+
+// make value of Header.Version, from version of header and compress type
+func versionMake(version uint32, compressType uint32) uint32 {
+    return compressType << 16 | version
 }
 
 // binary format of b2log record
 type Record []byte
 
+
+// table for CRC32C
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// get checksum of data in record (compressed data for compressed record)
+func recordChecksum(data []byte) uint32 {
+    return crc32.Checksum(data, crc32cTable)
+}
+
+// get size of header for given version of header
+// 0 is returned for unknown version
+func headerSizeGet(version uint32) int {
+    switch version {
+    case HEADER_VERSION_V1:
+        return HEADER_SIZE_V1
+    case HEADER_VERSION_V2:
+        return HEADER_SIZE_V2
+    default:
+        return 0
+    }
+}
+
+// get version of header from buff
+// buff should be at least HEADER_SIZE_V1 bytes
+func headerVersionGet(buff []byte) uint32 {
+    return binary.LittleEndian.Uint32(buff[4:8]) & 0xffff
+}
+
+// encode header to buff, in little-endian
+// buff should be at least headerSizeGet(header.HeaderVersion()) bytes
+func headerEncode(buff []byte, header *Header) {
+    binary.LittleEndian.PutUint32(buff[0:4], header.MagicNumber)
+    binary.LittleEndian.PutUint32(buff[4:8], header.Version)
+    binary.LittleEndian.PutUint32(buff[8:12], header.UnCompressLen)
+    binary.LittleEndian.PutUint32(buff[12:16], header.CompressLen)
+    binary.LittleEndian.PutUint64(buff[16:24], header.TimeStamp)
+
+    if header.HeaderVersion() == HEADER_VERSION_V2 {
+        binary.LittleEndian.PutUint32(buff[24:28], header.Checksum)
+        binary.LittleEndian.PutUint32(buff[28:32], header.RecordType)
+    }
+}
+
+// decode header from buff, in little-endian
+// buff should be at least headerSizeGet(headerVersionGet(buff)) bytes
+func headerDecode(buff []byte) Header {
+    var header Header
+
+    header.MagicNumber = binary.LittleEndian.Uint32(buff[0:4])
+    header.Version = binary.LittleEndian.Uint32(buff[4:8])
+    header.UnCompressLen = binary.LittleEndian.Uint32(buff[8:12])
+    header.CompressLen = binary.LittleEndian.Uint32(buff[12:16])
+    header.TimeStamp = binary.LittleEndian.Uint64(buff[16:24])
+
+    if header.HeaderVersion() == HEADER_VERSION_V2 {
+        header.Checksum = binary.LittleEndian.Uint32(buff[24:28])
+        header.RecordType = binary.LittleEndian.Uint32(buff[28:32])
+    }
+
+    return header
+}
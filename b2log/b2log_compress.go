@@ -0,0 +1,104 @@
+/* b2log_compress.go - compress and decompress b2log record  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Only zlib is supported now.
+*/
+package b2log
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+import (
+	"www.baidu.com/golang-lib/compress"
+)
+
+var (
+	ErrCompressType = errors.New("b2log: compress type is not support")
+	ErrDecompress   = errors.New("b2log: fail to decompress record")
+)
+
+// check whether compress type is supported
+func compressTypeCheck(compressType uint32) error {
+	switch compressType {
+	case COMPRESS_NONE, COMPRESS_ZLIB:
+		return nil
+	default:
+		return ErrCompressType
+	}
+}
+
+// check whether compressed record with given compress type could be decompressed
+// COMPRESS_NONE with non-zero CompressLen is from old writers, and can not be
+// decompressed.
+func decompressSupported(compressType uint32) bool {
+	return compressType == COMPRESS_ZLIB
+}
+
+// compress payload with given compress type
+func recordCompress(compressType uint32, payload []byte) ([]byte, error) {
+	switch compressType {
+	case COMPRESS_ZLIB:
+		return compress.ZlibCompress(payload)
+	default:
+		return nil, ErrCompressType
+	}
+}
+
+/*
+recordDecompress - decompress data of compressed record
+
+Params:
+    - header: header of the record
+    - data: compressed data, with length of header.CompressLen
+
+Returns:
+    (payload, error)
+    - error: ErrCompressed, if compress type is not supported
+             ErrDecompress, if data is broken, or length is not correct, or
+             UnCompressLen is larger than MAX_RECORD_LEN
+*/
+func recordDecompress(header Header, data []byte) ([]byte, error) {
+	var payload []byte
+	var err error
+
+	if !decompressSupported(header.CompressType()) {
+		return nil, ErrCompressed
+	}
+
+	// not to inflate record which could not be written
+	if header.UnCompressLen > MAX_RECORD_LEN {
+		return nil, ErrDecompress
+	}
+
+	switch header.CompressType() {
+	case COMPRESS_ZLIB:
+		payload, err = zlibDecompress(data, int64(header.UnCompressLen))
+	}
+
+	if err != nil || len(payload) != int(header.UnCompressLen) {
+		return nil, ErrDecompress
+	}
+
+	return payload, nil
+}
+
+// decompress zlib data, at most maxLen+1 bytes are inflated, for checking length
+func zlibDecompress(data []byte, maxLen int64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(io.LimitReader(r, maxLen+1))
+}
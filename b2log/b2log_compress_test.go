@@ -0,0 +1,70 @@
+/* b2log_compress_test.go - test for b2log_compress.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package b2log
+
+import (
+	"bytes"
+	"testing"
+)
+
+import (
+	"www.baidu.com/golang-lib/compress"
+)
+
+// test of recordDecompress
+func Test_RecordDecompress(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 1024)
+	data, err := compress.ZlibCompress(payload)
+	if err != nil {
+		t.Fatalf("ZlibCompress(): %s", err.Error())
+	}
+
+	var header Header
+	header.Version = versionMake(HEADER_VERSION, COMPRESS_ZLIB)
+	header.UnCompressLen = uint32(len(payload))
+	header.CompressLen = uint32(len(data))
+
+	record, err := recordDecompress(header, data)
+	if err != nil || !bytes.Equal(record, payload) {
+		t.Errorf("recordDecompress() should return payload, now it's %d bytes, %v", len(record), err)
+	}
+
+	// not supported compress type
+	header.Version = versionMake(HEADER_VERSION, COMPRESS_NONE)
+	if _, err := recordDecompress(header, data); err != ErrCompressed {
+		t.Errorf("recordDecompress() should return ErrCompressed, now it's %v", err)
+	}
+	header.Version = versionMake(HEADER_VERSION, COMPRESS_ZLIB)
+
+	// wrong length
+	for _, unCompressLen := range []uint32{1023, 1025, MAX_RECORD_LEN + 1} {
+		header.UnCompressLen = unCompressLen
+		if _, err := recordDecompress(header, data); err != ErrDecompress {
+			t.Errorf("recordDecompress() with UnCompressLen %d should return ErrDecompress, now it's %v",
+				unCompressLen, err)
+		}
+	}
+
+	// data inflated larger than UnCompressLen is not read all
+	bomb, err := compress.ZlibCompress(make([]byte, 16*MAX_RECORD_LEN))
+	if err != nil {
+		t.Fatalf("ZlibCompress(): %s", err.Error())
+	}
+	inflated, err := zlibDecompress(bomb, 10)
+	if err != nil || len(inflated) != 11 {
+		t.Errorf("zlibDecompress() should inflate 11 bytes, now it's %d, %v", len(inflated), err)
+	}
+
+	// broken data
+	header.UnCompressLen = uint32(len(payload))
+	if _, err := recordDecompress(header, data[:len(data)/2]); err != ErrDecompress {
+		t.Errorf("recordDecompress() should return ErrDecompress, now it's %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+/* b2log_index.go - sidecar index for b2log file  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Index of b2log file is kept in a sidecar file, named as path + INDEX_SUFFIX.
+
+Index file is a list of entries, each of INDEX_ENTRY_SIZE bytes:
+    |TimeStamp(8)|Offset(8)|
+Both fields are in little-endian. Offset is the offset of record in b2log file,
+and TimeStamp is the timestamp of that record.
+
+Entries are added by Writer, every N records or every N seconds.
+
+Usage:
+    file, _ := os.Create(path)
+    indexFile, _ := os.Create(b2log.IndexPathGen(path))
+
+    w := b2log.NewWriter(file)
+    w.SetIndex(indexFile, 1000, 10 * time.Second)
+*/
+package b2log
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// suffix of index file
+const INDEX_SUFFIX = ".idx"
+
+// size of index entry
+const INDEX_ENTRY_SIZE = 16
+
+// entry of index
+type IndexEntry struct {
+	TimeStamp uint64 // timestamp of the record
+	Offset    int64  // offset of the record in b2log file
+}
+
+// index builder, used by Writer
+type indexBuilder struct {
+	wr             io.Writer // writer for index file
+	recordInterval int       // add entry every recordInterval records
+	timeInterval   uint64    // add entry every timeInterval milliseconds
+
+	records   int    // records since the last entry
+	lastTime  uint64 // timestamp of the last entry
+	hasEntry  bool   // whether entry has been added
+	entryBuff [INDEX_ENTRY_SIZE]byte
+}
+
+// IndexPathGen generates path of index file for given b2log file
+func IndexPathGen(path string) string {
+	return path + INDEX_SUFFIX
+}
+
+// generate b2log timestamp from time.Time
+// Zero time and time before epoch are converted to 0.
+func timestampFromTime(t time.Time) uint64 {
+	if t.IsZero() || t.UnixNano() < 0 {
+		return 0
+	}
+	return uint64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// create index builder
+func newIndexBuilder(wr io.Writer, recordInterval int, timeInterval time.Duration) *indexBuilder {
+	b := new(indexBuilder)
+	b.wr = wr
+	b.recordInterval = recordInterval
+	b.timeInterval = uint64(timeInterval / time.Millisecond)
+	return b
+}
+
+/*
+add - notify a record has been written, and add entry to index if needed
+
+Params:
+    - timestamp: timestamp of the record
+    - offset: offset of the record in b2log file
+*/
+func (b *indexBuilder) add(timestamp uint64, offset int64) error {
+	needEntry := !b.hasEntry
+	if b.recordInterval > 0 && b.records >= b.recordInterval {
+		needEntry = true
+	}
+	if b.timeInterval > 0 && timestamp >= b.lastTime+b.timeInterval {
+		needEntry = true
+	}
+
+	if !needEntry {
+		b.records++
+		return nil
+	}
+
+	// write entry to index file
+	binary.LittleEndian.PutUint64(b.entryBuff[0:8], timestamp)
+	binary.LittleEndian.PutUint64(b.entryBuff[8:16], uint64(offset))
+	if _, err := b.wr.Write(b.entryBuff[:]); err != nil {
+		return err
+	}
+
+	b.hasEntry = true
+	b.lastTime = timestamp
+	b.records = 1
+	return nil
+}
+
+/*
+IndexLoad - load index from index file
+
+Params:
+    - path: path of index file
+
+Returns:
+    (entries, error)
+    Incomplete entry at the end of file is ignored.
+*/
+func IndexLoad(path string) ([]IndexEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]IndexEntry, 0, len(data)/INDEX_ENTRY_SIZE)
+	for len(data) >= INDEX_ENTRY_SIZE {
+		var entry IndexEntry
+		entry.TimeStamp = binary.LittleEndian.Uint64(data[0:8])
+		entry.Offset = int64(binary.LittleEndian.Uint64(data[8:16]))
+		entries = append(entries, entry)
+
+		data = data[INDEX_ENTRY_SIZE:]
+	}
+
+	return entries, nil
+}
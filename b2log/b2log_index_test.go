@@ -0,0 +1,101 @@
+/* b2log_index_test.go - test for b2log_index.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package b2log
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// test of index built by Writer
+func Test_Index(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_index")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	var buff bytes.Buffer
+	path := filepath.Join(dir, "index")
+	index, err := os.Create(IndexPathGen(path))
+	if err != nil {
+		t.Fatalf("os.Create():%s", err.Error())
+	}
+
+	// entry every 10 records, or every 1 second
+	w := NewWriter(&buff)
+	w.SetOffset(100)
+	w.SetIndex(index, 10, time.Second)
+	offsets := make([]int64, 0)
+	for i := 0; i < 30; i++ {
+		offsets = append(offsets, w.Offset())
+		timestamp := uint64(i)
+		if i >= 25 {
+			timestamp = uint64(i * 1000)
+		}
+		w.WriteWithTime([]byte("this is a test"), timestamp)
+	}
+	index.Close()
+
+	entries, err := IndexLoad(IndexPathGen(path))
+	if err != nil {
+		t.Fatalf("IndexLoad():%s", err.Error())
+	}
+	expects := []int{0, 10, 20, 25, 26, 27, 28, 29}
+	if len(entries) != len(expects) {
+		t.Fatalf("len(entries) should be %d, now it's %d", len(expects), len(entries))
+	}
+	for i, expect := range expects {
+		if entries[i].Offset != offsets[expect] {
+			t.Errorf("entries[%d].Offset should be %d, now it's %d",
+				i, offsets[expect], entries[i].Offset)
+		}
+	}
+	if entries[0].Offset != 100 {
+		t.Errorf("entries[0].Offset should be 100, now it's %d", entries[0].Offset)
+	}
+}
+
+// writer for test, fails for each write
+type failWriter struct{}
+
+func (w failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write fail")
+}
+
+// test of Writer, with index writer which fails
+func Test_Index_WriteFail(t *testing.T) {
+	var buff bytes.Buffer
+	w := NewWriter(&buff)
+	w.SetIndex(failWriter{}, 10, time.Second)
+
+	payload := []byte("this is a test")
+	n, err := w.Write(payload)
+	if _, ok := err.(*IndexError); !ok {
+		t.Errorf("w.Write() should return *IndexError, now it's %v", err)
+	}
+	if n != len(payload) {
+		t.Errorf("n should be %d, now it's %d", len(payload), n)
+	}
+
+	// record is written
+	if w.Offset() != int64(buff.Len()) || buff.Len() == 0 {
+		t.Errorf("w.Offset() should be %d, now it's %d", buff.Len(), w.Offset())
+	}
+	r := NewReader(&buff)
+	if record, err := r.Read(); err != nil || !bytes.Equal(record, payload) {
+		t.Errorf("r.Read() should return the record, now it's %s, %v", record, err)
+	}
+}
@@ -0,0 +1,256 @@
+/* b2log_range.go - read records of given time range from b2log file  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+OpenRange() opens a b2log file, and seeks to the first record of given time
+range directly:
+- If the sidecar index exists, the position is got from the index.
+- Otherwise, the position is got by binary search on resynchronized headers.
+
+Timestamps of records in the file are assumed to be non-decreasing.
+
+Usage:
+    rr, err := b2log.OpenRange(path, from, to)
+    if err != nil {
+        ...
+    }
+    defer rr.Close()
+
+    for {
+        record, err := rr.Read()
+        if err == io.EOF {
+            break
+        }
+        ...
+    }
+*/
+package b2log
+
+import (
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// when the range for binary search is less than this, scan it directly
+const RANGE_SCAN_SIZE = 64 * 1024
+
+// RangeReader reads records in time range [from, to) from b2log file
+type RangeReader struct {
+	file   *os.File
+	reader *Reader
+	from   uint64 // timestamp, in millisecond
+	to     uint64 // timestamp, in millisecond
+	done   bool   // whether the end of range is reached
+}
+
+/*
+OpenRange - open b2log file for reading records in time range [from, to)
+
+Params:
+    - path: path of b2log file
+    - from: start time of range, included
+    - to: end time of range, excluded
+
+Returns:
+    (reader, error)
+*/
+func OpenRange(path string, from, to time.Time) (*RangeReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	rr := new(RangeReader)
+	rr.file = file
+	rr.from = timestampFromTime(from)
+	rr.to = timestampFromTime(to)
+
+	// get start position by index, or by binary search
+	offset, err := rangeIndexSearch(IndexPathGen(path), rr.from, fileInfo.Size())
+	if err != nil {
+		offset, err = rangeBinarySearch(file, rr.from, fileInfo.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	rr.reader = NewReader(file)
+	rr.reader.SetOffset(offset)
+
+	return rr, nil
+}
+
+/*
+Read - read the next record in time range
+
+Returns:
+    (record, error)
+    - error: io.EOF, if the end of range or end of file is reached
+             other errors, same as Reader.Read()
+*/
+func (rr *RangeReader) Read() (Record, error) {
+	if rr.done {
+		return nil, io.EOF
+	}
+
+	for {
+		record, err := rr.reader.Read()
+		if err != nil && !recordErrCheck(err) {
+			return nil, err
+		}
+
+		// check timestamp of the record
+		timestamp := rr.reader.Header().TimeStamp
+		if timestamp < rr.from {
+			continue
+		}
+		if timestamp >= rr.to {
+			rr.done = true
+			return nil, io.EOF
+		}
+
+		return record, err
+	}
+}
+
+// Header returns header of the record last read
+func (rr *RangeReader) Header() Header {
+	return rr.reader.Header()
+}
+
+// RecordOffset returns offset in the file of the record last read
+func (rr *RangeReader) RecordOffset() int64 {
+	return rr.reader.RecordOffset()
+}
+
+// SetSkipHandler sets handler for bypassed data
+func (rr *RangeReader) SetSkipHandler(handler SkipHandler) {
+	rr.reader.SetSkipHandler(handler)
+}
+
+// Close closes the b2log file
+func (rr *RangeReader) Close() error {
+	return rr.file.Close()
+}
+
+// check whether the error is for the record only, and the header is available
+func recordErrCheck(err error) bool {
+	return err == ErrCompressed || err == ErrDecompress
+}
+
+/*
+rangeIndexSearch - get start position for records from given timestamp, by index
+
+Params:
+    - path: path of index file
+    - from: timestamp of the first record
+    - size: size of b2log file
+
+Returns:
+    (offset, error)
+*/
+func rangeIndexSearch(path string, from uint64, size int64) (int64, error) {
+	entries, err := IndexLoad(path)
+	if err != nil {
+		return 0, err
+	}
+
+	// find the last entry before from
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].TimeStamp >= from
+	})
+	if i == 0 {
+		return 0, nil
+	}
+
+	offset := entries[i-1].Offset
+	if offset > size {
+		// index does not match the file
+		offset = 0
+	}
+	return offset, nil
+}
+
+/*
+rangeBinarySearch - get start position for records from given timestamp, by
+binary search on resynchronized headers
+
+Params:
+    - file: b2log file
+    - from: timestamp of the first record
+    - size: size of b2log file
+
+Returns:
+    (offset, error)
+    The returned offset may be before the first record, and the records
+    before it should be bypassed.
+*/
+func rangeBinarySearch(file *os.File, from uint64, size int64) (int64, error) {
+	low := int64(0)
+	high := size
+
+	for high-low > RANGE_SCAN_SIZE {
+		mid := low + (high-low)/2
+
+		offset, timestamp, err := rangeRecordFind(file, mid, size)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// no record after mid
+			high = mid
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if timestamp < from {
+			// all records before offset are before from
+			low = offset
+		} else {
+			high = mid
+		}
+	}
+
+	return low, nil
+}
+
+/*
+rangeRecordFind - find the first record from given position
+
+Params:
+    - file: b2log file
+    - start: position to start from
+    - size: size of b2log file
+
+Returns:
+    (offset, timestamp, error)
+    - offset: offset of the record found
+    - timestamp: timestamp of the record found
+*/
+func rangeRecordFind(file *os.File, start int64, size int64) (int64, uint64, error) {
+	reader := NewReader(io.NewSectionReader(file, start, size-start))
+	reader.SetOffset(start)
+
+	_, err := reader.Read()
+	if err != nil && !recordErrCheck(err) {
+		return 0, 0, err
+	}
+
+	return reader.RecordOffset(), reader.Header().TimeStamp, nil
+}
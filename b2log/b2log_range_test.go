@@ -0,0 +1,144 @@
+/* b2log_range_test.go - test for b2log_range.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package b2log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// prepare b2log file, with timestamp from 0 to 999 milliseconds
+func rangeFilePrepare(path string, withIndex bool) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := NewWriter(file)
+	if withIndex {
+		index, err := os.Create(IndexPathGen(path))
+		if err != nil {
+			return err
+		}
+		defer index.Close()
+		w.SetIndex(index, 50, 0)
+	}
+
+	payload := bytes.Repeat([]byte("x"), 200)
+	for i := 0; i < 1000; i++ {
+		copy(payload, fmt.Sprintf("%04d", i))
+		if _, err := w.WriteWithTime(payload, uint64(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check records read from range reader
+func rangeCheck(t *testing.T, path string, from, to int) {
+	rr, err := OpenRange(path, time.Unix(0, int64(from)*1e6), time.Unix(0, int64(to)*1e6))
+	if err != nil {
+		t.Fatalf("OpenRange():%s", err.Error())
+	}
+	defer rr.Close()
+
+	expect := from
+	for {
+		record, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("rr.Read():%s", err.Error())
+		}
+		if string(record[0:4]) != fmt.Sprintf("%04d", expect) {
+			t.Fatalf("record should be %d, now it's %s", expect, record[0:4])
+		}
+		expect++
+	}
+
+	// there are only 1000 records in file
+	if to > 1000 {
+		to = 1000
+	}
+	if from < to && expect != to {
+		t.Errorf("last record should be %d, now it's %d", to-1, expect-1)
+	}
+}
+
+// test of OpenRange(), with index
+func Test_OpenRange_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_range")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "range")
+	if err := rangeFilePrepare(path, true); err != nil {
+		t.Fatalf("rangeFilePrepare():%s", err.Error())
+	}
+
+	offset, err := rangeIndexSearch(IndexPathGen(path), 520, 1<<30)
+	if err != nil {
+		t.Fatalf("rangeIndexSearch():%s", err.Error())
+	}
+	if offset != 500*(HEADER_SIZE+200) {
+		t.Errorf("offset should be %d, now it's %d", 500*(HEADER_SIZE+200), offset)
+	}
+
+	rangeCheck(t, path, 250, 500)
+	rangeCheck(t, path, 0, 1000)
+	rangeCheck(t, path, 999, 1000)
+	rangeCheck(t, path, 1000, 2000)
+	rangeCheck(t, path, 600, 1200)
+}
+
+// test of OpenRange(), without index
+func Test_OpenRange_2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_range")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "range")
+	if err := rangeFilePrepare(path, false); err != nil {
+		t.Fatalf("rangeFilePrepare():%s", err.Error())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("os.Open():%s", err.Error())
+	}
+	defer file.Close()
+	size := int64(1000 * (HEADER_SIZE + 200))
+	offset, err := rangeBinarySearch(file, 800, size)
+	if err != nil {
+		t.Fatalf("rangeBinarySearch():%s", err.Error())
+	}
+	if offset == 0 || offset > 800*(HEADER_SIZE+200) {
+		t.Errorf("offset should be in (0, %d], now it's %d", 800*(HEADER_SIZE+200), offset)
+	}
+
+	rangeCheck(t, path, 250, 500)
+	rangeCheck(t, path, 0, 1000)
+	rangeCheck(t, path, 999, 1000)
+	rangeCheck(t, path, 1000, 2000)
+	rangeCheck(t, path, 600, 1200)
+}
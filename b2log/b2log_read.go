@@ -3,6 +3,7 @@
 modification history
 --------------------
 2014/11/4, by Zhang Miao, create
+2026/10/18, by agent, bypass record with length larger than MAX_RECORD_LEN
 */
 /*
 DESCRIPTION
@@ -19,6 +20,8 @@ import (
 var (
 	ErrNoEnoughData = errors.New("No enough data")
 	ErrCompressed   = errors.New("Compress is not support")
+	ErrChecksum     = errors.New("Checksum is not correct")
+	ErrRecordLen    = errors.New("Record length is not correct")
 )
 
 /* 
@@ -31,6 +34,9 @@ Returns:
     (records, buffer)
     - records: [record, record, ...]
     - buffer: after removed the decoded record, or pass the unsynchronized data
+
+Compressed records are decompressed. Records with unsupported compress type,
+with incorrect checksum, or with length larger than MAX_RECORD_LEN are bypassed.
 */
 func BuffParse(buffer []byte) ([]Record, []byte) {
     var hasNext bool
@@ -43,8 +49,6 @@ func BuffParse(buffer []byte) ([]Record, []byte) {
         hasNext, record, buffer, err = recordParse(buffer)    
         if err == nil  {
             records = append(records, record)
-        } else {
-            // TBD: record if it is compressed
         }
     
         if !hasNext {
@@ -79,40 +83,59 @@ func recordParse(buffer []byte) (bool, Record, []byte, error) {
     
     // read loghead
     logHeader, buffer, err := logHeaderRead(buffer)    
+    if err == ErrNoEnoughData {
+        return false, record, buffer, err
+    }
     if err != nil {
         // fail to read Header from buffer
         return true, record, buffer, fmt.Errorf("read header:%s", err.Error())
     }
+    headerSize := headerSizeGet(logHeader.HeaderVersion())
+
+    // check length of record, in the same way as Reader
+    if logHeader.UnCompressLen > MAX_RECORD_LEN || logHeader.CompressLen > MAX_RECORD_LEN {
+        // length is not correct, try to find the next start
+        buffer = tryFindNextStart(buffer[1:])
+        return true, record, buffer, ErrRecordLen
+    }
 
     // check whether it is compressed record
     if logHeader.CompressLen != 0 {
         dataLen = int(logHeader.CompressLen)
-        if dataLen > MAX_RECORD_LEN {
-            // maybe logHeader.CompressLen is not correct
-            dataLen = MAX_RECORD_LEN;
+        offset = headerSize + dataLen
+
+        if !decompressSupported(logHeader.CompressType()) {
+            // compress type is not supported.
+            // So just bypass it and report error
+            if len(buffer) >= offset {
+                // bypass the record, only when record is completely in the buffer
+                buffer = buffer[offset:]
+                return true, record, buffer, ErrCompressed
+            } else {
+                return false, record, buffer, ErrCompressed
+            }
         }
-            
-        // Compression is not supported now.
-        // So if there is compressed record, just bypass it and report error        
-        offset = HEADER_SIZE + dataLen
-                 
-        if len(buffer) >= offset {
-            // bypass the record, only when record is completely in the buffer
-            buffer = buffer[offset:]
-            return true, record, buffer, ErrCompressed
-        } else {
-            return false, record, buffer, ErrCompressed
+
+        if len(buffer) < offset {
+            // no enough data, wait for the next time
+            return false, record, buffer, ErrNoEnoughData
+        }
+
+        // verify and decompress the record, and remove it from the buffer
+        if !recordVerify(logHeader, buffer[headerSize:offset]) {
+            buffer = tryFindNextStart(buffer[1:])
+            return true, record, buffer, ErrChecksum
         }
+        record, err = recordDecompress(logHeader, buffer[headerSize:offset])
+        buffer = buffer[offset:]
+
+        return true, record, buffer, err
     }
 
     dataLen = int(logHeader.UnCompressLen)
-    if dataLen > MAX_RECORD_LEN {
-        // maybe pHead->uncompress_len is not correct
-        dataLen = MAX_RECORD_LEN
-    }    
     
     // check whether record is completely in the buffer    
-    offset = HEADER_SIZE + dataLen
+    offset = headerSize + dataLen
 
     if len(buffer) < offset {
         // no enough data, wait for the next time
@@ -120,7 +143,12 @@ func recordParse(buffer []byte) (bool, Record, []byte, error) {
     }
     
     // get record out of the buffer
-    record = buffer[HEADER_SIZE:offset]
+    record = buffer[headerSize:offset]
+    if !recordVerify(logHeader, record) {
+        // record is broken, try to find the next start
+        buffer = tryFindNextStart(buffer[1:])
+        return true, nil, buffer, ErrChecksum
+    }
     buffer = buffer[offset:]
     
     return true, record, buffer, nil
@@ -130,39 +158,60 @@ func recordParse(buffer []byte) (bool, Record, []byte, error) {
 logHeaderRead - read one b2log header from given buffer
 
 Params:
-- buffer: buffer with binary data
+- buffer: buffer with binary data, at least HEADER_SIZE bytes
 
 Returns:
     (header, buffer, error)
     - header: b2log header
     - buffer: after removed the record, or pass the unsynchronized data
+    - error: ErrNoEnoughData, if header of version 2 is not completely in buffer
 */
 func logHeaderRead(buffer []byte) (Header, []byte, error) {
 	var header Header
 
-    // get data buffer of header
-    headerBuf := buffer[0:HEADER_SIZE]
-        
-    // try to unpack buffer to b2log header
-    bufReader := bytes.NewReader(headerBuf)
-	err := binary.Read(bufReader, binary.LittleEndian, &header)
-    if err != nil {
-        // this should not happen, bypass the header in buffer
-        buffer = buffer[HEADER_SIZE:]
+    // check magic number
+    if !bytes.HasPrefix(buffer, MAGIC_NUMBER_STR) {
+        magicNumber := binary.LittleEndian.Uint32(buffer[0:4])
         buffer = tryFindNextStart(buffer)
-
-        return header, buffer, fmt.Errorf("header decode:%s", err.Error())
+        return header, buffer, fmt.Errorf("invalid magic number:0x%x", magicNumber)
     }
 
-    // check magic number
-    if header.MagicNumber != MAGIC_NUMBER {
-        buffer = tryFindNextStart(buffer)
-        return header, buffer, fmt.Errorf("invalid magic number:0x%x", header.MagicNumber)
+    // check version of header
+    version := headerVersionGet(buffer)
+    headerSize := headerSizeGet(version)
+    if headerSize == 0 {
+        // bypass the magic number
+        buffer = tryFindNextStart(buffer[1:])
+        return header, buffer, fmt.Errorf("invalid header version:%d", version)
+    }
+    if len(buffer) < headerSize {
+        return header, buffer, ErrNoEnoughData
     }
+
+    // unpack buffer to b2log header
+    header = headerDecode(buffer)
     
     return header, buffer, nil
 }
 
+/*
+recordVerify - verify checksum of data in record
+
+Params:
+- header: header of the record
+- data: data in record
+
+Returns:
+    true, if checksum is correct, or there is no checksum in header
+*/
+func recordVerify(header Header, data []byte) bool {
+    if header.HeaderVersion() != HEADER_VERSION_V2 {
+        return true
+    }
+
+    return recordChecksum(data) == header.Checksum
+}
+
 /*
 tryFindNextStart - try to find the next start of b2log record
 
@@ -3,6 +3,7 @@
 modification history
 --------------------
 2014/11/27, by Zhang Miao, create
+2026/10/18, by agent, records after record with too large length are not bypassed
 */
 /*
 DESCRIPTION
@@ -10,14 +11,15 @@ DESCRIPTION
 package b2log
 
 import (
+    "bytes"
     "io/ioutil"
     "testing"
 )
 
-// test of unsafe.Sizeof()
+// test of HEADER_SIZE
 func Test_Sizeof_1(t *testing.T) {
     if HEADER_SIZE != 24 {
-        t.Error("unsafe.Sizeof(Header)")
+        t.Error("HEADER_SIZE")
     }
 }
 
@@ -128,8 +130,9 @@ func Test_BuffParse_5(t *testing.T) {
     // parse b2log record from data
     records, buffer := BuffParse(data)
     
-    if len(records) != 507 {
-        t.Errorf("len(records) should be 507, but now it's %d", len(records))
+    // first record is bypassed, but not the following 100K, same as Reader
+    if len(records) != 799 {
+        t.Errorf("len(records) should be 799, but now it's %d", len(records))
     }
     if len(buffer) != 0 {
         t.Errorf("len(buffer) should be 0, but now it's %d", len(buffer))
@@ -149,10 +152,29 @@ func Test_BuffParse_6(t *testing.T) {
     // parse b2log record from data
     records, buffer := BuffParse(data)
     
-    if len(records) != 508 {
-        t.Errorf("len(records) should be 508, but now it's %d", len(records))
+    // first record is bypassed, but not the following 100K, same as Reader
+    if len(records) != 799 {
+        t.Errorf("len(records) should be 799, but now it's %d", len(records))
     }
     if len(buffer) != 0 {
         t.Errorf("len(buffer) should be 0, but now it's %d", len(buffer))
     }
-}
\ No newline at end of file
+}
+
+// test of headerEncode() and headerDecode()
+func Test_HeaderEncode(t *testing.T) {
+    header := Header{MAGIC_NUMBER, HEADER_VERSION_V2, 1, 2, 3, 4, 5}
+    buff := make([]byte, HEADER_SIZE_V2)
+    headerEncode(buff, &header)
+
+    // little-endian, regardless of machine
+    expect := []byte{0xA7, 0xBE, 0xAE, 0xB0, 2, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0,
+        3, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 5, 0, 0, 0}
+    if !bytes.Equal(buff, expect) {
+        t.Errorf("headerEncode() = %v", buff)
+    }
+
+    if headerDecode(buff) != header {
+        t.Errorf("headerDecode() = %v", headerDecode(buff))
+    }
+}
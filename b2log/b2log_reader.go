@@ -0,0 +1,301 @@
+/* b2log_reader.go - read b2log records one by one from io.Reader  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Reader wraps an io.Reader, and yields one b2log record at a time.
+
+Compressed records are decompressed before returned.
+
+Both version 1 and version 2 of header are accepted. For version 2, records
+with incorrect checksum are regarded as unsynchronized data.
+
+Unsynchronized data (e.g., broken header, invalid length) is bypassed by
+searching for the next MAGIC_NUMBER_STR. Bytes bypassed are counted, and
+may be reported to a SkipHandler.
+
+Usage:
+    r := b2log.NewReader(file)
+    r.SetSkipHandler(func(offset int64, size int64) {
+        log.Logger.Warn("b2log: skip %d bytes at offset %d", size, offset)
+    })
+
+    for {
+        record, err := r.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            ...
+        }
+        // record is only valid until the next call to Read()
+    }
+*/
+package b2log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// default size of reader buffer, which can hold the largest record
+const READER_BUFF_SIZE = HEADER_SIZE_V2 + MAX_RECORD_LEN
+
+// max number of consecutive empty reads from underlying reader
+const maxConsecutiveEmptyReads = 100
+
+var (
+	ErrBuffTooSmall = errors.New("b2log: buffer size too small")
+)
+
+// SkipHandler is called when unsynchronized data is bypassed by Reader
+// - offset: offset in the stream of the bypassed data
+// - size: size of the bypassed data
+type SkipHandler func(offset int64, size int64)
+
+// Reader reads b2log records from an io.Reader
+type Reader struct {
+	rd  io.Reader // underlying reader
+	buf []byte    // buffer for data read from rd
+	r   int       // read position in buf
+	w   int       // write position in buf
+
+	offset int64 // offset in the stream of buf[r]
+
+	header    Header // header of the last record
+	recOffset int64  // offset in the stream of the last record
+
+	skipped     int64       // total bytes skipped
+	skipOffset  int64       // offset of data being skipped
+	skipSize    int64       // size of data being skipped, not reported yet
+	skipHandler SkipHandler // handler for skipped data
+}
+
+// NewReader returns a Reader with default buffer size
+func NewReader(rd io.Reader) *Reader {
+	r, _ := NewReaderSize(rd, READER_BUFF_SIZE)
+	return r
+}
+
+// NewReaderSize returns a Reader with given buffer size
+// Records larger than the buffer can not be read.
+func NewReaderSize(rd io.Reader, size int) (*Reader, error) {
+	if size < HEADER_SIZE_V2 {
+		return nil, ErrBuffTooSmall
+	}
+
+	r := new(Reader)
+	r.rd = rd
+	r.buf = make([]byte, size)
+
+	return r, nil
+}
+
+// SetOffset sets offset in the stream of the next byte to be parsed
+// It should be called before the first Read(), if the underlying reader does
+// not start from the beginning of the stream.
+func (r *Reader) SetOffset(offset int64) {
+	r.offset = offset
+}
+
+// SetSkipHandler sets handler for bypassed data
+func (r *Reader) SetSkipHandler(handler SkipHandler) {
+	r.skipHandler = handler
+}
+
+/*
+Read - read the next record
+
+Returns:
+    (record, error)
+    - record: payload of the record. It's only valid until the next call to Read()
+    - error:
+        io.EOF, no more data
+        io.ErrUnexpectedEOF, no more data, but there is a partial record left in buffer
+        ErrCompressed, compress type of the record is not supported, and it has been bypassed
+        ErrDecompress, fail to decompress the record, and it has been bypassed
+        other error from the underlying reader
+
+For io.EOF and io.ErrUnexpectedEOF, Read() could be called again after more
+data is appended to the underlying reader (e.g., tailing a file).
+*/
+func (r *Reader) Read() (Record, error) {
+	emptyReads := 0
+
+	for {
+		buf := r.buf[r.r:r.w]
+
+		if len(buf) >= len(MAGIC_NUMBER_STR) && !bytes.HasPrefix(buf, MAGIC_NUMBER_STR) {
+			r.resync()
+			continue
+		}
+
+		if len(buf) >= HEADER_SIZE_V1 {
+			headerSize := headerSizeGet(headerVersionGet(buf))
+			if headerSize == 0 {
+				// unknown version, bypass the magic number
+				r.skip(1)
+				continue
+			}
+
+			if len(buf) >= headerSize {
+				header := headerDecode(buf)
+				dataLen := int(header.UnCompressLen)
+				if header.CompressLen != 0 {
+					dataLen = int(header.CompressLen)
+				}
+
+				if dataLen > MAX_RECORD_LEN || header.UnCompressLen > MAX_RECORD_LEN ||
+					headerSize+dataLen > len(r.buf) {
+					// length is not correct, bypass the magic number
+					r.skip(1)
+					continue
+				}
+
+				if len(buf) >= headerSize+dataLen {
+					record := Record(buf[headerSize : headerSize+dataLen])
+					if !recordVerify(header, record) {
+						// record is broken, bypass the magic number
+						r.skip(1)
+						continue
+					}
+
+					r.header = header
+					r.recOffset = r.offset
+					r.consume(headerSize + dataLen)
+					r.skipReport()
+
+					if header.CompressLen != 0 {
+						return r.decompress(header, record)
+					}
+					return record, nil
+				}
+			}
+		}
+
+		// no enough data, read more from underlying reader
+		n, err := r.fill()
+		if err != nil {
+			r.skipReport()
+			if err == io.EOF && r.r < r.w {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if n == 0 {
+			emptyReads++
+			if emptyReads >= maxConsecutiveEmptyReads {
+				return nil, io.ErrNoProgress
+			}
+		} else {
+			emptyReads = 0
+		}
+	}
+}
+
+// decompress data of compressed record
+func (r *Reader) decompress(header Header, data []byte) (Record, error) {
+	if !decompressSupported(header.CompressType()) {
+		return nil, ErrCompressed
+	}
+
+	payload, err := recordDecompress(header, data)
+	if err != nil {
+		return nil, err
+	}
+	return Record(payload), nil
+}
+
+// Header returns header of the record last read
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// RecordOffset returns offset in the stream of the record last read
+func (r *Reader) RecordOffset() int64 {
+	return r.recOffset
+}
+
+// Offset returns offset in the stream of the next byte to be parsed
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// Skipped returns total number of bytes bypassed
+func (r *Reader) Skipped() int64 {
+	return r.skipped
+}
+
+// Buffered returns number of bytes that have been read from the underlying
+// reader but not parsed yet
+func (r *Reader) Buffered() int {
+	return r.w - r.r
+}
+
+// read more data from underlying reader
+func (r *Reader) fill() (int, error) {
+	// move existing data to the beginning of buffer
+	if r.r > 0 {
+		copy(r.buf, r.buf[r.r:r.w])
+		r.w -= r.r
+		r.r = 0
+	}
+
+	n, err := r.rd.Read(r.buf[r.w:])
+	if n < 0 {
+		panic("b2log: reader returned negative count from Read")
+	}
+	r.w += n
+
+	if n > 0 && err == io.EOF {
+		// data first, report io.EOF next time
+		err = nil
+	}
+	return n, err
+}
+
+// try to find the next start of b2log record
+func (r *Reader) resync() {
+	buf := r.buf[r.r:r.w]
+
+	offset := bytes.Index(buf[1:], MAGIC_NUMBER_STR)
+	if offset >= 0 {
+		r.skip(offset + 1)
+		return
+	}
+
+	// keep the tail, which may be the beginning of magic number
+	r.skip(len(buf) - len(MAGIC_NUMBER_STR) + 1)
+}
+
+// remove n bytes from buffer, as unsynchronized data
+func (r *Reader) skip(n int) {
+	if r.skipSize == 0 {
+		r.skipOffset = r.offset
+	}
+	r.skipSize += int64(n)
+	r.skipped += int64(n)
+	r.consume(n)
+}
+
+// report the data skipped to handler
+func (r *Reader) skipReport() {
+	if r.skipSize == 0 {
+		return
+	}
+
+	if r.skipHandler != nil {
+		r.skipHandler(r.skipOffset, r.skipSize)
+	}
+	r.skipSize = 0
+}
+
+// remove n bytes from buffer
+func (r *Reader) consume(n int) {
+	r.r += n
+	r.offset += int64(n)
+}
@@ -0,0 +1,164 @@
+/* b2log_reader_test.go - test for b2log_reader.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package b2log
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// read all records from reader
+func readAll(r *Reader) (int, int, error) {
+	records := 0
+	compressed := 0
+	for {
+		_, err := r.Read()
+		switch err {
+		case nil:
+			records++
+		case ErrCompressed:
+			compressed++
+		case io.EOF:
+			return records, compressed, nil
+		default:
+			return records, compressed, err
+		}
+	}
+}
+
+// test of Reader, case 1
+// It's the normal situation
+func Test_Reader_1(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/pb_access_1.log")
+	if err != nil {
+		t.Fatalf("fail to open file for testing data")
+	}
+
+	// read one byte each time, to test refill of buffer
+	r := NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+	records, _, err := readAll(r)
+	if err != nil {
+		t.Fatalf("readAll():%s", err.Error())
+	}
+	if records != 8 {
+		t.Errorf("records should be 8, but now it's %d", records)
+	}
+	if r.Skipped() != 0 {
+		t.Errorf("r.Skipped() should be 0, but now it's %d", r.Skipped())
+	}
+	if r.Offset() != int64(len(data)) {
+		t.Errorf("r.Offset() should be %d, but now it's %d", len(data), r.Offset())
+	}
+}
+
+// test of Reader, case 2
+// magic number of first record is break
+func Test_Reader_2(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/pb_access_2.log")
+	if err != nil {
+		t.Fatalf("fail to open file for testing data")
+	}
+
+	var skipOffset, skipSize int64
+	r := NewReader(bytes.NewReader(data))
+	r.SetSkipHandler(func(offset int64, size int64) {
+		skipOffset = offset
+		skipSize += size
+	})
+
+	records, _, err := readAll(r)
+	if err != nil {
+		t.Fatalf("readAll():%s", err.Error())
+	}
+	if records != 7 {
+		t.Errorf("records should be 7, but now it's %d", records)
+	}
+	if r.Skipped() != 459 || skipSize != 459 || skipOffset != 0 {
+		t.Errorf("skipped should be 459 at 0, but now it's %d(%d) at %d",
+			r.Skipped(), skipSize, skipOffset)
+	}
+}
+
+// test of Reader, case 3
+// compress_len of first record is not zero
+func Test_Reader_3(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/pb_access_3.log")
+	if err != nil {
+		t.Fatalf("fail to open file for testing data")
+	}
+
+	r := NewReader(bytes.NewReader(data))
+	records, compressed, err := readAll(r)
+	if err != nil {
+		t.Fatalf("readAll():%s", err.Error())
+	}
+	if records != 7 || compressed != 1 {
+		t.Errorf("records should be 7/1, but now it's %d/%d", records, compressed)
+	}
+}
+
+// test of Reader, case 4
+// uncompress_len of first record is larger than 100K
+func Test_Reader_4(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/pb_access_5.log")
+	if err != nil {
+		t.Fatalf("fail to open file for testing data")
+	}
+
+	r := NewReader(bytes.NewReader(data))
+	records, _, err := readAll(r)
+	if err != nil {
+		t.Fatalf("readAll():%s", err.Error())
+	}
+	if records != 799 {
+		t.Errorf("records should be 799, but now it's %d", records)
+	}
+	if r.Skipped() != 459 {
+		t.Errorf("r.Skipped() should be 459, but now it's %d", r.Skipped())
+	}
+}
+
+// test of Reader, case 5
+// partial record at the end, and more data appended later
+func Test_Reader_5(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/pb_access_1.log")
+	if err != nil {
+		t.Fatalf("fail to open file for testing data")
+	}
+
+	buff := bytes.NewBuffer(data[0:500])
+	r := NewReader(buff)
+
+	// the first record
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("r.Read():%s", err.Error())
+	}
+
+	// the second record is incomplete
+	if _, err := r.Read(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("r.Read() should return io.ErrUnexpectedEOF, now it's %v", err)
+	}
+
+	// append the rest
+	buff.Write(data[500:])
+	records, _, err := readAll(r)
+	if err != nil {
+		t.Fatalf("readAll():%s", err.Error())
+	}
+	if records != 7 {
+		t.Errorf("records should be 7, but now it's %d", records)
+	}
+	if r.Skipped() != 0 {
+		t.Errorf("r.Skipped() should be 0, but now it's %d", r.Skipped())
+	}
+}
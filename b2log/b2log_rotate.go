@@ -0,0 +1,589 @@
+/* b2log_rotate.go - write b2log records to files, with rotation  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+RotatingWriter writes b2log records to files in a directory, and rotates
+files hourly, daily, or by size.
+
+Files are named by file_util.FullPathGen(), in format:
+    rootDir/day/prefix_dayTime.suffix
+e.g., ./log/20161018/access_20161018150405.b2log
+
+Rotation never splits a record across files. If rotation fails, the record
+is written to current file, and *RotateError is returned with len(payload);
+rotation is retried at the next threshold, i.e., the next time for rotation
+by time, or MaxSize more bytes written for rotation by size.
+
+Usage:
+    conf := b2log.RotatingConfig{
+        RootDir:      "./log",
+        Prefix:       "access",
+        Suffix:       "b2log",
+        When:         b2log.ROTATE_HOURLY,
+        MaxSize:      1024 * 1024 * 1024,
+        BackupCount:  72,
+        SyncPolicy:   b2log.SYNC_INTERVAL,
+        SyncInterval: 100 * time.Millisecond,
+    }
+    w, err := b2log.NewRotatingWriter(conf)
+    if err != nil {
+        ...
+    }
+    defer w.Close()
+
+    w.Write([]byte("this is a test"))
+*/
+package b2log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/file_util"
+)
+
+// when to rotate by time
+const (
+	ROTATE_NONE   = ""  // not rotate by time
+	ROTATE_HOURLY = "H" // rotate at the beginning of every hour
+	ROTATE_DAILY  = "D" // rotate at midnight
+)
+
+// format of dayTime in file name
+const dayTimeFormat = "20060102150405"
+
+// policy of fsync
+const (
+	SYNC_NEVER        = 0 // never fsync, leave it to OS
+	SYNC_EVERY_RECORD = 1 // fsync after every record
+	SYNC_INTERVAL     = 2 // fsync every SyncInterval
+)
+
+var (
+	ErrWriterClosed = errors.New("b2log: writer closed")
+)
+
+// RotateError is returned by RotatingWriter, if record is written to current
+// file but rotation fails
+type RotateError struct {
+	Err error
+}
+
+func (e *RotateError) Error() string {
+	return "b2log: rotate:" + e.Err.Error()
+}
+
+// config for RotatingWriter
+type RotatingConfig struct {
+	RootDir string // root directory of files
+	Prefix  string // prefix of file name
+	Suffix  string // suffix of file name; "b2log" if not set
+
+	When        string // rotate by time, ROTATE_NONE, ROTATE_HOURLY or ROTATE_DAILY
+	MaxSize     int64  // rotate if size of file will exceed MaxSize; 0 for no limit
+	BackupCount int    // max number of old files kept; 0 for keeping all
+
+	SyncPolicy   int           // SYNC_NEVER, SYNC_EVERY_RECORD or SYNC_INTERVAL
+	SyncInterval time.Duration // interval for SYNC_INTERVAL
+
+	Version  uint32 // version of header; 0 for HEADER_VERSION
+	Compress uint32 // compress type of records
+
+	IndexRecords  int           // add index entry every IndexRecords records; 0 for not used
+	IndexInterval time.Duration // add index entry every IndexInterval; 0 for not used
+}
+
+// RotatingWriter writes b2log records to files, with rotation
+type RotatingWriter struct {
+	lock sync.Mutex
+	conf RotatingConfig
+
+	file       *os.File  // current file
+	indexFile  *os.File  // index file for current file, optional
+	writer     *Writer   // writer for current file
+	path       string    // path of current file
+	rotateTime time.Time // time for the next rotation by time
+	rotateSize int64     // size of current file for the next rotation by size; 0 for no limit
+	dirty      bool      // whether there is data not synced
+
+	closed bool
+	stopCh chan bool // to stop sync goroutine
+	doneCh chan bool // closed when sync goroutine exits
+}
+
+// check config for RotatingWriter
+func (conf *RotatingConfig) check() error {
+	if conf.RootDir == "" {
+		return fmt.Errorf("RootDir not set")
+	}
+	if conf.Prefix == "" {
+		return fmt.Errorf("Prefix not set")
+	}
+	if conf.Suffix == "" {
+		conf.Suffix = "b2log"
+	}
+
+	switch conf.When {
+	case ROTATE_NONE, ROTATE_HOURLY, ROTATE_DAILY:
+	default:
+		return fmt.Errorf("invalid When:%s", conf.When)
+	}
+
+	if conf.MaxSize < 0 {
+		return fmt.Errorf("invalid MaxSize:%d", conf.MaxSize)
+	}
+	if conf.BackupCount < 0 {
+		return fmt.Errorf("invalid BackupCount:%d", conf.BackupCount)
+	}
+
+	switch conf.SyncPolicy {
+	case SYNC_NEVER, SYNC_EVERY_RECORD:
+	case SYNC_INTERVAL:
+		if conf.SyncInterval <= 0 {
+			return fmt.Errorf("invalid SyncInterval:%s", conf.SyncInterval)
+		}
+	default:
+		return fmt.Errorf("invalid SyncPolicy:%d", conf.SyncPolicy)
+	}
+
+	if conf.Version == 0 {
+		conf.Version = HEADER_VERSION
+	}
+	if headerSizeGet(conf.Version) == 0 {
+		return ErrHeaderVersion
+	}
+	if err := compressTypeCheck(conf.Compress); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NewRotatingWriter creates a RotatingWriter, and opens the first file
+func NewRotatingWriter(conf RotatingConfig) (*RotatingWriter, error) {
+	if err := conf.check(); err != nil {
+		return nil, fmt.Errorf("RotatingConfig.check():%s", err.Error())
+	}
+
+	w := new(RotatingWriter)
+	w.conf = conf
+	if err := w.open(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if conf.SyncPolicy == SYNC_INTERVAL {
+		w.stopCh = make(chan bool)
+		w.doneCh = make(chan bool)
+		go w.syncLoop()
+	}
+
+	return w, nil
+}
+
+// Write writes payload as one record, with current time as timestamp
+// It returns len(payload) if succeed.
+func (w *RotatingWriter) Write(payload []byte) (int, error) {
+	return w.WriteRecord(payload, timestampGen(), 0)
+}
+
+// WriteWithTime writes payload as one record, with given timestamp
+// It returns len(payload) if succeed.
+func (w *RotatingWriter) WriteWithTime(payload []byte, timestamp uint64) (int, error) {
+	return w.WriteRecord(payload, timestamp, 0)
+}
+
+// WriteRecord writes payload as one record, with given timestamp and record type
+// It returns len(payload) if succeed, or (len(payload), *RotateError) if
+// record is written to current file but rotation fails.
+func (w *RotatingWriter) WriteRecord(payload []byte, timestamp uint64, recordType uint32) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	// rotate before writing, if needed; if it fails, keep writing to
+	// current file, and retry at the next threshold
+	var rotateErr error
+	now := time.Now()
+	if w.rotateCheck(now, len(payload)) {
+		if err := w.rotate(now); err != nil {
+			w.rotateDelay(now)
+			rotateErr = &RotateError{Err: err}
+		}
+	}
+
+	n, err := w.writer.WriteRecord(payload, timestamp, recordType)
+	if n > 0 {
+		// record is written, even if writing index fails
+		w.dirty = true
+	}
+	if err != nil {
+		return n, err
+	}
+
+	// record is written already, even if sync fails
+	if w.conf.SyncPolicy == SYNC_EVERY_RECORD {
+		if err := w.syncLocked(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, rotateErr
+}
+
+// Path returns path of current file
+func (w *RotatingWriter) Path() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.path
+}
+
+// Sync commits current file to stable storage
+func (w *RotatingWriter) Sync() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	return w.syncLocked()
+}
+
+// Close syncs and closes current file
+func (w *RotatingWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	err := w.closeFile()
+	w.lock.Unlock()
+
+	// wait for sync goroutine to exit
+	if w.stopCh != nil {
+		close(w.stopCh)
+		<-w.doneCh
+	}
+
+	return err
+}
+
+// sync current file periodically, for SYNC_INTERVAL
+func (w *RotatingWriter) syncLoop() {
+	ticker := time.NewTicker(w.conf.SyncInterval)
+	defer ticker.Stop()
+	defer close(w.doneCh)
+
+	for {
+		select {
+		case <-ticker.C:
+			w.lock.Lock()
+			if !w.closed {
+				w.syncLocked()
+			}
+			w.lock.Unlock()
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// sync current file, with w.lock held
+func (w *RotatingWriter) syncLocked() error {
+	if !w.dirty {
+		return nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	if w.indexFile != nil {
+		if err := w.indexFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	w.dirty = false
+	return nil
+}
+
+// check whether rotation is needed before writing payload
+func (w *RotatingWriter) rotateCheck(now time.Time, payloadLen int) bool {
+	if w.conf.When != ROTATE_NONE && !now.Before(w.rotateTime) {
+		return true
+	}
+
+	// size of compressed record is not larger than payload
+	// do not rotate for empty file, even if the record is too large
+	offset := w.writer.Offset()
+	size := int64(headerSizeGet(w.conf.Version) + payloadLen)
+	if w.rotateSize > 0 && offset > 0 && offset+size > w.rotateSize {
+		return true
+	}
+
+	return false
+}
+
+// delay rotation of current file to the next threshold, after rotation fails
+func (w *RotatingWriter) rotateDelay(now time.Time) {
+	w.rotateTime = rotateTimeGen(w.conf.When, now)
+	if w.conf.MaxSize > 0 {
+		w.rotateSize = w.writer.Offset() + w.conf.MaxSize
+	}
+}
+
+// open a new file, and close current one
+// Current file is kept, if the new file fails to open.
+func (w *RotatingWriter) rotate(now time.Time) error {
+	file, indexFile, dirty := w.file, w.indexFile, w.dirty
+	if err := w.open(now); err != nil {
+		return err
+	}
+
+	w.backupClean()
+	return fileClose(file, indexFile, dirty)
+}
+
+// open a new file
+func (w *RotatingWriter) open(now time.Time) error {
+	path, err := w.pathGen(now)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := NewWriter(file)
+	writer.SetVersion(w.conf.Version)
+	writer.SetCompress(w.conf.Compress)
+
+	var indexFile *os.File
+	if w.conf.IndexRecords > 0 || w.conf.IndexInterval > 0 {
+		indexFile, err = os.OpenFile(IndexPathGen(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.SetIndex(indexFile, w.conf.IndexRecords, w.conf.IndexInterval)
+	}
+
+	w.file = file
+	w.indexFile = indexFile
+	w.writer = writer
+	w.path = path
+	w.rotateTime = rotateTimeGen(w.conf.When, now)
+	w.rotateSize = w.conf.MaxSize
+	w.dirty = false
+
+	return nil
+}
+
+// sync and close current file
+func (w *RotatingWriter) closeFile() error {
+	err := fileClose(w.file, w.indexFile, w.dirty)
+	w.indexFile = nil
+	w.dirty = false
+
+	return err
+}
+
+// sync (if dirty) and close file and its index file
+func fileClose(file *os.File, indexFile *os.File, dirty bool) error {
+	var err error
+	if dirty {
+		err = file.Sync()
+		if err == nil && indexFile != nil {
+			err = indexFile.Sync()
+		}
+	}
+
+	if indexFile != nil {
+		indexFile.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// generate path for new file, which does not exist
+func (w *RotatingWriter) pathGen(now time.Time) (string, error) {
+	day := now.Format("20060102")
+	if err := file_util.DirCreate(filepath.Join(w.conf.RootDir, day)); err != nil {
+		return "", err
+	}
+
+	// for more than one file in one second, sequence is added after dayTime;
+	// it is larger than that of current file, even if older files are removed
+	dayTime := now.Format(dayTimeFormat)
+	seq := 0
+	if w.path != "" {
+		if currTime, currSeq, _ := w.backupSeqGet(w.path); currTime == dayTime {
+			seq = currSeq + 1
+		}
+	}
+
+	for {
+		seqTime := dayTime
+		if seq > 0 {
+			seqTime = fmt.Sprintf("%s_%d", dayTime, seq)
+		}
+		path := file_util.FullPathGen(w.conf.RootDir, day, seqTime, w.conf.Prefix, w.conf.Suffix)
+		if !fileExist(path) {
+			return path, nil
+		}
+		seq++
+	}
+}
+
+// remove the oldest files, if there are more than BackupCount old files
+func (w *RotatingWriter) backupClean() {
+	if w.conf.BackupCount <= 0 {
+		return
+	}
+
+	// files in format "rootDir/day/prefix_dayTime[_seq].suffix"
+	pattern := file_util.FullPathGen(globEscape(w.conf.RootDir), "*", "[0-9]*",
+		globEscape(w.conf.Prefix), globEscape(w.conf.Suffix))
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+
+	// current file is not a backup, and files of other writers in the same
+	// directory, e.g., "prefix_2_dayTime.suffix", are not matched
+	backups := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if _, _, ok := w.backupSeqGet(path); ok && path != w.path {
+			backups = append(backups, path)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return w.backupLess(backups[i], backups[j])
+	})
+
+	for i := 0; i < len(backups)-w.conf.BackupCount; i++ {
+		os.Remove(backups[i])
+		os.Remove(IndexPathGen(backups[i]))
+
+		// remove directory of the day, if it is empty
+		os.Remove(filepath.Dir(backups[i]))
+	}
+}
+
+/*
+backupSeqGet - get time and sequence from path in format "rootDir/day/prefix_dayTime[_seq].suffix"
+
+Params:
+    - path: path of file
+
+Returns:
+    (dayTime, seq, true), if path is in the format, seq is 0 if there is no sequence
+    ("", 0, false), if not, e.g., file of other writer
+*/
+func (w *RotatingWriter) backupSeqGet(path string) (string, int, bool) {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, w.conf.Prefix+"_") || !strings.HasSuffix(name, "."+w.conf.Suffix) {
+		return "", 0, false
+	}
+	name = strings.TrimPrefix(name, w.conf.Prefix+"_")
+	name = strings.TrimSuffix(name, "."+w.conf.Suffix)
+
+	// dayTime in format "20060102150405"
+	if len(name) < len(dayTimeFormat) || !isDigits(name[:len(dayTimeFormat)]) {
+		return "", 0, false
+	}
+	dayTime := name[:len(dayTimeFormat)]
+	name = name[len(dayTimeFormat):]
+
+	// no sequence for the first file in one second
+	if name == "" {
+		return dayTime, 0, true
+	}
+	if name[0] != '_' || !isDigits(name[1:]) {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(name[1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return dayTime, seq, true
+}
+
+// check whether s is not empty, and only contains digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// escape meta characters of filepath.Match() in s
+func globEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// check whether backup of path1 is older than path2, by time and sequence
+func (w *RotatingWriter) backupLess(path1, path2 string) bool {
+	time1, seq1, _ := w.backupSeqGet(path1)
+	time2, seq2, _ := w.backupSeqGet(path2)
+	if time1 != time2 {
+		return time1 < time2
+	}
+	return seq1 < seq2
+}
+
+// generate time for the next rotation by time
+func rotateTimeGen(when string, now time.Time) time.Time {
+	year, month, day := now.Date()
+
+	switch when {
+	case ROTATE_HOURLY:
+		return time.Date(year, month, day, now.Hour()+1, 0, 0, 0, now.Location())
+	case ROTATE_DAILY:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// check whether file exists
+func fileExist(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
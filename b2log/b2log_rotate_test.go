@@ -0,0 +1,409 @@
+/* b2log_rotate_test.go - test for b2log_rotate.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package b2log
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// count records in b2log file
+func recordCount(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	r := NewReader(file)
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// test of RotatingWriter, rotate by size
+func Test_RotatingWriter_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	payload := make([]byte, 100)
+	recordSize := HEADER_SIZE + len(payload)
+	conf := RotatingConfig{
+		RootDir:      dir,
+		Prefix:       "test",
+		MaxSize:      int64(recordSize * 10),
+		BackupCount:  2,
+		SyncPolicy:   SYNC_EVERY_RECORD,
+		IndexRecords: 5,
+	}
+	w, err := NewRotatingWriter(conf)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+
+	// 4 files are created, 3 of them are kept
+	paths := make(map[string]bool)
+	for i := 0; i < 35; i++ {
+		if _, err := w.Write(payload); err != nil {
+			t.Fatalf("w.Write():%s", err.Error())
+		}
+		paths[w.Path()] = true
+	}
+	last := w.Path()
+	if err := w.Close(); err != nil {
+		t.Fatalf("w.Close():%s", err.Error())
+	}
+	if _, err := w.Write(payload); err != ErrWriterClosed {
+		t.Errorf("w.Write() should return ErrWriterClosed, now it's %v", err)
+	}
+
+	if len(paths) != 4 {
+		t.Errorf("len(paths) should be 4, now it's %d", len(paths))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "test_*.b2log"))
+	if len(files) != 3 {
+		t.Fatalf("len(files) should be 3, now it's %d", len(files))
+	}
+
+	// records are not split across files
+	count, err := recordCount(files[0])
+	if err != nil || count != 10 {
+		t.Errorf("recordCount(%s) should be 10, now it's %d, %v", files[0], count, err)
+	}
+	count, err = recordCount(last)
+	if err != nil || count != 5 {
+		t.Errorf("recordCount(%s) should be 5, now it's %d, %v", last, count, err)
+	}
+
+	// index for each file
+	entries, err := IndexLoad(IndexPathGen(last))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("IndexLoad(%s) should have 1 entry, now %v, %v", last, entries, err)
+	}
+	indexes, _ := filepath.Glob(filepath.Join(dir, "*", "test_*.b2log.idx"))
+	if len(indexes) != 3 {
+		t.Errorf("len(indexes) should be 3, now it's %d", len(indexes))
+	}
+}
+
+// test of RotatingWriter, rotate by time
+func Test_RotatingWriter_2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	conf := RotatingConfig{
+		RootDir:      dir,
+		Prefix:       "test",
+		When:         ROTATE_HOURLY,
+		SyncPolicy:   SYNC_INTERVAL,
+		SyncInterval: 10 * time.Millisecond,
+	}
+	w, err := NewRotatingWriter(conf)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+	defer w.Close()
+
+	now := time.Now()
+	if w.rotateCheck(now, 0) {
+		t.Errorf("w.rotateCheck() should be false for now")
+	}
+	if !w.rotateCheck(now.Add(time.Hour), 0) {
+		t.Errorf("w.rotateCheck() should be true for one hour later")
+	}
+
+	// rotate in the same second
+	path := w.Path()
+	w.Write([]byte("this is a test"))
+	w.lock.Lock()
+	err = w.rotate(now)
+	w.lock.Unlock()
+	if err != nil {
+		t.Fatalf("w.rotate():%s", err.Error())
+	}
+	if w.Path() == path {
+		t.Errorf("w.Path() should be changed after rotation")
+	}
+	if count, _ := recordCount(path); count != 1 {
+		t.Errorf("recordCount(%s) should be 1, now it's %d", path, count)
+	}
+}
+
+// test of rotateTimeGen()
+func Test_RotateTimeGen(t *testing.T) {
+	now := time.Date(2016, 10, 18, 23, 30, 10, 0, time.Local)
+
+	next := rotateTimeGen(ROTATE_HOURLY, now)
+	if !next.Equal(time.Date(2016, 10, 19, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("rotateTimeGen(ROTATE_HOURLY) = %s", next)
+	}
+
+	next = rotateTimeGen(ROTATE_DAILY, now)
+	if !next.Equal(time.Date(2016, 10, 19, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("rotateTimeGen(ROTATE_DAILY) = %s", next)
+	}
+}
+
+// test of RotatingConfig.check()
+func Test_RotatingConfig_Check(t *testing.T) {
+	confs := []RotatingConfig{
+		{Prefix: "test"},
+		{RootDir: "./log"},
+		{RootDir: "./log", Prefix: "test", When: "M"},
+		{RootDir: "./log", Prefix: "test", SyncPolicy: SYNC_INTERVAL},
+		{RootDir: "./log", Prefix: "test", Version: 3},
+	}
+
+	for i, conf := range confs {
+		if err := conf.check(); err == nil {
+			t.Errorf("conf %d should be invalid", i)
+		}
+	}
+}
+
+// test of RotatingWriter, new file fails to open in rotation
+func Test_RotatingWriter_3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewRotatingWriter(RotatingConfig{RootDir: dir, Prefix: "test"})
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+
+	// directory of the day can't be created
+	now := time.Date(2099, 1, 1, 0, 0, 0, 0, time.Local)
+	if err := ioutil.WriteFile(filepath.Join(dir, "20990101"), nil, 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile():%s", err.Error())
+	}
+
+	path := w.Path()
+	w.lock.Lock()
+	err = w.rotate(now)
+	w.lock.Unlock()
+	if err == nil {
+		t.Fatalf("w.rotate() should fail")
+	}
+
+	// current file is still used
+	if w.Path() != path {
+		t.Errorf("w.Path() should not be changed")
+	}
+	if _, err := w.Write([]byte("this is a test")); err != nil {
+		t.Errorf("w.Write():%s", err.Error())
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("w.Close():%s", err.Error())
+	}
+	if count, _ := recordCount(path); count != 1 {
+		t.Errorf("recordCount(%s) should be 1, now it's %d", path, count)
+	}
+}
+
+// test of RotatingWriter, keep writing to current file after rotation fails
+func Test_RotatingWriter_7(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	payload := []byte("this is a test")
+	size := int64(HEADER_SIZE + len(payload))
+	w, err := NewRotatingWriter(RotatingConfig{RootDir: dir, Prefix: "test", MaxSize: 2 * size})
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+	defer w.Close()
+
+	// directory of the day can't be created
+	path := w.Path()
+	dayDir := filepath.Dir(path)
+	if err := os.Rename(dayDir, dayDir+".bak"); err != nil {
+		t.Fatalf("os.Rename():%s", err.Error())
+	}
+	if err := ioutil.WriteFile(dayDir, nil, 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile():%s", err.Error())
+	}
+
+	// rotation fails for the 3rd record, and is not retried for the next 2 records
+	for i := 0; i < 4; i++ {
+		n, err := w.Write(payload)
+		if n != len(payload) {
+			t.Errorf("n should be %d, now it's %d", len(payload), n)
+		}
+		if _, ok := err.(*RotateError); ok != (i == 2) {
+			t.Errorf("w.Write() %d: unexpected err %v", i, err)
+		}
+	}
+	if w.Path() != path {
+		t.Errorf("w.Path() should not be changed")
+	}
+
+	// rotation is retried at the next threshold
+	if err := os.Remove(dayDir); err != nil {
+		t.Fatalf("os.Remove():%s", err.Error())
+	}
+	if err := os.Rename(dayDir+".bak", dayDir); err != nil {
+		t.Fatalf("os.Rename():%s", err.Error())
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Errorf("w.Write():%s", err.Error())
+	}
+	if w.Path() == path {
+		t.Errorf("w.Path() should be changed")
+	}
+	if count, _ := recordCount(path); count != 4 {
+		t.Errorf("recordCount(%s) should be 4, now it's %d", path, count)
+	}
+}
+
+// test of RotatingWriter, more than 10 rotations in one second
+func Test_RotatingWriter_4(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewRotatingWriter(RotatingConfig{RootDir: dir, Prefix: "test", BackupCount: 2})
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+	defer w.Close()
+
+	now := time.Now()
+	paths := []string{w.Path()}
+	for i := 0; i < 12; i++ {
+		w.lock.Lock()
+		err = w.rotate(now)
+		w.lock.Unlock()
+		if err != nil {
+			t.Fatalf("w.rotate():%s", err.Error())
+		}
+		paths = append(paths, w.Path())
+	}
+
+	// the latest backups are kept
+	for i, path := range paths {
+		kept := i >= len(paths)-3
+		if fileExist(path) != kept {
+			t.Errorf("%s: exist should be %v", path, kept)
+		}
+	}
+}
+
+// test of RotatingWriter, files of other writers in the same directory are kept
+func Test_RotatingWriter_6(t *testing.T) {
+	// with glob meta characters in prefix, or not
+	for _, prefix := range []string{"test", "test[1]"} {
+		rotatingWriterPrefixTest(t, prefix)
+	}
+}
+
+func rotatingWriterPrefixTest(t *testing.T, prefix string) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// prefix of other writer begins with "prefix_<digit>"
+	other, err := NewRotatingWriter(RotatingConfig{RootDir: dir, Prefix: prefix + "_2", BackupCount: 1})
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+	defer other.Close()
+
+	w, err := NewRotatingWriter(RotatingConfig{RootDir: dir, Prefix: prefix, BackupCount: 1})
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+	defer w.Close()
+
+	now := time.Now()
+	paths := []string{w.Path()}
+	for i := 0; i < 3; i++ {
+		w.lock.Lock()
+		err = w.rotate(now)
+		w.lock.Unlock()
+		if err != nil {
+			t.Fatalf("w.rotate():%s", err.Error())
+		}
+		paths = append(paths, w.Path())
+	}
+
+	for i, path := range paths {
+		kept := i >= len(paths)-2
+		if fileExist(path) != kept {
+			t.Errorf("%s: exist should be %v", path, kept)
+		}
+	}
+	if !fileExist(other.Path()) {
+		t.Errorf("%s: file of other writer should not be removed", other.Path())
+	}
+}
+
+// test of RotatingWriter, sync fails for SYNC_EVERY_RECORD
+func Test_RotatingWriter_5(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2log_rotate")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	conf := RotatingConfig{
+		RootDir:      dir,
+		Prefix:       "test",
+		SyncPolicy:   SYNC_EVERY_RECORD,
+		IndexRecords: 1000,
+	}
+	w, err := NewRotatingWriter(conf)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter():%s", err.Error())
+	}
+	defer w.Close()
+
+	payload := []byte("this is a test")
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("w.Write():%s", err.Error())
+	}
+
+	// record is written, but index file fails to sync
+	w.indexFile.Close()
+	n, err := w.Write(payload)
+	if err == nil || n != len(payload) {
+		t.Errorf("w.Write() should return (%d, error), now it's (%d, %v)", len(payload), n, err)
+	}
+	if count, _ := recordCount(w.Path()); count != 2 {
+		t.Errorf("recordCount() should be 2, now it's %d", count)
+	}
+}
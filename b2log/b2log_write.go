@@ -10,8 +10,6 @@ DESCRIPTION
 package b2log
 
 import (
-	"bytes"
-    "encoding/binary"
     "fmt"
 	"time"
 )
@@ -34,18 +32,17 @@ Params:
 	- payloadLen: length of payload
 */
 func HeaderWrite(buffer []byte, payloadLen int) error {
+	if len(buffer) < HEADER_SIZE {
+		return fmt.Errorf("buffer too small:%d", len(buffer))
+	}
+
 	// prepare header
-	header := Header{MAGIC_NUMBER, HEADER_VERSION, uint32(payloadLen), 0, 0}
+	header := Header{MagicNumber: MAGIC_NUMBER, Version: HEADER_VERSION,
+		UnCompressLen: uint32(payloadLen)}
 	header.TimeStamp = timestampGen()
 
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.LittleEndian, header)
-	if err != nil {
-		return fmt.Errorf("binary.Write():%s", err.Error())
-	}
-	
 	// write header to buffer
-	copy(buffer, buff.Bytes())
+	headerEncode(buffer, &header)
 	
 	return nil
 }
@@ -0,0 +1,194 @@
+/* b2log_writer.go - write b2log records to io.Writer  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Writer frames each payload with a b2log Header, and writes it to an io.Writer.
+
+Header and payload of one record are written by a single call to the
+underlying Write(), so records from different writers will not interleave
+in a file opened with O_APPEND.
+
+Header of version 1 is written by default. Header of version 2, with checksum
+and record type, could be set by SetVersion().
+
+If index is set, entries of sidecar index are added for records written.
+If writing index fails, the record is written already, and *IndexError is
+returned with len(payload); the record could still be found by scanning.
+
+If compress is set, payload is compressed, unless the compressed data
+is not smaller than the payload.
+
+Usage:
+    w := b2log.NewWriter(file)
+    w.SetVersion(b2log.HEADER_VERSION_V2)  // optional
+    w.SetCompress(b2log.COMPRESS_ZLIB)      // optional
+
+    _, err := w.Write([]byte("this is a test"))
+    if err != nil {
+        ...
+    }
+*/
+package b2log
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrRecordTooLarge = errors.New("b2log: record too large")
+	ErrHeaderVersion  = errors.New("b2log: header version is not support")
+)
+
+// IndexError is returned by Writer, if record is written but writing index fails
+type IndexError struct {
+	Err error
+}
+
+func (e *IndexError) Error() string {
+	return "b2log: write index:" + e.Err.Error()
+}
+
+// Writer writes b2log records to an io.Writer
+type Writer struct {
+	wr  io.Writer // underlying writer
+	buf []byte    // buffer for header and payload
+
+	version      uint32 // version of header
+	compressType uint32 // compress type of records
+
+	offset int64         // offset in the stream of the next record
+	index  *indexBuilder // builder for sidecar index, optional
+}
+
+// NewWriter returns a new Writer
+func NewWriter(wr io.Writer) *Writer {
+	w := new(Writer)
+	w.wr = wr
+	w.version = HEADER_VERSION
+	return w
+}
+
+// SetVersion sets version of header for records written later
+// e.g., HEADER_VERSION_V1, HEADER_VERSION_V2
+func (w *Writer) SetVersion(version uint32) error {
+	if headerSizeGet(version) == 0 {
+		return ErrHeaderVersion
+	}
+
+	w.version = version
+	return nil
+}
+
+// SetCompress sets compress type for records written later
+// e.g., COMPRESS_NONE, COMPRESS_ZLIB
+func (w *Writer) SetCompress(compressType uint32) error {
+	if err := compressTypeCheck(compressType); err != nil {
+		return err
+	}
+
+	w.compressType = compressType
+	return nil
+}
+
+// SetIndex sets writer for sidecar index
+// Index entry is added for the first record, and then every recordInterval
+// records or every timeInterval, whichever comes first. Zero interval is
+// not used.
+func (w *Writer) SetIndex(index io.Writer, recordInterval int, timeInterval time.Duration) {
+	w.index = newIndexBuilder(index, recordInterval, timeInterval)
+}
+
+// SetOffset sets offset in the stream of the next record
+// It should be called before the first write, when appending to an existing file.
+func (w *Writer) SetOffset(offset int64) {
+	w.offset = offset
+}
+
+// Write writes payload as one record, with current time as timestamp
+// It returns len(payload) if succeed.
+func (w *Writer) Write(payload []byte) (int, error) {
+	return w.WriteWithTime(payload, timestampGen())
+}
+
+// WriteWithTime writes payload as one record, with given timestamp
+// It returns len(payload) if succeed.
+func (w *Writer) WriteWithTime(payload []byte, timestamp uint64) (int, error) {
+	return w.WriteRecord(payload, timestamp, 0)
+}
+
+// WriteRecord writes payload as one record, with given timestamp and record type
+// Record type is only kept in header of version 2.
+// It returns len(payload) if succeed, or (len(payload), *IndexError) if only
+// writing index fails.
+func (w *Writer) WriteRecord(payload []byte, timestamp uint64, recordType uint32) (int, error) {
+	if len(payload) > MAX_RECORD_LEN {
+		return 0, ErrRecordTooLarge
+	}
+
+	header := Header{MagicNumber: MAGIC_NUMBER, Version: w.version,
+		UnCompressLen: uint32(len(payload)), TimeStamp: timestamp}
+	if w.version == HEADER_VERSION_V2 {
+		header.RecordType = recordType
+	}
+
+	// try to compress the payload
+	data := payload
+	if w.compressType != COMPRESS_NONE && len(payload) > 0 {
+		compressed, err := recordCompress(w.compressType, payload)
+		if err != nil {
+			return 0, err
+		}
+
+		// keep it uncompressed, if it is not smaller
+		if len(compressed) < len(payload) {
+			data = compressed
+			header.Version = versionMake(w.version, w.compressType)
+			header.CompressLen = uint32(len(compressed))
+		}
+	}
+
+	if w.version == HEADER_VERSION_V2 {
+		header.Checksum = recordChecksum(data)
+	}
+
+	// prepare header and payload in buffer
+	headerSize := headerSizeGet(w.version)
+	size := headerSize + len(data)
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	buf := w.buf[:size]
+	headerEncode(buf, &header)
+	copy(buf[headerSize:], data)
+
+	// write to underlying writer
+	offset := w.offset
+	n, err := w.wr.Write(buf)
+	w.offset += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	if n != size {
+		return 0, io.ErrShortWrite
+	}
+
+	// add entry to index
+	if w.index != nil {
+		if err := w.index.add(timestamp, offset); err != nil {
+			return len(payload), &IndexError{Err: err}
+		}
+	}
+
+	return len(payload), nil
+}
+
+// Offset returns offset in the stream of the next record
+func (w *Writer) Offset() int64 {
+	return w.offset
+}
@@ -0,0 +1,237 @@
+/* b2log_writer_test.go - test for b2log_writer.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package b2log
+
+import (
+	"bytes"
+	"testing"
+)
+
+// test of Writer
+func Test_Writer(t *testing.T) {
+	var buff bytes.Buffer
+	payloads := []string{"this is a test", "", "another test"}
+
+	// write records
+	w := NewWriter(&buff)
+	for i, payload := range payloads {
+		n, err := w.WriteWithTime([]byte(payload), uint64(i))
+		if err != nil {
+			t.Fatalf("w.WriteWithTime():%s", err.Error())
+		}
+		if n != len(payload) {
+			t.Errorf("n should be %d, now it's %d", len(payload), n)
+		}
+	}
+	if w.Offset() != int64(buff.Len()) {
+		t.Errorf("w.Offset() should be %d, now it's %d", buff.Len(), w.Offset())
+	}
+
+	// too large record
+	if _, err := w.Write(make([]byte, MAX_RECORD_LEN+1)); err != ErrRecordTooLarge {
+		t.Errorf("w.Write() should return ErrRecordTooLarge, now it's %v", err)
+	}
+
+	// read records back
+	r := NewReader(&buff)
+	for i, payload := range payloads {
+		record, err := r.Read()
+		if err != nil {
+			t.Fatalf("r.Read():%s", err.Error())
+		}
+		if string(record) != payload {
+			t.Errorf("record should be %s, now it's %s", payload, record)
+		}
+		if r.Header().TimeStamp != uint64(i) {
+			t.Errorf("TimeStamp should be %d, now it's %d", i, r.Header().TimeStamp)
+		}
+	}
+}
+
+// test of Writer, with compress
+func Test_Writer_Compress(t *testing.T) {
+	var buff bytes.Buffer
+	payload := bytes.Repeat([]byte("this is a test "), 100)
+
+	w := NewWriter(&buff)
+	if err := w.SetCompress(COMPRESS_ZLIB + 100); err != ErrCompressType {
+		t.Errorf("w.SetCompress() should return ErrCompressType, now it's %v", err)
+	}
+	if err := w.SetCompress(COMPRESS_ZLIB); err != nil {
+		t.Fatalf("w.SetCompress():%s", err.Error())
+	}
+
+	// compressed record, and short record not compressed
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("w.Write():%s", err.Error())
+	}
+	if _, err := w.Write([]byte("a")); err != nil {
+		t.Fatalf("w.Write():%s", err.Error())
+	}
+	if buff.Len() >= len(payload) {
+		t.Errorf("buff.Len() should be less than %d, now it's %d", len(payload), buff.Len())
+	}
+	data := append([]byte(nil), buff.Bytes()...)
+
+	// read by Reader
+	r := NewReader(&buff)
+	record, err := r.Read()
+	if err != nil {
+		t.Fatalf("r.Read():%s", err.Error())
+	}
+	if !bytes.Equal(record, payload) {
+		t.Errorf("record is not the same as payload")
+	}
+	header := r.Header()
+	if header.CompressType() != COMPRESS_ZLIB || header.HeaderVersion() != HEADER_VERSION {
+		t.Errorf("header.Version should be 0x%x, now it's 0x%x",
+			versionMake(HEADER_VERSION, COMPRESS_ZLIB), header.Version)
+	}
+
+	record, err = r.Read()
+	if err != nil {
+		t.Fatalf("r.Read():%s", err.Error())
+	}
+	if string(record) != "a" || r.Header().CompressLen != 0 {
+		t.Errorf("record should be uncompressed 'a', now it's %s", record)
+	}
+
+	// read by BuffParse
+	records, data := BuffParse(data)
+	if len(records) != 2 || len(data) != 0 {
+		t.Fatalf("len(records) should be 2, now it's %d", len(records))
+	}
+	if !bytes.Equal(records[0], payload) {
+		t.Errorf("records[0] is not the same as payload")
+	}
+}
+
+// test of Reader, with broken compressed record
+func Test_Reader_Decompress(t *testing.T) {
+	var buff bytes.Buffer
+	payload := bytes.Repeat([]byte("this is a test "), 100)
+
+	w := NewWriter(&buff)
+	w.SetCompress(COMPRESS_ZLIB)
+	w.Write(payload)
+	w.Write(payload)
+
+	// break the first record
+	data := buff.Bytes()
+	data[HEADER_SIZE+4] ^= 0xff
+
+	r := NewReader(bytes.NewReader(data))
+	if _, err := r.Read(); err == nil {
+		t.Errorf("r.Read() should fail for broken record")
+	}
+	record, err := r.Read()
+	if err != nil {
+		t.Fatalf("r.Read():%s", err.Error())
+	}
+	if !bytes.Equal(record, payload) {
+		t.Errorf("record is not the same as payload")
+	}
+}
+
+// test of Writer, with header of version 2
+func Test_Writer_V2(t *testing.T) {
+	var buff bytes.Buffer
+
+	w := NewWriter(&buff)
+	if err := w.SetVersion(3); err != ErrHeaderVersion {
+		t.Errorf("w.SetVersion() should return ErrHeaderVersion, now it's %v", err)
+	}
+
+	// version 1, version 2, and version 2 with compress
+	w.WriteRecord([]byte("record v1"), 1, 10)
+	w.SetVersion(HEADER_VERSION_V2)
+	w.WriteRecord([]byte("record v2"), 2, 20)
+	w.SetCompress(COMPRESS_ZLIB)
+	payload := bytes.Repeat([]byte("record v2 compressed "), 100)
+	w.WriteRecord(payload, 3, 30)
+
+	if buff.Len() >= 2*HEADER_SIZE_V2+len(payload) {
+		t.Errorf("buff.Len() should be less than %d, now it's %d",
+			2*HEADER_SIZE_V2+len(payload), buff.Len())
+	}
+	data := append([]byte(nil), buff.Bytes()...)
+
+	// read by Reader
+	expects := []struct {
+		payload    []byte
+		version    uint32
+		recordType uint32
+	}{
+		{[]byte("record v1"), HEADER_VERSION_V1, 0},
+		{[]byte("record v2"), HEADER_VERSION_V2, 20},
+		{payload, HEADER_VERSION_V2, 30},
+	}
+	r := NewReader(&buff)
+	for i, expect := range expects {
+		record, err := r.Read()
+		if err != nil {
+			t.Fatalf("r.Read():%s", err.Error())
+		}
+		header := r.Header()
+		if !bytes.Equal(record, expect.payload) {
+			t.Errorf("record %d is not correct", i)
+		}
+		if header.HeaderVersion() != expect.version || header.RecordType != expect.recordType {
+			t.Errorf("record %d: version %d, type %d", i, header.HeaderVersion(), header.RecordType)
+		}
+		if header.TimeStamp != uint64(i+1) {
+			t.Errorf("record %d: TimeStamp %d", i, header.TimeStamp)
+		}
+	}
+
+	// read by BuffParse
+	records, data := BuffParse(data)
+	if len(records) != 3 || len(data) != 0 {
+		t.Fatalf("len(records) should be 3, now it's %d", len(records))
+	}
+}
+
+// test of checksum of header version 2
+func Test_Writer_Checksum(t *testing.T) {
+	var buff bytes.Buffer
+
+	w := NewWriter(&buff)
+	w.SetVersion(HEADER_VERSION_V2)
+	w.Write([]byte("this is a test"))
+	w.Write([]byte("this is another test"))
+
+	// break the payload of first record
+	data := buff.Bytes()
+	data[HEADER_SIZE_V2] ^= 0xff
+	size := HEADER_SIZE_V2 + len("this is a test")
+
+	// read by Reader
+	var skipSize int64
+	r := NewReader(bytes.NewReader(data))
+	r.SetSkipHandler(func(offset int64, size int64) {
+		skipSize += size
+	})
+	record, err := r.Read()
+	if err != nil {
+		t.Fatalf("r.Read():%s", err.Error())
+	}
+	if string(record) != "this is another test" {
+		t.Errorf("record should be the second one, now it's %s", record)
+	}
+	if skipSize != int64(size) || r.RecordOffset() != int64(size) {
+		t.Errorf("skipSize should be %d, now it's %d", size, skipSize)
+	}
+
+	// read by BuffParse
+	records, _ := BuffParse(data)
+	if len(records) != 1 || string(records[0]) != "this is another test" {
+		t.Errorf("len(records) should be 1, now it's %d", len(records))
+	}
+}
@@ -0,0 +1,332 @@
+/* convert.go - convert, concatenate and split b2log files  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Records are read and written again, so corrupt data in input files is dropped.
+Timestamp and record type of records are kept.
+
+If -version is not set, version of input files is kept; for input files of
+different versions, the higher one is used, so that checksum and record type
+in version 2 are not dropped.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/b2log"
+)
+
+// options for writing records
+type writerOptions struct {
+	compress *string
+	version  *uint
+}
+
+// add options for writing records to flag set
+func writerFlagsAdd(flags *flag.FlagSet) writerOptions {
+	var opts writerOptions
+	opts.compress = flags.String("compress", "none", "compress type of output records, none or zlib")
+	opts.version = flags.Uint("version", 0, "version of header for output records, 1 or 2; version of input by default")
+	return opts
+}
+
+/*
+fileVersionGet - get header version of records in b2log file
+
+Params:
+    - path: path of b2log file
+
+Returns:
+    (version of the first record, error); 0 if there is no record
+*/
+func fileVersionGet(path string) (uint32, error) {
+	src, closer, err := recordSourceOpen(path, time.Time{}, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+
+	for {
+		_, err := src.Read()
+		switch err {
+		case nil, b2log.ErrCompressed, b2log.ErrDecompress:
+			header := src.Header()
+			return header.HeaderVersion(), nil
+		case io.EOF, io.ErrUnexpectedEOF:
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+}
+
+/*
+versionResolve - set version of output to that of input files, if not set
+
+Params:
+    - inputs: paths of input files
+
+Returns:
+    error
+*/
+func (opts writerOptions) versionResolve(inputs []string) error {
+	if *opts.version != 0 {
+		return nil
+	}
+
+	version := uint32(b2log.HEADER_VERSION)
+	found := false
+	for _, path := range inputs {
+		fileVersion, err := fileVersionGet(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		if fileVersion == 0 {
+			continue
+		}
+		if !found || fileVersion > version {
+			version = fileVersion
+		}
+		found = true
+	}
+
+	*opts.version = uint(version)
+	return nil
+}
+
+// create b2log writer with options
+func (opts writerOptions) writerNew(file *os.File) (*b2log.Writer, error) {
+	w := b2log.NewWriter(file)
+
+	if err := w.SetVersion(uint32(*opts.version)); err != nil {
+		return nil, fmt.Errorf("invalid -version:%d", *opts.version)
+	}
+
+	switch *opts.compress {
+	case "none":
+		w.SetCompress(b2log.COMPRESS_NONE)
+	case "zlib":
+		w.SetCompress(b2log.COMPRESS_ZLIB)
+	default:
+		return nil, fmt.Errorf("invalid -compress:%s", *opts.compress)
+	}
+
+	return w, nil
+}
+
+/*
+recordsCopy - copy records from b2log file to writer
+
+Params:
+    - w: writer for output
+    - path: path of input file
+
+Returns:
+    (number of records copied, error)
+*/
+func recordsCopy(w *b2log.Writer, path string) (int, error) {
+	count := 0
+	err := recordsForEach(path, time.Time{}, time.Time{}, func(record b2log.Record, src recordSource) error {
+		header := src.Header()
+		if _, err := w.WriteRecord(record, header.TimeStamp, header.RecordType); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+/*
+concatenate - concatenate records from input files to output file
+
+Params:
+    - output: path of output file
+    - inputs: paths of input files
+    - opts: options for writing records
+
+Returns:
+    error
+*/
+func concatenate(output string, inputs []string, opts writerOptions) error {
+	if err := opts.versionResolve(inputs); err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := opts.writerNew(file)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range inputs {
+		count, err := recordsCopy(w, path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d records\n", path, count)
+	}
+
+	return file.Sync()
+}
+
+// run sub command "convert"
+func convertRun(args []string) error {
+	flags := flagSetNew("convert")
+	output := flags.String("o", "", "path of output file")
+	opts := writerFlagsAdd(flags)
+	flags.Parse(args)
+
+	if *output == "" {
+		return fmt.Errorf("no output file")
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("there should be one input file")
+	}
+
+	return concatenate(*output, flags.Args(), opts)
+}
+
+// run sub command "cat"
+func catRun(args []string) error {
+	flags := flagSetNew("cat")
+	output := flags.String("o", "", "path of output file")
+	opts := writerFlagsAdd(flags)
+	flags.Parse(args)
+
+	if *output == "" {
+		return fmt.Errorf("no output file")
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no input file")
+	}
+
+	return concatenate(*output, flags.Args(), opts)
+}
+
+// writer for split files
+type splitWriter struct {
+	prefix     string // prefix of output files
+	maxRecords int    // max records in one file; 0 for no limit
+	maxSize    int64  // max size of one file; 0 for no limit
+	opts       writerOptions
+
+	file    *os.File
+	writer  *b2log.Writer
+	records int // records in current file
+	files   int // number of files created
+}
+
+// check whether a new file is needed
+func (sw *splitWriter) needNew() bool {
+	if sw.file == nil {
+		return true
+	}
+	if sw.records == 0 {
+		return false
+	}
+	if sw.maxRecords > 0 && sw.records >= sw.maxRecords {
+		return true
+	}
+	if sw.maxSize > 0 && sw.writer.Offset() >= sw.maxSize {
+		return true
+	}
+	return false
+}
+
+// write one record, and create new file if needed
+func (sw *splitWriter) write(record b2log.Record, header b2log.Header) error {
+	if sw.needNew() {
+		if err := sw.close(); err != nil {
+			return err
+		}
+
+		path := fmt.Sprintf("%s.%03d", sw.prefix, sw.files)
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		writer, err := sw.opts.writerNew(file)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		sw.file = file
+		sw.writer = writer
+		sw.records = 0
+		sw.files++
+	}
+
+	if _, err := sw.writer.WriteRecord(record, header.TimeStamp, header.RecordType); err != nil {
+		return err
+	}
+	sw.records++
+	return nil
+}
+
+// close current file
+func (sw *splitWriter) close() error {
+	if sw.file == nil {
+		return nil
+	}
+
+	err := sw.file.Close()
+	sw.file = nil
+	return err
+}
+
+// run sub command "split"
+func splitRun(args []string) error {
+	flags := flagSetNew("split")
+	prefix := flags.String("o", "", "prefix of output files, which are named as prefix.000, prefix.001, ...")
+	maxRecords := flags.Int("records", 0, "max records in one output file")
+	maxSize := flags.Int64("size", 0, "max size of one output file, in bytes")
+	opts := writerFlagsAdd(flags)
+	flags.Parse(args)
+
+	if *prefix == "" {
+		return fmt.Errorf("no output prefix")
+	}
+	if *maxRecords <= 0 && *maxSize <= 0 {
+		return fmt.Errorf("-records or -size should be set")
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("there should be one input file")
+	}
+
+	if err := opts.versionResolve(flags.Args()); err != nil {
+		return err
+	}
+
+	sw := &splitWriter{prefix: *prefix, maxRecords: *maxRecords, maxSize: *maxSize, opts: opts}
+	err := recordsForEach(flags.Arg(0), time.Time{}, time.Time{}, func(record b2log.Record, src recordSource) error {
+		return sw.write(record, src.Header())
+	})
+	if closeErr := sw.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d files created\n", sw.files)
+	return nil
+}
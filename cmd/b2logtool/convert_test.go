@@ -0,0 +1,177 @@
+/* convert_test.go - test for convert.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/b2log"
+)
+
+// check records in file, which are created by testFileCreate()
+func testFileCheck(t *testing.T, path string, version uint32, first int, num int) {
+	records := testDumpJson(t, []string{path}, time.Time{}, time.Time{})
+	if len(records) != num {
+		t.Errorf("%s: len(records) should be %d, now it's %d", path, num, len(records))
+		return
+	}
+
+	for i, record := range records {
+		n := first + i
+		recordType := uint32(n)
+		if version == b2log.HEADER_VERSION_V1 {
+			recordType = 0
+		}
+		if string(record.Data) != fmt.Sprintf("record %d", n) || record.Version != version ||
+			record.RecordType != recordType || record.TimeStamp != uint64(testTimeStamp+n*1000) {
+			t.Errorf("%s: record %d = %+v", path, i, record)
+		}
+	}
+}
+
+// test of convertRun()
+func Test_Convert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2logtool")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	v1 := testFileCreate(t, dir, "v1.b2log", b2log.HEADER_VERSION_V1, 5)
+	v2 := testFileCreate(t, dir, "v2.b2log", b2log.HEADER_VERSION_V2, 5)
+	output := filepath.Join(dir, "output.b2log")
+
+	cases := []struct {
+		args    []string
+		version uint32 // version of output
+	}{
+		// version of input is kept by default
+		{[]string{"-o", output, v1}, b2log.HEADER_VERSION_V1},
+		{[]string{"-o", output, v2}, b2log.HEADER_VERSION_V2},
+		{[]string{"-compress", "zlib", "-o", output, v2}, b2log.HEADER_VERSION_V2},
+		// v2 => v1, record type is dropped
+		{[]string{"-version", "1", "-o", output, v2}, b2log.HEADER_VERSION_V1},
+	}
+
+	for i, c := range cases {
+		if err := convertRun(c.args); err != nil {
+			t.Errorf("case %d: convertRun():%s", i, err.Error())
+			continue
+		}
+		testFileCheck(t, output, c.version, 0, 5)
+	}
+
+	// v1 => v2, record type is 0
+	if err := convertRun([]string{"-version", "2", "-o", output, v1}); err != nil {
+		t.Fatalf("convertRun():%s", err.Error())
+	}
+	records := testDumpJson(t, []string{output}, time.Time{}, time.Time{})
+	if len(records) != 5 || records[4].Version != b2log.HEADER_VERSION_V2 ||
+		records[4].RecordType != 0 || string(records[4].Data) != "record 4" {
+		t.Errorf("records = %+v", records)
+	}
+
+	// invalid args
+	invalidArgs := [][]string{
+		{v1},
+		{"-o", output},
+		{"-o", output, v1, v2},
+		{"-version", "3", "-o", output, v1},
+		{"-compress", "gzip", "-o", output, v1},
+	}
+	for i, args := range invalidArgs {
+		if err := convertRun(args); err == nil {
+			t.Errorf("invalid args %d: convertRun() should fail", i)
+		}
+	}
+}
+
+// test of catRun()
+func Test_Cat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2logtool")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	v1 := testFileCreate(t, dir, "v1.b2log", b2log.HEADER_VERSION_V1, 3)
+	v2 := testFileCreate(t, dir, "v2.b2log", b2log.HEADER_VERSION_V2, 3)
+	output := filepath.Join(dir, "output.b2log")
+
+	// the higher version of inputs is used
+	if err := catRun([]string{"-o", output, v2, v2}); err != nil {
+		t.Fatalf("catRun():%s", err.Error())
+	}
+	records := testDumpJson(t, []string{output}, time.Time{}, time.Time{})
+	if len(records) != 6 || records[2].RecordType != 2 || records[5].RecordType != 2 {
+		t.Errorf("records = %+v", records)
+	}
+
+	if err := catRun([]string{"-o", output, v1, v2}); err != nil {
+		t.Fatalf("catRun():%s", err.Error())
+	}
+	records = testDumpJson(t, []string{output}, time.Time{}, time.Time{})
+	if len(records) != 6 {
+		t.Fatalf("len(records) should be 6, now it's %d", len(records))
+	}
+	for i, record := range records {
+		if record.Version != b2log.HEADER_VERSION_V2 || record.Data == nil {
+			t.Errorf("record %d = %+v", i, record)
+		}
+	}
+
+	if err := catRun([]string{"-o", output}); err == nil {
+		t.Errorf("catRun() should fail without input")
+	}
+}
+
+// test of splitRun()
+func Test_Split(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2logtool")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	input := testFileCreate(t, dir, "input.b2log", b2log.HEADER_VERSION_V2, 10)
+	prefix := filepath.Join(dir, "split")
+
+	// split by records
+	if err := splitRun([]string{"-records", "4", "-o", prefix, input}); err != nil {
+		t.Fatalf("splitRun():%s", err.Error())
+	}
+	testFileCheck(t, prefix+".000", b2log.HEADER_VERSION_V2, 0, 4)
+	testFileCheck(t, prefix+".001", b2log.HEADER_VERSION_V2, 4, 4)
+	testFileCheck(t, prefix+".002", b2log.HEADER_VERSION_V2, 8, 2)
+	if _, err := os.Stat(prefix + ".003"); err == nil {
+		t.Errorf("%s.003 should not be created", prefix)
+	}
+
+	// split by size, 3 records in each file
+	prefix = filepath.Join(dir, "split_size")
+	recordSize := b2log.HEADER_SIZE_V2 + len("record 0")
+	size := fmt.Sprintf("%d", recordSize*3)
+	if err := splitRun([]string{"-size", size, "-o", prefix, input}); err != nil {
+		t.Fatalf("splitRun():%s", err.Error())
+	}
+	testFileCheck(t, prefix+".000", b2log.HEADER_VERSION_V2, 0, 3)
+	testFileCheck(t, prefix+".003", b2log.HEADER_VERSION_V2, 9, 1)
+
+	if err := splitRun([]string{"-o", prefix, input}); err == nil {
+		t.Errorf("splitRun() should fail without -records or -size")
+	}
+}
@@ -0,0 +1,232 @@
+/* dump.go - dump records of b2log files  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/b2log"
+)
+
+// format of dump
+const (
+	DUMP_HEX  = "hex"
+	DUMP_JSON = "json"
+)
+
+// record in json format
+type recordJson struct {
+	File       string
+	Offset     int64
+	TimeStamp  uint64
+	Time       string
+	Version    uint32
+	Compress   uint32
+	RecordType uint32
+	Length     int
+	Data       []byte // encoded in base64
+}
+
+// source of records, *b2log.Reader or *b2log.RangeReader
+type recordSource interface {
+	Read() (b2log.Record, error)
+	Header() b2log.Header
+	RecordOffset() int64
+	SetSkipHandler(handler b2log.SkipHandler)
+}
+
+// reader for whole file
+type fileReader struct {
+	*b2log.Reader
+	file *os.File
+}
+
+func (r *fileReader) Close() error {
+	return r.file.Close()
+}
+
+/*
+recordSourceOpen - open b2log file for reading records
+
+Params:
+    - path: path of b2log file
+    - from, to: time range of records. If both are zero, read all records
+
+Returns:
+    (source, closer, error)
+*/
+func recordSourceOpen(path string, from, to time.Time) (recordSource, io.Closer, error) {
+	if !from.IsZero() || !to.IsZero() {
+		if to.IsZero() {
+			to = time.Unix(0, math.MaxInt64)
+		}
+		rr, err := b2log.OpenRange(path, from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rr, rr, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &fileReader{b2log.NewReader(file), file}
+	return r, r, nil
+}
+
+/*
+recordsForEach - call fn for each record in b2log file
+
+Params:
+    - path: path of b2log file
+    - from, to: time range of records. If both are zero, read all records
+    - fn: function for each record
+
+Returns:
+    error
+    Bypassed data and broken records are reported to stderr.
+*/
+func recordsForEach(path string, from, to time.Time, fn func(b2log.Record, recordSource) error) error {
+	src, closer, err := recordSourceOpen(path, from, to)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	src.SetSkipHandler(func(offset int64, size int64) {
+		fmt.Fprintf(os.Stderr, "%s: skip %d bytes at offset %d\n", path, size, offset)
+	})
+
+	for {
+		record, err := src.Read()
+		switch err {
+		case nil:
+			if err := fn(record, src); err != nil {
+				return err
+			}
+		case io.EOF:
+			return nil
+		case io.ErrUnexpectedEOF:
+			fmt.Fprintf(os.Stderr, "%s: incomplete record at the end\n", path)
+			return nil
+		case b2log.ErrCompressed, b2log.ErrDecompress:
+			fmt.Fprintf(os.Stderr, "%s: record at offset %d: %s\n", path, src.RecordOffset(), err.Error())
+		default:
+			return err
+		}
+	}
+}
+
+// dump one record in format of hex
+func dumpHex(w io.Writer, path string, record b2log.Record, src recordSource) error {
+	header := src.Header()
+	_, err := fmt.Fprintf(w, "file=%s offset=%d timestamp=%d time=%s version=%d compress=%d type=%d length=%d\n%s",
+		path, src.RecordOffset(), header.TimeStamp,
+		timestampToTime(header.TimeStamp).Format("2006-01-02 15:04:05.000"),
+		header.HeaderVersion(), header.CompressType(), header.RecordType,
+		len(record), hex.Dump(record))
+	return err
+}
+
+// dump one record in format of json
+func dumpJson(w io.Writer, path string, record b2log.Record, src recordSource) error {
+	header := src.Header()
+	data, err := json.Marshal(recordJson{
+		File:       path,
+		Offset:     src.RecordOffset(),
+		TimeStamp:  header.TimeStamp,
+		Time:       timestampToTime(header.TimeStamp).Format("2006-01-02 15:04:05.000"),
+		Version:    header.HeaderVersion(),
+		Compress:   header.CompressType(),
+		RecordType: header.RecordType,
+		Length:     len(record),
+		Data:       record,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+/*
+dump - dump records of b2log files
+
+Params:
+    - w: writer for output
+    - paths: paths of b2log files
+    - from, to: time range of records. If both are zero, dump all records
+    - dumpFn: function for dumping one record, dumpHex or dumpJson
+
+Returns:
+    error
+*/
+func dump(w io.Writer, paths []string, from, to time.Time,
+	dumpFn func(io.Writer, string, b2log.Record, recordSource) error) error {
+	for _, path := range paths {
+		err := recordsForEach(path, from, to, func(record b2log.Record, src recordSource) error {
+			return dumpFn(w, path, record, src)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// run sub command "dump"
+func dumpRun(args []string) error {
+	var from, to time.Time
+	var err error
+
+	flags := flagSetNew("dump")
+	format := flags.String("format", DUMP_HEX, "output format, hex or json")
+	fromStr := flags.String("from", "", "start time of records, included")
+	toStr := flags.String("to", "", "end time of records, excluded")
+	flags.Parse(args)
+
+	if *fromStr != "" {
+		if from, err = timeParse(*fromStr); err != nil {
+			return fmt.Errorf("invalid -from:%s", err.Error())
+		}
+	}
+	if *toStr != "" {
+		if to, err = timeParse(*toStr); err != nil {
+			return fmt.Errorf("invalid -to:%s", err.Error())
+		}
+	}
+
+	var dumpFn func(io.Writer, string, b2log.Record, recordSource) error
+	switch *format {
+	case DUMP_HEX:
+		dumpFn = dumpHex
+	case DUMP_JSON:
+		dumpFn = dumpJson
+	default:
+		return fmt.Errorf("invalid -format:%s", *format)
+	}
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no input file")
+	}
+
+	return dump(os.Stdout, flags.Args(), from, to, dumpFn)
+}
@@ -0,0 +1,141 @@
+/* dump_test.go - test for dump.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/b2log"
+)
+
+// timestamp of the first record in test file
+const testTimeStamp = 1390464000000
+
+/*
+testFileCreate - create b2log file for test
+
+Params:
+    - dir: directory of the file
+    - name: name of the file
+    - version: version of header
+    - num: number of records, with timestamps 1s apart from testTimeStamp
+
+Returns:
+    path of the file
+*/
+func testFileCreate(t *testing.T, dir string, name string, version uint32, num int) string {
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("os.Create():%s", err.Error())
+	}
+	defer file.Close()
+
+	w := b2log.NewWriter(file)
+	w.SetVersion(version)
+	for i := 0; i < num; i++ {
+		payload := []byte(fmt.Sprintf("record %d", i))
+		if _, err := w.WriteRecord(payload, uint64(testTimeStamp+i*1000), uint32(i)); err != nil {
+			t.Fatalf("w.WriteRecord():%s", err.Error())
+		}
+	}
+
+	return path
+}
+
+// dump records of file in json, and return them
+func testDumpJson(t *testing.T, paths []string, from, to time.Time) []recordJson {
+	var out bytes.Buffer
+	if err := dump(&out, paths, from, to, dumpJson); err != nil {
+		t.Fatalf("dump():%s", err.Error())
+	}
+
+	records := make([]recordJson, 0)
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var record recordJson
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("decoder.Decode():%s", err.Error())
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// test of dump(), with time range
+func Test_Dump_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2logtool")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{testFileCreate(t, dir, "test.b2log", b2log.HEADER_VERSION_V2, 10)}
+	from := timestampToTime(testTimeStamp + 3000)
+	to := timestampToTime(testTimeStamp + 6000)
+
+	cases := []struct {
+		from, to    time.Time
+		first, last int // records expected
+	}{
+		{time.Time{}, time.Time{}, 0, 9},
+		{from, to, 3, 5},
+		{from, time.Time{}, 3, 9},
+		{time.Time{}, to, 0, 5},
+	}
+
+	for i, c := range cases {
+		records := testDumpJson(t, paths, c.from, c.to)
+		if len(records) != c.last-c.first+1 {
+			t.Errorf("case %d: len(records) should be %d, now it's %d", i, c.last-c.first+1, len(records))
+			continue
+		}
+		for j, record := range records {
+			n := c.first + j
+			if string(record.Data) != fmt.Sprintf("record %d", n) || record.RecordType != uint32(n) ||
+				record.TimeStamp != uint64(testTimeStamp+n*1000) || record.Version != b2log.HEADER_VERSION_V2 {
+				t.Errorf("case %d: record %d = %+v", i, j, record)
+			}
+		}
+	}
+}
+
+// test of dump(), in hex
+func Test_Dump_2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b2logtool")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir():%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := testFileCreate(t, dir, "test.b2log", b2log.HEADER_VERSION_V1, 1)
+
+	var out bytes.Buffer
+	if err := dump(&out, []string{path}, time.Time{}, time.Time{}, dumpHex); err != nil {
+		t.Fatalf("dump():%s", err.Error())
+	}
+	expect := fmt.Sprintf("file=%s offset=0 timestamp=%d ", path, testTimeStamp)
+	if !bytes.HasPrefix(out.Bytes(), []byte(expect)) || !bytes.Contains(out.Bytes(), []byte("|record 0|")) {
+		t.Errorf("out = %s", out.String())
+	}
+
+	if err := dump(&out, []string{filepath.Join(dir, "notexist")}, time.Time{}, time.Time{}, dumpHex); err == nil {
+		t.Errorf("dump() should fail for file not exist")
+	}
+}
@@ -0,0 +1,105 @@
+/* main.go - tool to dump, filter, convert and verify b2log files  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+b2logtool is a command-line tool for b2log files.
+
+Usage:
+    b2logtool dump [-format hex|json] [-from TIME] [-to TIME] file...
+    b2logtool verify file...
+    b2logtool convert [-compress none|zlib] [-version 1|2] -o output input
+    b2logtool cat [-compress none|zlib] [-version 1|2] -o output input...
+    b2logtool split [-records N] [-size N] -o prefix input
+
+TIME is in format "2006-01-02 15:04:05" (local time), or milliseconds since epoch.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// format of time in arguments
+const TIME_FORMAT = "2006-01-02 15:04:05"
+
+// sub command
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"dump", "dump [-format hex|json] [-from TIME] [-to TIME] file...", dumpRun},
+	{"verify", "verify file...", verifyRun},
+	{"convert", "convert [-compress none|zlib] [-version 1|2] -o output input", convertRun},
+	{"cat", "cat [-compress none|zlib] [-version 1|2] -o output input...", catRun},
+	{"split", "split [-records N] [-size N] -o prefix input", splitRun},
+}
+
+// print usage of b2logtool
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of b2logtool:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "    b2logtool %s\n", cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nTIME is in format \"%s\", or milliseconds since epoch.\n", TIME_FORMAT)
+	fmt.Fprintf(os.Stderr, "Run \"b2logtool COMMAND -h\" for options of each command.\n")
+}
+
+/*
+timeParse - parse time in arguments
+
+Params:
+    - str: time in format TIME_FORMAT, or milliseconds since epoch
+
+Returns:
+    (time, error)
+*/
+func timeParse(str string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+
+	return time.ParseInLocation(TIME_FORMAT, str, time.Local)
+}
+
+// convert timestamp of b2log header to time
+func timestampToTime(timestamp uint64) time.Time {
+	return time.Unix(0, int64(timestamp)*int64(time.Millisecond))
+}
+
+// create flag set for sub command
+func flagSetNew(name string) *flag.FlagSet {
+	return flag.NewFlagSet("b2logtool "+name, flag.ExitOnError)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+
+		if err := cmd.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "b2logtool %s: %s\n", cmd.name, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
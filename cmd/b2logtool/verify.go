@@ -0,0 +1,111 @@
+/* verify.go - verify framing of b2log files  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+import (
+	"www.baidu.com/golang-lib/b2log"
+)
+
+// result of verification
+type verifyResult struct {
+	Records  int   // number of good records
+	Broken   int   // number of records which can not be decompressed
+	Skipped  int64 // bytes of unsynchronized data
+	Corrupts int   // number of corrupt regions
+	Partial  bool  // whether there is incomplete record at the end
+}
+
+// check whether the file is good
+func (r verifyResult) ok() bool {
+	return r.Broken == 0 && r.Corrupts == 0 && !r.Partial
+}
+
+/*
+verify - verify framing of records from rd
+
+Params:
+    - rd: reader for b2log data
+    - out: writer for reporting corrupt offsets
+
+Returns:
+    (result, error)
+*/
+func verify(rd io.Reader, out io.Writer) (verifyResult, error) {
+	var result verifyResult
+
+	r := b2log.NewReader(rd)
+	r.SetSkipHandler(func(offset int64, size int64) {
+		fmt.Fprintf(out, "corrupt: offset %d, %d bytes skipped\n", offset, size)
+		result.Corrupts++
+	})
+
+	for {
+		_, err := r.Read()
+		switch err {
+		case nil:
+			result.Records++
+		case b2log.ErrCompressed, b2log.ErrDecompress:
+			fmt.Fprintf(out, "broken: offset %d, %s\n", r.RecordOffset(), err.Error())
+			result.Broken++
+		case io.EOF:
+			result.Skipped = r.Skipped()
+			return result, nil
+		case io.ErrUnexpectedEOF:
+			fmt.Fprintf(out, "partial: offset %d, %d bytes at the end\n", r.Offset(), r.Buffered())
+			result.Partial = true
+			result.Skipped = r.Skipped()
+			return result, nil
+		default:
+			return result, err
+		}
+	}
+}
+
+// run sub command "verify"
+func verifyRun(args []string) error {
+	flags := flagSetNew("verify")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no input file")
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s:\n", path)
+		result, err := verify(file, os.Stdout)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+
+		fmt.Printf("records: %d, broken: %d, corrupt: %d, skipped bytes: %d\n",
+			result.Records, result.Broken, result.Corrupts, result.Skipped)
+		if !result.ok() {
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d file(s) failed in verification", failed)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/* verify_test.go - test for verify.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+import (
+	"www.baidu.com/golang-lib/b2log"
+)
+
+// test of verify(), for good data
+func Test_Verify_1(t *testing.T) {
+	var data, out bytes.Buffer
+	w := b2log.NewWriter(&data)
+	w.Write([]byte("record 1"))
+	w.Write([]byte("record 2"))
+
+	result, err := verify(&data, &out)
+	if err != nil {
+		t.Fatalf("verify():%s", err.Error())
+	}
+	if !result.ok() || result.Records != 2 {
+		t.Errorf("verify() = %+v", result)
+	}
+	if out.Len() != 0 {
+		t.Errorf("out should be empty, now it's %s", out.String())
+	}
+}
+
+// test of verify(), for corrupt data
+func Test_Verify_2(t *testing.T) {
+	file, err := os.Open("../../b2log/test_data/pb_access_2.log")
+	if err != nil {
+		t.Fatalf("os.Open():%s", err.Error())
+	}
+	defer file.Close()
+
+	var out bytes.Buffer
+	result, err := verify(file, &out)
+	if err != nil {
+		t.Fatalf("verify():%s", err.Error())
+	}
+	if result.ok() || result.Records != 7 || result.Corrupts != 1 || result.Skipped != 459 {
+		t.Errorf("verify() = %+v", result)
+	}
+	if out.String() != "corrupt: offset 0, 459 bytes skipped\n" {
+		t.Errorf("out = %s", out.String())
+	}
+}
+
+// test of timeParse()
+func Test_TimeParse(t *testing.T) {
+	tm, err := timeParse("1390464000123")
+	if err != nil || tm.UnixNano() != 1390464000123*1e6 {
+		t.Errorf("timeParse() = %s, %v", tm, err)
+	}
+
+	tm, err = timeParse("2014-01-23 16:00:00")
+	if err != nil || tm.Hour() != 16 {
+		t.Errorf("timeParse() = %s, %v", tm, err)
+	}
+
+	if _, err := timeParse("2014/01/23"); err == nil {
+		t.Errorf("timeParse() should fail")
+	}
+}
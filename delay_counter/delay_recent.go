@@ -5,6 +5,8 @@ modification history
 2014/3/20, by Zhang Miao, create
 2014/9/5,  by Zhang Miao, move from waf-server to golang-lib
 2015/6/15, by Li Bingyi, move FormatOutput() from waf-server to golang-lib
+2026/10/18, by agent, modify
+    - add format prometheus to FormatOutput()
 */
 /*
 DESCRIPTION
@@ -181,6 +183,12 @@ func (t *DelayRecent) GetNoahWithProgramName() []byte {
     return d.GetNoahWithProgramName()
 }
 
+// get data in the table, return with prometheus text exposition format
+func (t *DelayRecent) GetPrometheus() []byte {
+    d := t.Get()
+    return d.GetPrometheus()
+}
+
 // format output according format value in params
 func (t *DelayRecent) FormatOutput(params map[string][]string) ([]byte, error) {
     format, err := web_params.ParamsValueGet(params, "format")
@@ -195,6 +203,8 @@ func (t *DelayRecent) FormatOutput(params map[string][]string) ([]byte, error) {
         return t.GetNoah(), nil
 	case "noah_with_program_name":
 		return t.GetNoahWithProgramName(), nil
+    case "prometheus":
+        return t.GetPrometheus(), nil
     default:
         return nil, fmt.Errorf("format not support: %s", format)
     }
@@ -257,3 +267,14 @@ func (d *DelayOutput) getNoah(withProgramName bool) []byte {
 
     return buf.Bytes()
 }
+
+// get prometheus text exposition format for DelayOutput
+// Current and Past are output as gauges of buckets, in Microsecond
+func (d *DelayOutput) GetPrometheus() []byte {
+    w := module_state2.NewPrometheusWriter(d.NoahKeyPrefix, d.ProgramName)
+
+    d.Current.PrometheusString(w, "Current")
+    d.Past.PrometheusString(w, "Past")
+
+    return w.Bytes()
+}
@@ -4,6 +4,7 @@ modification history
 --------------------
 2014/4/2, by Zhang Miao, create
 2014/9/5, by Zhang Miao, move from waf-server to golang-lib
+2026/10/18, by agent, add test for format prometheus
 */
 /*
 DESCRIPTION
@@ -79,6 +80,15 @@ func TestFormatOutput(t *testing.T) {
         t.Errorf("FormatOutDR(): testcase 1 : %s", err.Error())
     }
 
+    params = map[string][]string {
+        "format" : []string{"prometheus"},
+    }
+
+    _, err = (&delay).FormatOutput(params)
+    if err != nil {
+        t.Errorf("FormatOutDR(): testcase prometheus : %s", err.Error())
+    }
+
     params = map[string][]string {
         "format" : []string{"no_noah"},
     }
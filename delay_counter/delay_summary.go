@@ -4,6 +4,8 @@ modification history
 --------------------
 2014/3/20, by Zhang Miao, create
 2014/9/5,  by Zhang Miao, move from waf-server to golang-lib
+2026/10/18, by agent, modify
+    - add PrometheusString()
 */
 /*
 DESCRIPTION
@@ -15,6 +17,10 @@ import (
     "fmt"
 )
 
+import (
+    "www.baidu.com/golang-lib/module_state2"
+)
+
 // for holding data in recent several seconds
 type DelaySummary struct {
     BucketSize  int     // size of each delay bucket, e.g., 1(ms) or 2(ms)
@@ -138,3 +144,22 @@ func (dc *DelaySummary) NoahString(buf *bytes.Buffer, prefix string) {
         buf.WriteString(str)        
     }    
 }
+
+// write DelaySummary as prometheus gauges of buckets
+//
+// Delays are in a window and reset after it, so they are not output as
+// histogram, see module_state2.PrometheusWriter.WindowBuckets(). Buckets are
+// cumulative, with upper bounds in Microsecond, e.g., for bucketSize == 1ms,
+// BucketNum == 2, buckets are le="1000", le="2000", le="+Inf".
+//
+// Params:
+//      - w: writer of prometheus output
+//      - key: key of metric, e.g., 'Past'
+func (dc *DelaySummary) PrometheusString(w *module_state2.PrometheusWriter, key string) {
+    bounds := make([]float64, dc.BucketNum)
+    for i := 0; i < dc.BucketNum; i ++ {
+        bounds[i] = float64((i + 1) * dc.BucketSize * 1000)
+    }
+
+    w.WindowBuckets(key, bounds, dc.Counters, float64(dc.Sum))
+}
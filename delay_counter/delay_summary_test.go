@@ -3,6 +3,7 @@
 modification history
 --------------------
 2014/9/9, by Zhang Miao, create
+2026/10/18, by agent, add test for PrometheusString()
 */
 /*
 DESCRIPTION
@@ -10,11 +11,13 @@ DESCRIPTION
 package delay_counter
 
 import (
+    "strings"
     "testing"
 )
 
 import (
     "www.baidu.com/golang-lib/log"
+    "www.baidu.com/golang-lib/module_state2"
 )
 
 func TestDelaySummary(t *testing.T) {
@@ -111,3 +114,37 @@ func TestDelaySummary(t *testing.T) {
     
     log.Logger.Close()
 }
+
+func TestDelaySummary_PrometheusString(t *testing.T) {
+    var counter DelaySummary
+    counter.Init(2, 2)
+    counter.Add(1000)
+    counter.Add(3000)
+    counter.Add(3500)
+    counter.Add(9000)
+
+    w := module_state2.NewPrometheusWriter("delay", "go-bfe")
+    counter.PrometheusString(w, "Past")
+
+    strOK := "# TYPE delay_Past_bucket_window gauge\n" +
+        "delay_Past_bucket_window{program=\"go-bfe\",le=\"2000\"} 1\n" +
+        "delay_Past_bucket_window{program=\"go-bfe\",le=\"4000\"} 3\n" +
+        "delay_Past_bucket_window{program=\"go-bfe\",le=\"+Inf\"} 4\n" +
+        "# TYPE delay_Past_sum_window gauge\n" +
+        "delay_Past_sum_window{program=\"go-bfe\"} 16500\n" +
+        "# TYPE delay_Past_count_window gauge\n" +
+        "delay_Past_count_window{program=\"go-bfe\"} 4\n"
+    if str := string(w.Bytes()); str != strOK {
+        t.Errorf("err in DelaySummary.PrometheusString(): %s", str)
+    }
+
+    // output of DelayOutput
+    var d DelayOutput
+    d.Current.Init(2, 2)
+    d.Past.Copy(counter)
+    str := string(d.GetPrometheus())
+    if !strings.Contains(str, "Current_count_window 0\n") ||
+        !strings.HasSuffix(str, "Past_count_window 4\n") {
+        t.Errorf("err in DelayOutput.GetPrometheus(): %s", str)
+    }
+}
@@ -6,6 +6,8 @@ modification history
 2014/11/12, by Li Bingyi, modify.
     - move codes from waf-server for periodically get counter slice
 2015/6/15, by Li Bingyi, move FormatOutput() from waf-server to golang-lib
+2026/10/18, by agent, modify
+    - add format prometheus to FormatOutput()
 */
 /*
 DESCRIPTION
@@ -174,6 +176,8 @@ func (cd *CounterDiff) FormatOutput(params map[string][]string) ([]byte, error)
         return cd.NoahString(), nil
     case "noah_with_program_name":
         return cd.NoahStringWithProgramName(), nil
+    case "prometheus":
+        return cd.PrometheusString(), nil
 		default:
         return nil, fmt.Errorf("format not support: %s", format)
     }
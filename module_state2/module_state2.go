@@ -6,6 +6,9 @@ modification history
 2014/7/9, by Li Bingyi, add SetNum feature for number states
 2015/6/15, by Li Bingyi, move FormatOutput from waf-server to golang-lib
 2017/12/20, by yuxiaofei, add Delete func for State
+2026/10/18, by agent, modify
+    - add format prometheus to FormatOutput()
+2026/10/18, by agent, add CounterDelete func for State
 */
 /*
 DESCRIPTION
@@ -164,6 +167,8 @@ func (sd *StateData) FormatOutput(params map[string][]string) ([]byte, error) {
 		return sd.NoahString(), nil
 	case "noah_with_program_name":
 		return sd.NoahStringWithProgramName(), nil
+	case "prometheus":
+		return sd.PrometheusString(), nil
 	default:
 		return nil, fmt.Errorf("format not support: %s", format)
 	}
@@ -242,6 +247,18 @@ func (s *State) Delete(key string) {
 	s.lock.Unlock()
 }
 
+/* delete counter key */
+func (s *State) CounterDelete(key string) {
+	// support s is nil
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	delete(s.data.SCounters, key)
+	s.lock.Unlock()
+}
+
 /* set num state to key */
 func (s *State) SetNum(key string, value int64) {
 	// support s is nil
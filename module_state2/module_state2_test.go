@@ -4,6 +4,7 @@ modification history
 --------------------
 2014/3/25, by Zhang Miao, modify from module_state_test.go
 2014/7/9, by Li Bingyi, add unit test for SetNum() and GetNumState()
+2026/10/18, by agent, add unit test for CounterDelete()
 */
 /*
 DESCRIPTION
@@ -94,6 +95,24 @@ func TestModuleStateCountersInit(t *testing.T) {
 	}
 }
 
+func TestModuleStateCounterDelete(t *testing.T) {
+	var state State
+
+	state.Init()
+	state.Inc("test1", 1)
+	state.Inc("test2", 2)
+	state.CounterDelete("test1")
+	state.CounterDelete("notexist")
+
+	counters := state.GetCounters()
+	if _, ok := counters["test1"]; ok {
+		t.Error("err in CounterDelete(), test1 should be deleted")
+	}
+	if counters["test2"] != 2 {
+		t.Error("err in CounterDelete(), value of test2 should be 2")
+	}
+}
+
 func TestModuleStateNil(t *testing.T) {
 	// test support of nil for Inc(), Dec(), Set(), SetNum()
 	var pState *State
@@ -106,6 +125,7 @@ func TestModuleStateNil(t *testing.T) {
 	pState.Dec("test", 1)
 	pState.Set("state", "ok")
 	pState.SetNum("num", 1)
+	pState.CounterDelete("test")
 }
 
 // test for StateData.NoahString()
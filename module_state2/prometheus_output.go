@@ -0,0 +1,294 @@
+/* prometheus_output.go - for prometheus text exposition format output	*/
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Output in prometheus text exposition format (version 0.0.4), for format=prometheus.
+
+- metric name is generated like noah key, i.e., <noahKeyPrefix>_<key>, and
+  escaped like escapeNoahKey(); "-" and "." are not allowed in metric name,
+  so they are also replaced by "_"
+- program name, if not empty, is added as label "program"
+- string states are info-style metrics, e.g., mod_gtc_state_info{value="OK"} 1
+- delays in a window are gauges of buckets, see WindowBuckets()
+- metrics with the same name after escaping are output only once
+
+Usage:
+    w := module_state2.NewPrometheusWriter("mod_gtc", "go-bfe")
+
+    w.Int("CONN_ACCEPT", "counter", 100)
+    w.Info("state", "OK")
+    w.WindowBuckets("delay", []float64{1000, 2000}, []int64{5, 3, 1}, 7500)
+
+    buf := w.Bytes()
+*/
+package module_state2
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// types of prometheus metric
+const (
+	PROMETHEUS_COUNTER = "counter"
+	PROMETHEUS_GAUGE   = "gauge"
+)
+
+// for escaping label value: \ => \\, " => \", newline => \n
+var prometheusLabelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+/*
+prometheus metric name only support letter, num, "_" and ":", and should not
+begin with num - use "_" instead of unsupport character.
+
+Params:
+    - originKey: original key
+
+Returns:
+    - metric name for prometheus
+*/
+func escapePrometheusKey(originKey string) string {
+	var buf bytes.Buffer
+	for i, r := range originKey {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case r == '_', r == ':':
+		case '0' <= r && r <= '9':
+			if i == 0 {
+				buf.WriteByte('_')
+			}
+		default:
+			r = '_'
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+/*
+generate and escape metric name for prometheus output
+
+Params:
+	- key: the original key
+	- noahKeyPrefix: e.g., "mod_gtc"
+
+Returns:
+	metric name, e.g., "mod_gtc_ERR_PB_SEEK"
+*/
+func PrometheusKeyGen(key string, noahKeyPrefix string) string {
+	return escapePrometheusKey(noahKeyGen(key, noahKeyPrefix, "", false))
+}
+
+// writer of prometheus text exposition format
+type PrometheusWriter struct {
+	buf           bytes.Buffer
+	noahKeyPrefix string          // prefix of metric name
+	programName   string          // for label "program"
+	names         map[string]bool // names of metric written
+}
+
+/*
+create writer of prometheus text exposition format
+
+Params:
+	- noahKeyPrefix: prefix of metric name, e.g., "mod_gtc"
+	- programName: value of label "program", e.g., "go-bfe"; no label if ""
+
+Returns:
+	PrometheusWriter
+*/
+func NewPrometheusWriter(noahKeyPrefix string, programName string) *PrometheusWriter {
+	w := new(PrometheusWriter)
+	w.noahKeyPrefix = noahKeyPrefix
+	w.programName = programName
+	w.names = make(map[string]bool)
+	return w
+}
+
+/*
+generate labels, label "program" comes first
+
+Params:
+	- labels: pairs of label name and value, e.g., "le", "1000"
+
+Returns:
+	labels, e.g., {program="go-bfe",le="1000"}; "" if no label
+*/
+func (w *PrometheusWriter) labelsGen(labels ...string) string {
+	if w.programName != "" {
+		labels = append([]string{"program", w.programName}, labels...)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+
+	strs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := prometheusLabelEscaper.Replace(labels[i+1])
+		strs = append(strs, fmt.Sprintf("%s=\"%s\"", labels[i], value))
+	}
+	return "{" + strings.Join(strs, ",") + "}"
+}
+
+/*
+write TYPE line of metric
+
+Params:
+	- key: the original key
+	- metricType: type of metric, e.g., PROMETHEUS_COUNTER
+
+Returns:
+	(name of metric, true), if succeed
+	("", false), if metric with the same name is written already
+*/
+func (w *PrometheusWriter) metricBegin(key string, metricType string) (string, bool) {
+	name := PrometheusKeyGen(key, w.noahKeyPrefix)
+	if w.names[name] {
+		return "", false
+	}
+	w.names[name] = true
+
+	fmt.Fprintf(&w.buf, "# TYPE %s %s\n", name, metricType)
+	return name, true
+}
+
+// format float value, e.g., "0.5", "+Inf"
+func prometheusFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// write metric of int value, metricType should be PROMETHEUS_COUNTER or PROMETHEUS_GAUGE
+func (w *PrometheusWriter) Int(key string, metricType string, value int64) {
+	name, ok := w.metricBegin(key, metricType)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(&w.buf, "%s%s %d\n", name, w.labelsGen(), value)
+}
+
+// write metric of float value, metricType should be PROMETHEUS_COUNTER or PROMETHEUS_GAUGE
+func (w *PrometheusWriter) Float(key string, metricType string, value float64) {
+	name, ok := w.metricBegin(key, metricType)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(&w.buf, "%s%s %s\n", name, w.labelsGen(), prometheusFloat(value))
+}
+
+// write info-style metric for string state, e.g., mod_gtc_state_info{value="OK"} 1
+func (w *PrometheusWriter) Info(key string, value string) {
+	name, ok := w.metricBegin(key+"_info", PROMETHEUS_GAUGE)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(&w.buf, "%s%s 1\n", name, w.labelsGen("value", value))
+}
+
+/*
+write buckets of samples in a window (e.g., last minute) as gauges
+
+Samples in a window are not accumulated since start, but reset at the end
+of each window, so they are not a prometheus histogram (whose buckets, sum
+and count must be monotonic counters). Buckets are written as gauges with
+cumulative counts and label "le", so that histogram_quantile() still works:
+
+    <key>_bucket_window{le="1000"}, ..., <key>_bucket_window{le="+Inf"}
+    <key>_sum_window
+    <key>_count_window
+
+Params:
+	- key: the original key
+	- bounds: upper bounds of buckets, in ascending order, e.g., [1000, 2000]
+	- counters: number of samples in each bucket, not cumulative; the last one
+	  is for samples larger than the last bound, e.g., [0-1000, 1000-2000, >2000]
+	- sum: sum of samples
+*/
+func (w *PrometheusWriter) WindowBuckets(key string, bounds []float64, counters []int64, sum float64) {
+	name, ok := w.metricBegin(key+"_bucket_window", PROMETHEUS_GAUGE)
+	if !ok {
+		return
+	}
+
+	// buckets are cumulative, like buckets of prometheus histogram
+	var count int64
+	for i, counter := range counters {
+		count += counter
+		le := "+Inf"
+		if i < len(bounds) {
+			le = prometheusFloat(bounds[i])
+		}
+		fmt.Fprintf(&w.buf, "%s%s %d\n", name, w.labelsGen("le", le), count)
+	}
+	if len(counters) <= len(bounds) {
+		fmt.Fprintf(&w.buf, "%s%s %d\n", name, w.labelsGen("le", "+Inf"), count)
+	}
+
+	w.Float(key+"_sum_window", PROMETHEUS_GAUGE, sum)
+	w.Int(key+"_count_window", PROMETHEUS_GAUGE, count)
+}
+
+// get output of writer
+func (w *PrometheusWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// write Counters, in order of key
+func (w *PrometheusWriter) counters(counters Counters, metricType string) {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		w.Int(key, metricType, counters[key])
+	}
+}
+
+// output prometheus text exposition format for StateData
+func (sd *StateData) PrometheusString() []byte {
+	w := NewPrometheusWriter(sd.NoahKeyPrefix, sd.ProgramName)
+
+	// SCounters
+	w.counters(sd.SCounters, PROMETHEUS_COUNTER)
+
+	// States
+	keys := make([]string, 0, len(sd.States))
+	for key := range sd.States {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.Info(key, sd.States[key])
+	}
+
+	// NumStates
+	w.counters(sd.NumStates, PROMETHEUS_GAUGE)
+
+	// FloatStates
+	keys = make([]string, 0, len(sd.FloatStates))
+	for key := range sd.FloatStates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.Float(key, PROMETHEUS_GAUGE, sd.FloatStates[key])
+	}
+
+	return w.Bytes()
+}
+
+// output prometheus text exposition format for CounterDiff
+// Note: diff in last duration is not monotonic, so it is of type gauge
+func (cd CounterDiff) PrometheusString() []byte {
+	w := NewPrometheusWriter(cd.NoahKeyPrefix, cd.ProgramName)
+	w.counters(cd.Diff, PROMETHEUS_GAUGE)
+	return w.Bytes()
+}
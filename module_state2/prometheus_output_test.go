@@ -0,0 +1,114 @@
+/* prometheus_output_test.go - test for prometheus_output.go	*/
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package module_state2
+
+import (
+	"testing"
+)
+
+func TestEscapePrometheusKey(t *testing.T) {
+	cases := map[string]string{
+		"TLS_ALPN_SPDY/3.1": "TLS_ALPN_SPDY_3_1",
+		"go-bfe.conn":       "go_bfe_conn",
+		"5xx:num":           "_5xx:num",
+		"状态":                "__",
+	}
+
+	for key, expect := range cases {
+		if name := escapePrometheusKey(key); name != expect {
+			t.Errorf("escapePrometheusKey(%s) should be %s, got %s", key, expect, name)
+		}
+	}
+
+	if name := PrometheusKeyGen("ERR/PB", "mod.gtc"); name != "mod_gtc_ERR_PB" {
+		t.Errorf("PrometheusKeyGen() got %s", name)
+	}
+}
+
+func TestStateData_PrometheusString(t *testing.T) {
+	sd := NewStateData()
+	sd.SCounters.inc("counter", 1)
+	sd.SCounters.inc("counter.1", 2)
+	sd.SCounters.inc("counter_1", 3)
+	sd.States["state"] = "say \"ok\"\n"
+	sd.NumStates["num_state"] = 4
+	sd.FloatStates["float_state"] = 0.5
+	sd.NoahKeyPrefix = "mod"
+	sd.ProgramName = "go-bfe"
+
+	// counter_1 is dropped, for the same name as counter.1
+	strOK := "# TYPE mod_counter counter\n" +
+		"mod_counter{program=\"go-bfe\"} 1\n" +
+		"# TYPE mod_counter_1 counter\n" +
+		"mod_counter_1{program=\"go-bfe\"} 2\n" +
+		"# TYPE mod_state_info gauge\n" +
+		"mod_state_info{program=\"go-bfe\",value=\"say \\\"ok\\\"\\n\"} 1\n" +
+		"# TYPE mod_num_state gauge\n" +
+		"mod_num_state{program=\"go-bfe\"} 4\n" +
+		"# TYPE mod_float_state gauge\n" +
+		"mod_float_state{program=\"go-bfe\"} 0.5\n"
+
+	b, err := sd.FormatOutput(map[string][]string{"format": []string{"prometheus"}})
+	if err != nil {
+		t.Fatalf("FormatOutput(): %s", err.Error())
+	}
+	if string(b) != strOK {
+		t.Errorf("err in StateData.PrometheusString(): %s", string(b))
+	}
+}
+
+func TestCounterDiff_PrometheusString(t *testing.T) {
+	var diff CounterDiff
+	diff.Diff = NewCounters()
+	diff.Diff.inc("b", 2)
+	diff.Diff.inc("a", 1)
+
+	strOK := "# TYPE a gauge\na 1\n# TYPE b gauge\nb 2\n"
+
+	b, err := diff.FormatOutput(map[string][]string{"format": []string{"prometheus"}})
+	if err != nil {
+		t.Fatalf("FormatOutput(): %s", err.Error())
+	}
+	if string(b) != strOK {
+		t.Errorf("err in CounterDiff.PrometheusString(): %s", string(b))
+	}
+}
+
+func TestPrometheusWriter_WindowBuckets(t *testing.T) {
+	w := NewPrometheusWriter("", "")
+	w.WindowBuckets("delay", []float64{1000, 2000}, []int64{5, 3, 1}, 7500)
+
+	strOK := "# TYPE delay_bucket_window gauge\n" +
+		"delay_bucket_window{le=\"1000\"} 5\n" +
+		"delay_bucket_window{le=\"2000\"} 8\n" +
+		"delay_bucket_window{le=\"+Inf\"} 9\n" +
+		"# TYPE delay_sum_window gauge\n" +
+		"delay_sum_window 7500\n" +
+		"# TYPE delay_count_window gauge\n" +
+		"delay_count_window 9\n"
+	if string(w.Bytes()) != strOK {
+		t.Errorf("err in PrometheusWriter.WindowBuckets(): %s", string(w.Bytes()))
+	}
+
+	// bucket +Inf is added if counters has no overflow bucket
+	w = NewPrometheusWriter("", "")
+	w.WindowBuckets("delay", []float64{1000}, []int64{5}, 2000)
+
+	strOK = "# TYPE delay_bucket_window gauge\n" +
+		"delay_bucket_window{le=\"1000\"} 5\n" +
+		"delay_bucket_window{le=\"+Inf\"} 5\n" +
+		"# TYPE delay_sum_window gauge\n" +
+		"delay_sum_window 2000\n" +
+		"# TYPE delay_count_window gauge\n" +
+		"delay_count_window 5\n"
+	if string(w.Bytes()) != strOK {
+		t.Errorf("err in PrometheusWriter.WindowBuckets(): %s", string(w.Bytes()))
+	}
+}
@@ -0,0 +1,393 @@
+/* framer.go - split byte stream of connection into frames  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Framer decides how msgs are delimited in the byte stream of a connection, so
+that TcpServer may serve protocols other than MsgHeader:
+- MsgHeaderFramer : MsgHeader + body, with magic string of the server (default)
+- LineFramer      : newline-delimited, '\n' or "\r\n"
+- VarintFramer    : length of body in uvarint + body
+- B2logFramer     : b2log records
+
+For framers without MsgHeader, a MsgHeader is made for each frame, so that
+CallBacks are used in the same way:
+- MagicStr: zero
+- MsgType: MSG_TYPE_REQUEST
+- MsgSize: MSG_HEADER_LEN + len(body)
+- ReqId: sequence number of the frame in the connection, starting from 0
+
+Msg made by CallBacks.SendMsgMake() is written by Framer.WriteFrame(). For
+MsgHeaderFramer, msg should include MsgHeader, e.g., made by
+MsgHeaderFramer.ResponseHeaderMake(); for other framers, msg is the body only.
+
+Usage:
+    // two servers with different magic strings in one process
+    framer := NewMsgHeaderFramer([4]byte{0xB1, 0xAE, 0xBE, 0xA7})
+    srv := NewTcpServer(callBacks, WithFramer(framer))
+
+    // in SendMsgMake() of callBacks
+    header, err := framer.ResponseHeaderMake(reqId, len(body))
+
+    // line protocol
+    srv := NewTcpServer(callBacks, WithFramer(&LineFramer{MaxLen: 4096}))
+*/
+package net_server
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+)
+
+import (
+    "www.baidu.com/golang-lib/b2log"
+    "www.baidu.com/golang-lib/module_state2"
+)
+
+var (
+    // frame is bypassed, e.g., too long; next frame could still be read
+    ErrFrameBypassed = errors.New("net_server: frame bypassed")
+    ErrMagicStr      = errors.New("magic number is wrong")
+)
+
+// Framer reads and writes frames of a protocol
+type Framer interface {
+    // NewFrameReader creates reader for reading frames from r
+    // tcpState is for counting errors, and may be nil
+    NewFrameReader(r io.Reader, tcpState *module_state2.State) FrameReader
+
+    // WriteFrame writes msg made by CallBacks.SendMsgMake() as a frame
+    WriteFrame(w io.Writer, msg []byte) error
+}
+
+// FrameReader reads frames from a connection
+type FrameReader interface {
+    // ReadFrame reads next frame
+    // body is only valid until next call of ReadFrame()
+    //
+    // error:
+    //   ErrNoDataClose, connection closed before any data of the frame
+    //   ErrFrameBypassed, frame is bypassed, next frame could still be read
+    //   other error, connection should be closed
+    ReadFrame() (MsgHeader, []byte, error)
+}
+
+// frameBuffer is implemented by FrameReader which buffers data of connection
+// Data buffered before ReadFrame() belongs to the next frame, so read timeout,
+// instead of idle timeout, is used for the next frame.
+type frameBuffer interface {
+    // Buffered returns number of bytes read from connection but not consumed
+    Buffered() int
+}
+
+/* make MsgHeader for frame without header */
+func frameHeaderMake(reqId uint32, bodyLen int) MsgHeader {
+    return MsgHeader{
+        MsgType:    MSG_TYPE_REQUEST,
+        MsgSize:    uint32(MSG_HEADER_LEN + bodyLen),
+        ReqId:      reqId,
+    }
+}
+
+/* count key in tcpState, tcpState may be nil   */
+func stateInc(tcpState *module_state2.State, key string) {
+    if tcpState != nil {
+        tcpState.Inc(key, 1)
+    }
+}
+
+/* map io.EOF before any data of frame to ErrNoDataClose */
+func noDataCloseCheck(err error) error {
+    if err == io.EOF {
+        return ErrNoDataClose
+    }
+    return err
+}
+
+/* write all of msg to w    */
+func frameWrite(w io.Writer, msg []byte) error {
+    n, err := w.Write(msg)
+    if err == nil && n != len(msg) {
+        err = io.ErrShortWrite
+    }
+    return err
+}
+
+// MsgHeaderFramer is for msgs of MsgHeader + body
+type MsgHeaderFramer struct {
+    MagicStr    [4]byte     // magic string in MsgHeader
+}
+
+// NewMsgHeaderFramer creates MsgHeaderFramer with given magic string
+func NewMsgHeaderFramer(magicStr [4]byte) *MsgHeaderFramer {
+    return &MsgHeaderFramer{MagicStr: magicStr}
+}
+
+// RequestHeaderMake makes header of request msg, with magic string of f
+func (f *MsgHeaderFramer) RequestHeaderMake(reqId uint32, bodyLen int, needResponse bool) ([]byte, error) {
+    var header MsgHeader
+    header.MagicStr = f.MagicStr
+    if needResponse {
+        header.MsgType = MSG_TYPE_REQUEST
+    } else {
+        header.MsgType = MSG_TYPE_REQUEST_NO_RESPONSE
+    }
+    header.ReqId = reqId
+    header.MsgSize = uint32(MSG_HEADER_LEN + bodyLen)
+
+    return MsgHeaderEncode(header)
+}
+
+// ResponseHeaderMake makes header of response msg, with magic string of f
+func (f *MsgHeaderFramer) ResponseHeaderMake(reqId uint32, bodyLen int) ([]byte, error) {
+    var header MsgHeader
+    header.MagicStr = f.MagicStr
+    header.MsgType = MSG_TYPE_RESPONSE
+    header.ReqId = reqId
+    header.MsgSize = uint32(MSG_HEADER_LEN + bodyLen)
+
+    return MsgHeaderEncode(header)
+}
+
+func (f *MsgHeaderFramer) NewFrameReader(r io.Reader, tcpState *module_state2.State) FrameReader {
+    return &msgHeaderReader{
+        magicStr:   f.MagicStr,
+        r:          r,
+        buff:       make([]byte, RECV_BUF_LEN),
+        tcpState:   tcpState,
+    }
+}
+
+// msg already includes MsgHeader, it is written as is
+func (f *MsgHeaderFramer) WriteFrame(w io.Writer, msg []byte) error {
+    return frameWrite(w, msg)
+}
+
+type msgHeaderReader struct {
+    magicStr    [4]byte
+    r           io.Reader
+    buff        []byte
+    tcpState    *module_state2.State
+}
+
+func (mr *msgHeaderReader) ReadFrame() (MsgHeader, []byte, error) {
+    var header MsgHeader
+
+    /* read header  */
+    if _, err := io.ReadFull(mr.r, mr.buff[:MSG_HEADER_LEN]); err != nil {
+        stateInc(mr.tcpState, "TCP_READ_HEADER_ERR")
+        return header, nil, noDataCloseCheck(err)
+    }
+    header, err := MsgHeaderDecode(mr.buff[:MSG_HEADER_LEN])
+    if err != nil {
+        stateInc(mr.tcpState, "TCP_DECODE_HEADER_ERR")
+        return header, nil, err
+    }
+    if header.MagicStr != mr.magicStr {
+        stateInc(mr.tcpState, "TCP_HEADER_MAGIC_ERR")
+        return header, nil, ErrMagicStr
+    }
+
+    /* check msg type   */
+    if header.MsgType != MSG_TYPE_REQUEST &&
+            header.MsgType != MSG_TYPE_REQUEST_NO_RESPONSE {
+        stateInc(mr.tcpState, "TCP_READ_MSGTYPE_ERR")
+        return header, nil, fmt.Errorf("msg type is not request[%d]", header.MsgType)
+    }
+
+    /* calc and check body length   */
+    bodyLen := int(header.MsgSize) - MSG_HEADER_LEN
+    if bodyLen <= 0 {
+        stateInc(mr.tcpState, "TCP_BODY_ZERO_ERR")
+        return header, nil, fmt.Errorf("bodyLen = %d", bodyLen)
+    }
+    if bodyLen > len(mr.buff) {
+        stateInc(mr.tcpState, "TCP_BODY_TOOLONG_ERR")
+        // bypass msg with bodyLen > RECV_BUF_LEN
+        if _, err := io.CopyN(ioutil.Discard, mr.r, int64(bodyLen)); err != nil {
+            stateInc(mr.tcpState, "TCP_READ_BYPASS_ERR")
+            return header, nil, err
+        }
+        return header, nil, ErrFrameBypassed
+    }
+
+    /* read body    */
+    if _, err := io.ReadFull(mr.r, mr.buff[:bodyLen]); err != nil {
+        stateInc(mr.tcpState, "TCP_READ_BODY_ERR")
+        return header, nil, err
+    }
+    return header, mr.buff[:bodyLen], nil
+}
+
+// LineFramer is for newline-delimited msgs
+// "\n" or "\r\n" is removed from body, and "\n" is appended to msg on write.
+type LineFramer struct {
+    MaxLen      int     // max length of line, RECV_BUF_LEN if <= 0
+}
+
+func (f *LineFramer) NewFrameReader(r io.Reader, tcpState *module_state2.State) FrameReader {
+    maxLen := f.MaxLen
+    if maxLen <= 0 {
+        maxLen = RECV_BUF_LEN
+    }
+    return &lineReader{r: bufio.NewReaderSize(r, maxLen), tcpState: tcpState}
+}
+
+func (f *LineFramer) WriteFrame(w io.Writer, msg []byte) error {
+    return frameWrite(w, append(msg, '\n'))
+}
+
+type lineReader struct {
+    r           *bufio.Reader
+    reqId       uint32
+    tcpState    *module_state2.State
+}
+
+func (lr *lineReader) ReadFrame() (MsgHeader, []byte, error) {
+    line, err := lr.r.ReadSlice('\n')
+    if err == bufio.ErrBufferFull {
+        stateInc(lr.tcpState, "TCP_BODY_TOOLONG_ERR")
+        // bypass till end of the line
+        for err == bufio.ErrBufferFull {
+            _, err = lr.r.ReadSlice('\n')
+        }
+        if err != nil {
+            stateInc(lr.tcpState, "TCP_READ_BYPASS_ERR")
+            return MsgHeader{}, nil, err
+        }
+        return MsgHeader{}, nil, ErrFrameBypassed
+    }
+    if err != nil {
+        if err == io.EOF && len(line) > 0 {
+            err = io.ErrUnexpectedEOF
+        }
+        stateInc(lr.tcpState, "TCP_READ_BODY_ERR")
+        return MsgHeader{}, nil, noDataCloseCheck(err)
+    }
+
+    body := line[:len(line) - 1]
+    if len(body) > 0 && body[len(body) - 1] == '\r' {
+        body = body[:len(body) - 1]
+    }
+    header := frameHeaderMake(lr.reqId, len(body))
+    lr.reqId++
+    return header, body, nil
+}
+
+func (lr *lineReader) Buffered() int {
+    return lr.r.Buffered()
+}
+
+// VarintFramer is for msgs with length of body in uvarint as prefix
+type VarintFramer struct {
+    MaxLen      int     // max length of body, RECV_BUF_LEN if <= 0
+}
+
+func (f *VarintFramer) NewFrameReader(r io.Reader, tcpState *module_state2.State) FrameReader {
+    maxLen := f.MaxLen
+    if maxLen <= 0 {
+        maxLen = RECV_BUF_LEN
+    }
+    return &varintReader{
+        r:          bufio.NewReader(r),
+        buff:       make([]byte, maxLen),
+        tcpState:   tcpState,
+    }
+}
+
+func (f *VarintFramer) WriteFrame(w io.Writer, msg []byte) error {
+    buff := make([]byte, binary.MaxVarintLen64 + len(msg))
+    n := binary.PutUvarint(buff, uint64(len(msg)))
+    n += copy(buff[n:], msg)
+    return frameWrite(w, buff[:n])
+}
+
+type varintReader struct {
+    r           *bufio.Reader
+    buff        []byte
+    reqId       uint32
+    tcpState    *module_state2.State
+}
+
+func (vr *varintReader) ReadFrame() (MsgHeader, []byte, error) {
+    length, err := binary.ReadUvarint(vr.r)
+    if err != nil {
+        stateInc(vr.tcpState, "TCP_READ_HEADER_ERR")
+        return MsgHeader{}, nil, noDataCloseCheck(err)
+    }
+
+    if length > uint64(len(vr.buff)) {
+        stateInc(vr.tcpState, "TCP_BODY_TOOLONG_ERR")
+        if _, err := io.CopyN(ioutil.Discard, vr.r, int64(length)); err != nil {
+            stateInc(vr.tcpState, "TCP_READ_BYPASS_ERR")
+            return MsgHeader{}, nil, err
+        }
+        return MsgHeader{}, nil, ErrFrameBypassed
+    }
+
+    body := vr.buff[:length]
+    if _, err := io.ReadFull(vr.r, body); err != nil {
+        stateInc(vr.tcpState, "TCP_READ_BODY_ERR")
+        return MsgHeader{}, nil, err
+    }
+    header := frameHeaderMake(vr.reqId, len(body))
+    vr.reqId++
+    return header, body, nil
+}
+
+func (vr *varintReader) Buffered() int {
+    return vr.r.Buffered()
+}
+
+// B2logFramer is for msgs of b2log records
+// Broken data between records is bypassed, and counted by TCP_B2LOG_SKIP_BYTES.
+type B2logFramer struct {
+}
+
+func (f *B2logFramer) NewFrameReader(r io.Reader, tcpState *module_state2.State) FrameReader {
+    br := b2log.NewReader(r)
+    if tcpState != nil {
+        br.SetSkipHandler(func(offset int64, size int64) {
+            tcpState.Inc("TCP_B2LOG_SKIP_BYTES", int(size))
+        })
+    }
+    return &b2logReader{r: br, tcpState: tcpState}
+}
+
+func (f *B2logFramer) WriteFrame(w io.Writer, msg []byte) error {
+    _, err := b2log.NewWriter(w).Write(msg)
+    return err
+}
+
+type b2logReader struct {
+    r           *b2log.Reader
+    reqId       uint32
+    tcpState    *module_state2.State
+}
+
+func (br *b2logReader) ReadFrame() (MsgHeader, []byte, error) {
+    record, err := br.r.Read()
+    if err == b2log.ErrCompressed || err == b2log.ErrDecompress {
+        stateInc(br.tcpState, "TCP_B2LOG_RECORD_ERR")
+        return MsgHeader{}, nil, ErrFrameBypassed
+    }
+    if err != nil {
+        stateInc(br.tcpState, "TCP_READ_BODY_ERR")
+        return MsgHeader{}, nil, noDataCloseCheck(err)
+    }
+
+    header := frameHeaderMake(br.reqId, len(record))
+    br.reqId++
+    return header, record, nil
+}
+
+func (br *b2logReader) Buffered() int {
+    return br.r.Buffered()
+}
@@ -4,6 +4,8 @@ modification history
 --------------------
 2014/3/12, by Zhang Miao, create
 2014/8/6, by Zhang Miao, move from waf_server
+2026/10/18, by agent, modify
+    - magic string of each server is kept in MsgHeaderFramer, see framer.go
 */
 /*
 DESCRIPTION
@@ -33,6 +35,8 @@ type MsgHeader struct {
 }
 
 // modify the global MAGIC_STR
+// It is used by servers created after calling MagicStrSet(). For different
+// magic strings in one process, use WithMagicStr() or MsgHeaderFramer.
 func MagicStrSet(magicStr [4]byte) {
     MAGIC_STR = magicStr
 }
@@ -63,22 +67,7 @@ func MsgHeaderEncode(header MsgHeader) ([]byte, error) {
 
 /* make header of request msg    */
 func RequestHeaderMake(reqId uint32, bodyLen int, needResponse bool) ([]byte, error) {
-    var header MsgHeader
-    
-    header.MagicStr = MAGIC_STR
-    
-    if needResponse {
-        header.MsgType = MSG_TYPE_REQUEST
-    } else {
-        header.MsgType = MSG_TYPE_REQUEST_NO_RESPONSE
-    }
-    
-    header.ReqId = reqId
-    header.MsgSize = uint32(MSG_HEADER_LEN +  bodyLen)
-
-    buff, err := MsgHeaderEncode(header)
-    
-    return buff, err
+    return NewMsgHeaderFramer(MAGIC_STR).RequestHeaderMake(reqId, bodyLen, needResponse)
 }
 
 /* convert from binary buffer to MsgHeader  */
@@ -93,13 +82,5 @@ func MsgHeaderDecode(buf []byte) (MsgHeader, error) {
 
 /* make header of response msg    */
 func ResponseHeaderMake(reqId uint32, bodyLen int) ([]byte, error) {
-    var header MsgHeader
-    header.MagicStr = MAGIC_STR
-    header.MsgType = MSG_TYPE_RESPONSE
-    header.ReqId = reqId
-    header.MsgSize = uint32(MSG_HEADER_LEN +  bodyLen)
-
-    buff, err := MsgHeaderEncode(header)
-    
-    return buff, err
+    return NewMsgHeaderFramer(MAGIC_STR).ResponseHeaderMake(reqId, bodyLen)
 }
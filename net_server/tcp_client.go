@@ -0,0 +1,518 @@
+/* tcp_client.go - client for the MsgHeader protocol of TcpServer  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Client sends requests to TcpServer with the same magic string, over one
+connection. Requests are pipelined, i.e., a request is sent without waiting
+for responses of former requests, and responses are matched with requests by
+ReqId, so they may be returned in any order.
+
+- MSG_TYPE_REQUEST: by Call(), CallContext() or Go(), waiting for response
+- MSG_TYPE_REQUEST_NO_RESPONSE: by Send(), no response expected
+
+Connection is established on the first request. If the connection is broken,
+pending calls fail, and a new connection is established on the next request.
+Dialing is not retried within reconnect interval after a failure, the error
+of last dialing is returned instead.
+
+Request of CallContext() or Call() is written with deadline of the call; if
+writing times out, the call fails with ErrCallTimeout, and the connection is
+closed, for part of the request may have been written.
+
+Response with body longer than max response length (RECV_BUF_LEN by default)
+is discarded, and the call fails with ErrResponseTooLarge.
+
+Counters are kept in StateGet():
+- CLIENT_DIAL_SUCC        : connections established
+- CLIENT_DIAL_FAIL        : dials failed
+- CLIENT_CONN_BROKEN      : connections broken (not closed by Client)
+- CLIENT_CALL_TIMEOUT     : calls timeout
+- CLIENT_RESPONSE_DISCARD : responses without pending call, e.g., timeout
+- CLIENT_WRITE_TIMEOUT    : writes of requests timeout
+- CLIENT_RESPONSE_TOOLONG : responses discarded for body too long
+
+Usage:
+    client := NewClient("tcp", "127.0.0.1:8080",
+                        WithClientDialTimeout(time.Second))
+    defer client.Close()
+
+    // wait for response
+    response, err := client.Call(request, 100 * time.Millisecond)
+
+    // no response
+    err = client.Send(request)
+*/
+package net_server
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net"
+    "sync"
+    "time"
+)
+
+import (
+    "www.baidu.com/golang-lib/log"
+    "www.baidu.com/golang-lib/module_state2"
+)
+
+var (
+    ErrClientClosed     = errors.New("net_server: client closed")
+    ErrCallTimeout      = errors.New("net_server: call timeout")
+    ErrResponseTooLarge = errors.New("net_server: response too large")
+)
+
+// default options of Client
+const (
+    CLIENT_DIAL_TIMEOUT         = 1 * time.Second
+    CLIENT_RECONNECT_INTERVAL   = 100 * time.Millisecond
+    CLIENT_MAX_RESPONSE_LEN     = RECV_BUF_LEN
+)
+
+// Call represents a request waiting for response
+type Call struct {
+    ReqId       uint32      // ID of request
+    Request     []byte      // body of request
+    Response    []byte      // body of response
+    Error       error       // error of the call, after it is done
+    Done        chan *Call  // receives the call when it is done
+
+    conn        *clientConn // connection the request is sent on
+    deadline    time.Time   // deadline of writing request, zero for no deadline
+}
+
+/* notify that the call is done, never block    */
+func (call *Call) done() {
+    select {
+    case call.Done <- call:
+    default:
+        // Done should be buffered, see Go()
+    }
+}
+
+// a connection of Client
+type clientConn struct {
+    conn        net.Conn
+    sendLock    sync.Mutex          // for writing msg as a whole
+    pending     map[uint32]*Call    // calls waiting for response, protected by Client.lock
+}
+
+// option for creating Client
+type ClientOption func(*Client)
+
+// WithClientMagicStr sets magic string in MsgHeader, instead of the global MAGIC_STR
+func WithClientMagicStr(magicStr [4]byte) ClientOption {
+    return func(c *Client) {
+        c.framer = NewMsgHeaderFramer(magicStr)
+    }
+}
+
+// WithClientDialTimeout sets timeout of dialing to server
+func WithClientDialTimeout(timeout time.Duration) ClientOption {
+    return func(c *Client) {
+        c.dialTimeout = timeout
+    }
+}
+
+// WithClientReconnectInterval sets min interval of dialing after a failure
+func WithClientReconnectInterval(interval time.Duration) ClientOption {
+    return func(c *Client) {
+        c.reconnectInterval = interval
+    }
+}
+
+// WithClientMaxResponseLen sets max length of response body
+func WithClientMaxResponseLen(maxLen int) ClientOption {
+    return func(c *Client) {
+        c.maxResponseLen = maxLen
+    }
+}
+
+// Client of TcpServer, may be used by multiple go-routines simultaneously
+type Client struct {
+    netType             string
+    addr                string
+    framer              *MsgHeaderFramer    // for making and checking MsgHeader
+    dialTimeout         time.Duration
+    reconnectInterval   time.Duration
+    maxResponseLen      int                 // max length of response body
+
+    lock        sync.Mutex      // protect following fields, and pending of conns
+    conn        *clientConn     // current connection, nil if not connected
+    reqId       uint32          // ID of next request
+    dialTime    time.Time       // time of last failed dialing
+    dialErr     error           // error of last failed dialing
+    closed      bool            // client is closed
+
+    state       module_state2.State
+}
+
+/*
+* NewClient - create Client, connection is established on the first request
+*
+* PARAMS:
+*   - netType: "tcp", "tcp4", "tcp6" or "unix"
+*   - addr: address of TcpServer
+*   - opts: options of client, e.g., WithClientDialTimeout()
+*
+* RETURNS:
+*   Client
+*/
+func NewClient(netType, addr string, opts ...ClientOption) *Client {
+    c := new(Client)
+    c.netType = netType
+    c.addr = addr
+    c.framer = NewMsgHeaderFramer(MAGIC_STR)
+    c.dialTimeout = CLIENT_DIAL_TIMEOUT
+    c.reconnectInterval = CLIENT_RECONNECT_INTERVAL
+    c.maxResponseLen = CLIENT_MAX_RESPONSE_LEN
+    c.state.Init()
+
+    for _, opt := range opts {
+        opt(c)
+    }
+
+    return c
+}
+
+// StateGet returns counters of client
+func (c *Client) StateGet() *module_state2.State {
+    return &c.state
+}
+
+/*
+* connGet - get current connection, dial to server if not connected
+*   Note: c.lock should be held; it is released while dialing
+*
+* RETURNS:
+*   (conn, nil), if succeed
+*   (nil, error), if fail
+*/
+func (c *Client) connGet() (*clientConn, error) {
+    if c.closed {
+        return nil, ErrClientClosed
+    }
+    if c.conn != nil {
+        return c.conn, nil
+    }
+    if c.dialErr != nil && time.Since(c.dialTime) < c.reconnectInterval {
+        return nil, c.dialErr
+    }
+
+    // not to block other calls and Close() while dialing
+    c.lock.Unlock()
+    conn, err := net.DialTimeout(c.netType, c.addr, c.dialTimeout)
+    c.lock.Lock()
+
+    if err != nil {
+        c.state.Inc("CLIENT_DIAL_FAIL", 1)
+        c.dialTime = time.Now()
+        c.dialErr = fmt.Errorf("dial %s: %s", c.addr, err.Error())
+        return nil, c.dialErr
+    }
+    c.state.Inc("CLIENT_DIAL_SUCC", 1)
+    c.dialErr = nil
+
+    // client may be closed, or connected by other call, while dialing
+    if c.closed {
+        conn.Close()
+        return nil, ErrClientClosed
+    }
+    if c.conn != nil {
+        conn.Close()
+        return c.conn, nil
+    }
+
+    c.conn = &clientConn{conn: conn, pending: make(map[uint32]*Call)}
+    go c.recver(c.conn)
+    return c.conn, nil
+}
+
+/*
+* send - send request to server
+*
+* PARAMS:
+*   - call: call for the request
+*   - needResponse: whether response is expected
+*
+* RETURNS:
+*   nil, if succeed
+*   error, if fail
+*/
+func (c *Client) send(call *Call, needResponse bool) error {
+    c.lock.Lock()
+    cc, err := c.connGet()
+    if err != nil {
+        c.lock.Unlock()
+        return err
+    }
+    call.ReqId = c.reqId
+    call.conn = cc
+    c.reqId++
+    if needResponse {
+        cc.pending[call.ReqId] = call
+    }
+    c.lock.Unlock()
+
+    header, err := c.framer.RequestHeaderMake(call.ReqId, len(call.Request), needResponse)
+    if err == nil {
+        cc.sendLock.Lock()
+        err = cc.conn.SetWriteDeadline(call.deadline)
+        if err == nil {
+            err = WriteMsg(cc.conn, append(header, call.Request...))
+        }
+        cc.sendLock.Unlock()
+    }
+    if isTimeout(err) {
+        c.state.Inc("CLIENT_WRITE_TIMEOUT", 1)
+        err = ErrCallTimeout
+    }
+    if err != nil {
+        removed := c.pendingRemove(call)
+        // other pending calls are terminated by recver()
+        cc.conn.Close()
+        if needResponse && !removed {
+            // call is terminated by recver() already
+            return nil
+        }
+        return err
+    }
+    return nil
+}
+
+/* remove call from pending, return false if it is done already */
+func (c *Client) pendingRemove(call *Call) bool {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+
+    if call.conn == nil || call.conn.pending[call.ReqId] != call {
+        return false
+    }
+    delete(call.conn.pending, call.ReqId)
+    return true
+}
+
+/*
+* responseRead - read response from connection
+*
+* PARAMS:
+*   - conn: connection to server
+*   - buff: buffer for header
+*
+* RETURNS:
+*   (header, body, nil), if succeed
+*   (header, nil, ErrResponseTooLarge), if body is too long, and discarded
+*   (header, nil, error), if fail
+*/
+func (c *Client) responseRead(conn net.Conn, buff []byte) (MsgHeader, []byte, error) {
+    if _, err := io.ReadFull(conn, buff[:MSG_HEADER_LEN]); err != nil {
+        return MsgHeader{}, nil, err
+    }
+    header, err := MsgHeaderDecode(buff[:MSG_HEADER_LEN])
+    if err != nil {
+        return header, nil, err
+    }
+    if header.MagicStr != c.framer.MagicStr {
+        return header, nil, ErrMagicStr
+    }
+    if header.MsgType != MSG_TYPE_RESPONSE {
+        return header, nil, fmt.Errorf("msg type is not response[%d]", header.MsgType)
+    }
+
+    bodyLen := int(header.MsgSize) - MSG_HEADER_LEN
+    if bodyLen < 0 {
+        return header, nil, fmt.Errorf("bodyLen = %d", bodyLen)
+    }
+    if bodyLen > c.maxResponseLen {
+        // discard body, next response could still be read
+        if _, err := io.CopyN(ioutil.Discard, conn, int64(bodyLen)); err != nil {
+            return header, nil, err
+        }
+        return header, nil, ErrResponseTooLarge
+    }
+    body := make([]byte, bodyLen)
+    if _, err := io.ReadFull(conn, body); err != nil {
+        return header, nil, err
+    }
+    return header, body, nil
+}
+
+/*  recver - handle responses of a connection, until it is broken  */
+func (c *Client) recver(cc *clientConn) {
+    var err error
+    buff := make([]byte, MSG_HEADER_LEN)
+
+    for {
+        var header MsgHeader
+        var body []byte
+        header, body, err = c.responseRead(cc.conn, buff)
+        if err == ErrResponseTooLarge {
+            c.state.Inc("CLIENT_RESPONSE_TOOLONG", 1)
+        } else if err != nil {
+            break
+        }
+
+        c.lock.Lock()
+        call := cc.pending[header.ReqId]
+        delete(cc.pending, header.ReqId)
+        c.lock.Unlock()
+
+        if call == nil {
+            c.state.Inc("CLIENT_RESPONSE_DISCARD", 1)
+            continue
+        }
+        call.Response = body
+        if err == ErrResponseTooLarge {
+            call.Error = err
+        }
+        call.done()
+    }
+    cc.conn.Close()
+
+    // terminate pending calls
+    c.lock.Lock()
+    if c.conn == cc {
+        c.conn = nil
+    }
+    if c.closed {
+        err = ErrClientClosed
+    } else {
+        c.state.Inc("CLIENT_CONN_BROKEN", 1)
+        log.Logger.Warn("Client.recver(): %s connection broken: %s", c.addr, err.Error())
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+    }
+    for reqId, call := range cc.pending {
+        call.Error = err
+        call.done()
+        delete(cc.pending, reqId)
+    }
+    c.lock.Unlock()
+}
+
+/*
+* Go - send request asynchronously
+*
+* PARAMS:
+*   - request: body of request
+*   - done: receives the call when it is done; if nil, a new channel is
+*     allocated; if not nil, it must be buffered
+*
+* RETURNS:
+*   Call for the request
+*/
+func (c *Client) Go(request []byte, done chan *Call) *Call {
+    return c.callStart(request, done, time.Time{})
+}
+
+/* send request asynchronously, request is written with deadline, see Go()   */
+func (c *Client) callStart(request []byte, done chan *Call, deadline time.Time) *Call {
+    if done == nil {
+        done = make(chan *Call, 1)
+    }
+    call := &Call{Request: request, Done: done, deadline: deadline}
+
+    if err := c.send(call, true); err != nil {
+        call.Error = err
+        call.done()
+    }
+    return call
+}
+
+/*
+* Call - send request, and wait for response
+*
+* PARAMS:
+*   - request: body of request
+*   - timeout: timeout of waiting for response
+*
+* RETURNS:
+*   (response, nil), if succeed
+*   (nil, ErrCallTimeout), if timeout
+*   (nil, error), if fail
+*/
+func (c *Client) Call(request []byte, timeout time.Duration) ([]byte, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    return c.CallContext(ctx, request)
+}
+
+/*
+* CallContext - send request, and wait for response or ctx to be done
+*
+* PARAMS:
+*   - ctx: context for deadline and cancellation
+*   - request: body of request
+*
+* RETURNS:
+*   (response, nil), if succeed
+*   (nil, ErrCallTimeout), if deadline of ctx exceeded
+*   (nil, ErrResponseTooLarge), if response is too long
+*   (nil, context.Canceled), if ctx cancelled
+*   (nil, error), if fail
+*/
+func (c *Client) CallContext(ctx context.Context, request []byte) ([]byte, error) {
+    deadline, _ := ctx.Deadline()
+    call := c.callStart(request, nil, deadline)
+
+    select {
+    case <-call.Done:
+        return call.Response, call.Error
+    case <-ctx.Done():
+        if !c.pendingRemove(call) {
+            // done while ctx is done
+            <-call.Done
+            return call.Response, call.Error
+        }
+        if ctx.Err() == context.DeadlineExceeded {
+            c.state.Inc("CLIENT_CALL_TIMEOUT", 1)
+            return nil, ErrCallTimeout
+        }
+        return nil, ctx.Err()
+    }
+}
+
+/*
+* Send - send request without waiting for response, i.e., MSG_TYPE_REQUEST_NO_RESPONSE
+*
+* PARAMS:
+*   - request: body of request
+*
+* RETURNS:
+*   nil, if request is written to connection
+*   error, if fail
+*/
+func (c *Client) Send(request []byte) error {
+    return c.send(&Call{Request: request}, false)
+}
+
+/*
+* Close - close client, pending calls fail with ErrClientClosed
+*
+* RETURNS:
+*   nil, if succeed
+*   ErrClientClosed, if client is closed already
+*/
+func (c *Client) Close() error {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+
+    if c.closed {
+        return ErrClientClosed
+    }
+    c.closed = true
+    if c.conn != nil {
+        c.conn.conn.Close()
+    }
+    return nil
+}
@@ -0,0 +1,261 @@
+/* tcp_client_test.go - test for tcp_client.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package net_server
+
+import (
+    "context"
+    "net"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+import (
+    "www.baidu.com/golang-lib/module_state2"
+)
+
+/* callbacks of echo server, response of "slow" is delayed */
+type slowEchoCallBacks struct {
+    echoCallBacks
+    recvNum     int32
+}
+
+func (cb *slowEchoCallBacks) RecvMsgProc(header MsgHeader, body []byte, tcpConn TcpConn,
+                                         tcpState *module_state2.State) error {
+    atomic.AddInt32(&cb.recvNum, 1)
+    if string(body) != "slow" || header.MsgType != MSG_TYPE_REQUEST {
+        return cb.echoCallBacks.RecvMsgProc(header, body, tcpConn, tcpState)
+    }
+
+    go func() {
+        time.Sleep(100 * time.Millisecond)
+        tcpConn.Send(&echoResponse{header.ReqId, []byte("slow")})
+    }()
+    return nil
+}
+
+/* start server with slowEchoCallBacks, and create client to it */
+func prepareClient(t *testing.T, opts ...ClientOption) (*TcpServer, *slowEchoCallBacks, *Client) {
+    callBacks := new(slowEchoCallBacks)
+    srv := NewTcpServer(callBacks)
+    if err := srv.ListenAndServe2("tcp", "127.0.0.1:0"); err != nil {
+        t.Fatalf("ListenAndServe2(): %s", err.Error())
+    }
+    client := NewClient("tcp", srv.Listener.Addr().String(), opts...)
+    return srv, callBacks, client
+}
+
+/* wait until f returns true    */
+func waitUntil(f func() bool) bool {
+    for i := 0; i < 200; i++ {
+        if f() {
+            return true
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    return false
+}
+
+func TestClientPipeline(t *testing.T) {
+    srv, callBacks, client := prepareClient(t)
+    defer srv.Shutdown(context.Background())
+    defer client.Close()
+
+    // response of fast request is returned before slow one
+    slow := client.Go([]byte("slow"), nil)
+    fast := client.Go([]byte("fast"), nil)
+    select {
+    case <-fast.Done:
+    case <-slow.Done:
+        t.Fatalf("slow call should be done later")
+    }
+    <-slow.Done
+    if string(fast.Response) != "fast" || string(slow.Response) != "slow" ||
+            fast.Error != nil || slow.Error != nil {
+        t.Errorf("unexpected responses: %s %v, %s %v",
+                 fast.Response, fast.Error, slow.Response, slow.Error)
+    }
+
+    // request without response
+    if err := client.Send([]byte("hello")); err != nil {
+        t.Fatalf("Send(): %s", err.Error())
+    }
+    if !waitUntil(func() bool { return atomic.LoadInt32(&callBacks.recvNum) == 3 }) {
+        t.Errorf("request should be received by server")
+    }
+    if response, err := client.Call([]byte("world"), time.Second); err != nil || string(response) != "world" {
+        t.Errorf("Call(): %s %v", response, err)
+    }
+    if n := client.StateGet().GetCounter("CLIENT_DIAL_SUCC"); n != 1 {
+        t.Errorf("requests should be sent over one connection, got %d", n)
+    }
+}
+
+func TestClientTimeout(t *testing.T) {
+    srv, _, client := prepareClient(t)
+    defer srv.Shutdown(context.Background())
+    defer client.Close()
+
+    if _, err := client.Call([]byte("slow"), 20 * time.Millisecond); err != ErrCallTimeout {
+        t.Errorf("err should be ErrCallTimeout, got %v", err)
+    }
+
+    // late response is discarded
+    if !waitUntil(func() bool {
+        return client.StateGet().GetCounter("CLIENT_RESPONSE_DISCARD") == 1
+    }) {
+        t.Errorf("late response should be discarded")
+    }
+    if response, err := client.Call([]byte("hello"), time.Second); err != nil || string(response) != "hello" {
+        t.Errorf("Call(): %s %v", response, err)
+    }
+}
+
+func TestClientReconnect(t *testing.T) {
+    srv, _, client := prepareClient(t)
+    defer srv.Shutdown(context.Background())
+    defer client.Close()
+
+    // pending call fails when connection is broken
+    slow := client.Go([]byte("slow"), nil)
+    if !connNumWait(srv, 1) {
+        t.Fatalf("connection should be added")
+    }
+    for _, tcpConn := range srv.tcpTable.GetAll() {
+        srv.removeTcpConn(tcpConn.info.conn)
+    }
+    <-slow.Done
+    if slow.Error == nil {
+        t.Errorf("pending call should fail")
+    }
+
+    if !waitUntil(func() bool {
+        return client.StateGet().GetCounter("CLIENT_CONN_BROKEN") == 1
+    }) {
+        t.Fatalf("broken connection should be counted")
+    }
+    if response, err := client.Call([]byte("hello"), time.Second); err != nil || string(response) != "hello" {
+        t.Errorf("Call() after reconnect: %s %v", response, err)
+    }
+    if n := client.StateGet().GetCounter("CLIENT_DIAL_SUCC"); n != 2 {
+        t.Errorf("client should reconnect, got %d dials", n)
+    }
+}
+
+func TestClientWriteTimeout(t *testing.T) {
+    // server never reads
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Listen(): %s", err.Error())
+    }
+    defer l.Close()
+    go func() {
+        conn, err := l.Accept()
+        if err == nil {
+            defer conn.Close()
+            time.Sleep(2 * time.Second)
+        }
+    }()
+
+    client := NewClient("tcp", l.Addr().String())
+    defer client.Close()
+
+    // request is larger than socket buffers
+    request := make([]byte, 64 * 1024 * 1024)
+    start := time.Now()
+    if _, err := client.Call(request, 100 * time.Millisecond); err != ErrCallTimeout {
+        t.Errorf("err should be ErrCallTimeout, got %v", err)
+    }
+    if d := time.Since(start); d > time.Second {
+        t.Errorf("Call() should return at deadline, got %v", d)
+    }
+    if client.StateGet().GetCounter("CLIENT_WRITE_TIMEOUT") != 1 {
+        t.Errorf("write timeout should be counted")
+    }
+}
+
+func TestClientResponseTooLarge(t *testing.T) {
+    srv, _, client := prepareClient(t, WithClientMaxResponseLen(4))
+    defer srv.Shutdown(context.Background())
+    defer client.Close()
+
+    if _, err := client.Call([]byte("hello"), time.Second); err != ErrResponseTooLarge {
+        t.Errorf("err should be ErrResponseTooLarge, got %v", err)
+    }
+    if client.StateGet().GetCounter("CLIENT_RESPONSE_TOOLONG") != 1 {
+        t.Errorf("discarded response should be counted")
+    }
+
+    // next response is read over the same connection
+    if response, err := client.Call([]byte("hi"), time.Second); err != nil || string(response) != "hi" {
+        t.Errorf("Call(): %s %v", response, err)
+    }
+    if n := client.StateGet().GetCounter("CLIENT_DIAL_SUCC"); n != 1 {
+        t.Errorf("connection should be kept, got %d dials", n)
+    }
+}
+
+func TestClientDialFail(t *testing.T) {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Listen(): %s", err.Error())
+    }
+    addr := l.Addr().String()
+    l.Close()
+
+    client := NewClient("tcp", addr, WithClientReconnectInterval(time.Hour))
+    defer client.Close()
+    for i := 0; i < 2; i++ {
+        if _, err := client.Call([]byte("hello"), time.Second); err == nil {
+            t.Errorf("Call() should fail")
+        }
+    }
+    if n := client.StateGet().GetCounter("CLIENT_DIAL_FAIL"); n != 1 {
+        t.Errorf("dialing should not be retried in reconnect interval, got %d", n)
+    }
+}
+
+func TestClientMagicStr(t *testing.T) {
+    srv, _, client := prepareClient(t, WithClientMagicStr([4]byte{1, 2, 3, 4}))
+    defer srv.Shutdown(context.Background())
+    defer client.Close()
+
+    if _, err := client.Call([]byte("hello"), time.Second); err == nil || err == ErrCallTimeout {
+        t.Errorf("call with wrong magic string should be refused, got %v", err)
+    }
+    if !waitUntil(func() bool {
+        return srv.TcpStateGet().GetCounter("TCP_HEADER_MAGIC_ERR") == 1
+    }) {
+        t.Errorf("wrong magic string should be counted")
+    }
+}
+
+func TestClientClose(t *testing.T) {
+    srv, _, client := prepareClient(t)
+    defer srv.Shutdown(context.Background())
+
+    slow := client.Go([]byte("slow"), nil)
+    if !connNumWait(srv, 1) {
+        t.Fatalf("connection should be added")
+    }
+    if err := client.Close(); err != nil {
+        t.Fatalf("Close(): %s", err.Error())
+    }
+    <-slow.Done
+    if slow.Error != ErrClientClosed {
+        t.Errorf("err should be ErrClientClosed, got %v", slow.Error)
+    }
+    if _, err := client.Call([]byte("hello"), time.Second); err != ErrClientClosed {
+        t.Errorf("err should be ErrClientClosed, got %v", err)
+    }
+    if err := client.Close(); err != ErrClientClosed {
+        t.Errorf("err should be ErrClientClosed, got %v", err)
+    }
+}
@@ -0,0 +1,163 @@
+/* tcp_conn_monitor.go - web_monitor handlers for connections of TcpServer  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Connections of TcpServer may be inspected and closed through web_monitor:
+- monitor handler <prefix>_conns: list state of connections, in json
+    - remote_addr: only connections with remote address containing it
+    - sort: order of connections
+        - remote_addr: by remote address (default)
+        - connect_time: oldest connection first
+        - last_active: least recently active connection first
+        - queue_len: longest send queue first
+- reload handler <prefix>_conn_close: force close connections
+    - remote_addr: remote address of connections to close, e.g., 10.1.1.1:34567
+
+Force closed connections are counted by TCP_CONN_FORCE_CLOSE in tcpState.
+
+Usage:
+    err := srv.MonitorHandlersRegister(monitorServer, "tcp")
+
+    // curl "http://127.0.0.1:8421/monitor/tcp_conns?sort=last_active"
+    // curl "http://127.0.0.1:8421/reload/tcp_conn_close?remote_addr=10.1.1.1:34567"
+*/
+package net_server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+import (
+    "www.baidu.com/golang-lib/web_monitor"
+)
+
+var ErrConnNotFound = errors.New("net_server: connection not found")
+
+// less functions for sorting TcpConnState, by value of param "sort"
+var connStateLess = map[string]func(a, b *TcpConnState) bool{
+    "remote_addr": func(a, b *TcpConnState) bool {
+        return a.RemoteAddr < b.RemoteAddr
+    },
+    "connect_time": func(a, b *TcpConnState) bool {
+        return a.ConnectTime.Before(b.ConnectTime)
+    },
+    "last_active": func(a, b *TcpConnState) bool {
+        return a.LastActiveTime.Before(b.LastActiveTime)
+    },
+    "queue_len": func(a, b *TcpConnState) bool {
+        return a.QueueLen > b.QueueLen
+    },
+}
+
+/*
+* ConnStatesGet - get state of connections
+*
+* PARAMS:
+*   - remoteAddr: only connections with remote address containing it, all if ""
+*   - sortBy: order of connections, see connStateLess
+*
+* RETURNS:
+*   (states, nil), if succeed
+*   (nil, error), if sortBy is invalid
+*/
+func (srv *TcpServer) ConnStatesGet(remoteAddr string, sortBy string) ([]TcpConnState, error) {
+    less, ok := connStateLess[sortBy]
+    if !ok {
+        return nil, fmt.Errorf("invalid sort:%s", sortBy)
+    }
+
+    states := make([]TcpConnState, 0)
+    for _, state := range srv.tcpTable.GetState() {
+        if strings.Contains(state.RemoteAddr, remoteAddr) {
+            states = append(states, state)
+        }
+    }
+
+    sort.SliceStable(states, func(i, j int) bool {
+        return less(&states[i], &states[j])
+    })
+    return states, nil
+}
+
+/*
+* ConnClose - force close connections with given remote address
+*   Msgs in send queues are dropped.
+*
+* PARAMS:
+*   - remoteAddr: remote address of connections
+*
+* RETURNS:
+*   (number of connections closed, nil), if succeed
+*   (0, ErrConnNotFound), if no connection with remoteAddr
+*/
+func (srv *TcpServer) ConnClose(remoteAddr string) (int, error) {
+    num := 0
+    for _, tcpConn := range srv.tcpTable.GetAll() {
+        if tcpConn.RemoteAddr != remoteAddr {
+            continue
+        }
+        tcpConn.info.errSet(errors.New("force closed"))
+        srv.removeTcpConn(tcpConn.info.conn)
+        srv.tcpState.Inc("TCP_CONN_FORCE_CLOSE", 1)
+        num++
+    }
+
+    if num == 0 {
+        return 0, ErrConnNotFound
+    }
+    return num, nil
+}
+
+/* monitor handler for listing connections  */
+func (srv *TcpServer) connsHandler(params map[string][]string) ([]byte, error) {
+    remoteAddr, _ := web_monitor.ParamsValueGet(params, "remote_addr")
+    sortBy, err := web_monitor.ParamsValueGet(params, "sort")
+    if err != nil {
+        sortBy = "remote_addr"
+    }
+
+    states, err := srv.ConnStatesGet(remoteAddr, sortBy)
+    if err != nil {
+        return nil, err
+    }
+    return json.Marshal(states)
+}
+
+/* reload handler for force closing connections */
+func (srv *TcpServer) connCloseHandler(params map[string][]string) error {
+    remoteAddr, err := web_monitor.ParamsValueGet(params, "remote_addr")
+    if err != nil {
+        return fmt.Errorf("remote_addr: %s", err.Error())
+    }
+
+    _, err = srv.ConnClose(remoteAddr)
+    return err
+}
+
+/*
+* MonitorHandlersRegister - register handlers of connections to web_monitor
+*
+* PARAMS:
+*   - ms: monitor server
+*   - prefix: prefix of command; handlers are <prefix>_conns (monitor) and
+*     <prefix>_conn_close (reload)
+*
+* RETURNS:
+*   nil, if succeed
+*   error, if fail
+*/
+func (srv *TcpServer) MonitorHandlersRegister(ms *web_monitor.MonitorServer, prefix string) error {
+    err := ms.RegisterHandler(web_monitor.WEB_HANDLE_MONITOR, prefix + "_conns", srv.connsHandler)
+    if err != nil {
+        return err
+    }
+    return ms.RegisterHandler(web_monitor.WEB_HANDLE_RELOAD, prefix + "_conn_close", srv.connCloseHandler)
+}
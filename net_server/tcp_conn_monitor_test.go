@@ -0,0 +1,113 @@
+/* tcp_conn_monitor_test.go - test for tcp_conn_monitor.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package net_server
+
+import (
+    "context"
+    "encoding/json"
+    "net"
+    "testing"
+    "time"
+)
+
+import (
+    "www.baidu.com/golang-lib/web_monitor"
+)
+
+func TestConnStatesGet(t *testing.T) {
+    srv := prepareEchoServer(t, 0)
+    defer srv.Shutdown(context.Background())
+    addr := srv.Listener.Addr().String()
+
+    conns := make([]net.Conn, 0)
+    for i := 0; i < 3; i++ {
+        conn, ok := dialAndCheck(t, addr)
+        defer conn.Close()
+        if !ok {
+            t.Fatalf("connection should be accepted")
+        }
+        conns = append(conns, conn)
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    // traffic of connection, recorded after response is written
+    var states []TcpConnState
+    var err error
+    if !waitUntil(func() bool {
+        states, err = srv.ConnStatesGet(conns[0].LocalAddr().String(), "remote_addr")
+        return err == nil && len(states) == 1 && states[0].MsgsOut == 1
+    }) {
+        t.Fatalf("ConnStatesGet(): %v %v", states, err)
+    }
+    state := states[0]
+    msgLen := int64(MSG_HEADER_LEN + len("hello"))
+    if state.MsgsIn != 1 || state.MsgsOut != 1 || state.BytesIn != msgLen ||
+            state.BytesOut != msgLen || state.Error != "" {
+        t.Errorf("unexpected state: %+v", state)
+    }
+    if state.ConnectTime.IsZero() || state.LastActiveTime.Before(state.ConnectTime) {
+        t.Errorf("unexpected time of state: %+v", state)
+    }
+
+    // sorted by connect time, by monitor handler
+    data, err := srv.connsHandler(map[string][]string{"sort": {"connect_time"}})
+    if err != nil {
+        t.Fatalf("connsHandler(): %s", err.Error())
+    }
+    if err := json.Unmarshal(data, &states); err != nil {
+        t.Fatalf("json.Unmarshal(): %s", err.Error())
+    }
+    if len(states) != 3 {
+        t.Fatalf("unexpected states: %s", data)
+    }
+    for i, state := range states {
+        if state.RemoteAddr != conns[i].LocalAddr().String() {
+            t.Errorf("unexpected order of states: %s", data)
+        }
+    }
+
+    if _, err := srv.ConnStatesGet("", "unknown"); err == nil {
+        t.Errorf("invalid sort should fail")
+    }
+}
+
+func TestConnClose(t *testing.T) {
+    srv := prepareEchoServer(t, 0)
+    defer srv.Shutdown(context.Background())
+
+    conn, ok := dialAndCheck(t, srv.Listener.Addr().String())
+    defer conn.Close()
+    if !ok {
+        t.Fatalf("connection should be accepted")
+    }
+
+    ms := web_monitor.NewMonitorServer("test", "1.0", 0)
+    if err := srv.MonitorHandlersRegister(ms, "tcp"); err != nil {
+        t.Fatalf("MonitorHandlersRegister(): %s", err.Error())
+    }
+
+    if err := srv.connCloseHandler(map[string][]string{}); err == nil {
+        t.Errorf("remote_addr should be required")
+    }
+    params := map[string][]string{"remote_addr": {conn.LocalAddr().String()}}
+    if err := srv.connCloseHandler(params); err != nil {
+        t.Fatalf("connCloseHandler(): %s", err.Error())
+    }
+    if _, _, err := responseRead(conn); err == nil {
+        t.Errorf("connection should be closed by server")
+    }
+    if srv.TcpStateGet().GetCounter("TCP_CONN_FORCE_CLOSE") != 1 {
+        t.Errorf("force closed connection should be counted")
+    }
+
+    if err := srv.connCloseHandler(params); err != ErrConnNotFound {
+        t.Errorf("err should be ErrConnNotFound, got %v", err)
+    }
+}
@@ -4,6 +4,14 @@ modification history
 --------------------
 2014/3/10, by Zhang Miao, create
 2014/8/6, by Zhang Miao, move from waf_server
+2026/10/18, by agent, modify
+    - add tcpConnInfo shared by copies of TcpConn, for graceful shutdown
+2026/10/18, by agent, modify
+    - add PeerSubject() for tls connection
+2026/10/18, by agent, modify
+    - bounded send queue with overflow policy
+2026/10/18, by agent, modify
+    - add traffic, activity and error of connection to TcpConnState
 */
 /*
 DESCRIPTION
@@ -11,40 +19,263 @@ DESCRIPTION
 package net_server
 
 import (
+    "crypto/x509"
     "errors"
     "net"
     "sync"
+    "sync/atomic"
+    "time"
 )
 
 import (
+    "www.baidu.com/golang-lib/module_state2"
     "www.baidu.com/golang-lib/queue"
 )
 
+// overflow policy of send queue, see WithSendQueue()
+const (
+    SEND_QUEUE_BLOCK        = 0 // wait until send queue is not full
+    SEND_QUEUE_DROP_NEWEST  = 1 // drop msg to send
+    SEND_QUEUE_DROP_OLDEST  = 2 // drop the oldest msg in send queue
+    SEND_QUEUE_CLOSE        = 3 // close the connection
+)
+
+var (
+    ErrConnClosed       = errors.New("net_server: connection closed")
+    ErrSendQueueFull    = errors.New("net_server: send queue full")
+)
+
 type TcpConn struct {
-    SendQueue   queue.Queue // for send to client
+    SendQueue   *queue.Queue // for send to client
     LocalAddr   string      // local address
     RemoteAddr  string      // remote address
+
+    info        *tcpConnInfo // shared by copies of TcpConn
+}
+
+/* runtime info of tcp connection, shared by copies of TcpConn */
+type tcpConnInfo struct {
+    conn        net.Conn        // underlying connection
+    sendNum     int64           // number of msgs added to SendQueue
+    sentNum     int64           // number of msgs taken out of SendQueue, by sender or dropped
+    senderDone  chan struct{}   // closed when sender go-routine quits
+    closed      int32           // 1 if connection is closed, no more msg is accepted
+
+    tcpState        *module_state2.State    // state of server, may be nil
+    overflowPolicy  int                     // overflow policy of send queue
+    queueHighWater  int64                   // max length of send queue
+    dropNum         int64                   // number of msgs dropped
+
+    connectTime     time.Time   // time of connection accepted
+    bytesIn         int64       // bytes read from connection
+    bytesOut        int64       // bytes written to connection
+    msgsIn          int64       // msgs received
+    msgsOut         int64       // msgs sent
+    lastActive      int64       // time of last read or write, in unix nano
+
+    lock        sync.Mutex          // protect peerCerts and err
+    peerCerts   []*x509.Certificate // certificates of peer, for tls connection
+    err         string              // last error of connection
 }
 
 /* Initialize new TcpConn */
 func newTcpConn() TcpConn {
     tcpConn := TcpConn{}
     
+    tcpConn.SendQueue = new(queue.Queue)
     tcpConn.SendQueue.Init()
+    tcpConn.info = &tcpConnInfo{senderDone: make(chan struct{})}
         
     return tcpConn
 }
 
-// send out data via TcpConn
-func (conn *TcpConn) Send(data interface{}) {
+/* increase counter in state of server   */
+func (info *tcpConnInfo) stateInc(key string) {
+    if info.tcpState != nil {
+        info.tcpState.Inc(key, 1)
+    }
+}
+
+/* record msg dropped  */
+func (info *tcpConnInfo) drop(key string) {
+    atomic.AddInt64(&info.dropNum, 1)
+    info.stateInc(key)
+}
+
+/* record data read from connection    */
+func (info *tcpConnInfo) readRecord(n int) {
+    atomic.AddInt64(&info.bytesIn, int64(n))
+    atomic.StoreInt64(&info.lastActive, time.Now().UnixNano())
+}
+
+/* record data written to connection    */
+func (info *tcpConnInfo) writeRecord(n int) {
+    atomic.AddInt64(&info.bytesOut, int64(n))
+    atomic.StoreInt64(&info.lastActive, time.Now().UnixNano())
+}
+
+/* set last error of connection */
+func (info *tcpConnInfo) errSet(err error) {
+    info.lock.Lock()
+    info.err = err.Error()
+    info.lock.Unlock()
+}
+
+/* get last error of connection, "" if no error */
+func (info *tcpConnInfo) errGet() string {
+    info.lock.Lock()
+    defer info.lock.Unlock()
+    return info.err
+}
+
+/* update high-water mark of send queue    */
+func (info *tcpConnInfo) highWaterUpdate(queueLen int) {
+    for {
+        highWater := atomic.LoadInt64(&info.queueHighWater)
+        if int64(queueLen) <= highWater ||
+            atomic.CompareAndSwapInt64(&info.queueHighWater, highWater, int64(queueLen)) {
+            return
+        }
+    }
+}
+
+/*
+* Send - send out data via TcpConn
+*
+* PARAMS:
+*   - data: data to send, converted to msg by CallBacks.SendMsgMake()
+*
+* RETURNS:
+*   nil, if data is added to send queue
+*   ErrConnClosed, if connection is closed
+*   ErrSendQueueFull, if send queue is full, for SEND_QUEUE_DROP_NEWEST or SEND_QUEUE_CLOSE
+*/
+func (conn *TcpConn) Send(data interface{}) error {
     // prepare SendMsg
     msg := &SendMsg{
                 cmd: SEND_CMD_SEND,
                 data:data,
             }
 
+    // TcpConn not created by TcpConnTable
+    if conn.info == nil {
+        return conn.SendQueue.Append(msg)
+    }
+
+    if atomic.LoadInt32(&conn.info.closed) != 0 {
+        conn.info.drop("TCP_SEND_DROP_CLOSED")
+        return ErrConnClosed
+    }
+
     // add to sending queue
-    conn.SendQueue.Append(msg)
+    if err := conn.sendQueueAppend(msg); err != nil {
+        return err
+    }
+    atomic.AddInt64(&conn.info.sendNum, 1)
+    conn.info.highWaterUpdate(conn.SendQueue.Len())
+    return nil
+}
+
+/* add msg to send queue, according to overflow policy  */
+func (conn *TcpConn) sendQueueAppend(msg *SendMsg) error {
+    info := conn.info
+    err := conn.SendQueue.Append(msg)
+    if err == nil {
+        return nil
+    }
+    if err == queue.ErrQueueClosed {
+        info.drop("TCP_SEND_DROP_CLOSED")
+        return ErrConnClosed
+    }
+    info.stateInc("TCP_SEND_QUEUE_FULL")
+
+    switch info.overflowPolicy {
+    case SEND_QUEUE_BLOCK:
+        // fail if send queue is closed while waiting
+        if conn.SendQueue.AppendWait(msg) != nil {
+            info.drop("TCP_SEND_DROP_CLOSED")
+            return ErrConnClosed
+        }
+        return nil
+
+    case SEND_QUEUE_DROP_OLDEST:
+        for {
+            err := conn.SendQueue.Append(msg)
+            if err == nil {
+                break
+            }
+            if err == queue.ErrQueueClosed {
+                info.drop("TCP_SEND_DROP_CLOSED")
+                return ErrConnClosed
+            }
+
+            item, ok := conn.SendQueue.TryRemove()
+            if !ok {
+                continue
+            }
+            if item.(*SendMsg).cmd != SEND_CMD_SEND {
+                // keep SEND_CMD_QUIT, connection is closing
+                conn.SendQueue.AppendForce(item)
+                info.drop("TCP_SEND_DROP_CLOSED")
+                return ErrConnClosed
+            }
+            atomic.AddInt64(&info.sentNum, 1)
+            info.drop("TCP_SEND_DROP_OLDEST")
+        }
+        return nil
+
+    case SEND_QUEUE_CLOSE:
+        info.drop("TCP_SEND_QUEUE_FULL_CLOSE")
+        info.errSet(ErrSendQueueFull)
+        if info.conn != nil {
+            info.conn.Close()
+        }
+        return ErrSendQueueFull
+
+    default:
+        info.drop("TCP_SEND_DROP_NEWEST")
+        return ErrSendQueueFull
+    }
+}
+
+/*
+* quit - mark connection closed, and ask sender to quit after msgs in queue
+*   Send() waiting for space in queue is woken up and fails
+*/
+func (conn *TcpConn) quit() {
+    if conn.info != nil {
+        atomic.StoreInt32(&conn.info.closed, 1)
+    }
+    conn.SendQueue.AppendForce(&SendMsg{cmd: SEND_CMD_QUIT})
+    conn.SendQueue.Close()
+}
+
+// get number of msgs in SendQueue but not taken out by sender
+func (conn *TcpConn) pendingNum() int64 {
+    if conn.info == nil {
+        return 0
+    }
+    return atomic.LoadInt64(&conn.info.sendNum) - atomic.LoadInt64(&conn.info.sentNum)
+}
+
+// get certificates of peer, nil if not tls connection or no certificate from peer
+func (conn *TcpConn) PeerCertificates() []*x509.Certificate {
+    if conn.info == nil {
+        return nil
+    }
+
+    conn.info.lock.Lock()
+    defer conn.info.lock.Unlock()
+    return conn.info.peerCerts
+}
+
+// get subject of peer certificate, e.g., "CN=client,O=baidu", empty if no certificate
+func (conn *TcpConn) PeerSubject() string {
+    certs := conn.PeerCertificates()
+    if len(certs) == 0 {
+        return ""
+    }
+    return certs[0].Subject.String()
 }
 
 /* tcp connection table */
@@ -55,9 +286,41 @@ type TcpConnTable struct {
 
 /* state of tcp connection  */
 type TcpConnState struct {
-    QueueLen    int     // length of send queue
-    LocalAddr   string  // local address
-    RemoteAddr  string  // remote address
+    QueueLen        int     // length of send queue
+    QueueHighWater  int64   // max length of send queue
+    DropNum         int64   // number of msgs dropped
+    LocalAddr       string  // local address
+    RemoteAddr      string  // remote address
+
+    ConnectTime     time.Time   // time of connection accepted
+    LastActiveTime  time.Time   // time of last read or write
+    BytesIn         int64       // bytes read from connection
+    BytesOut        int64       // bytes written to connection
+    MsgsIn          int64       // msgs received
+    MsgsOut         int64       // msgs sent
+    Error           string      // last error of connection, "" if no error
+}
+
+/* get state of tcp connection    */
+func (conn *TcpConn) state() TcpConnState {
+    info := conn.info
+
+    state := TcpConnState{}
+    state.QueueLen = conn.SendQueue.Len()
+    state.QueueHighWater = atomic.LoadInt64(&info.queueHighWater)
+    state.DropNum = atomic.LoadInt64(&info.dropNum)
+    state.LocalAddr = conn.LocalAddr
+    state.RemoteAddr = conn.RemoteAddr
+
+    state.ConnectTime = info.connectTime
+    state.LastActiveTime = time.Unix(0, atomic.LoadInt64(&info.lastActive))
+    state.BytesIn = atomic.LoadInt64(&info.bytesIn)
+    state.BytesOut = atomic.LoadInt64(&info.bytesOut)
+    state.MsgsIn = atomic.LoadInt64(&info.msgsIn)
+    state.MsgsOut = atomic.LoadInt64(&info.msgsOut)
+    state.Error = info.errGet()
+
+    return state
 }
 
 /* Initialize table */
@@ -71,6 +334,9 @@ func (t *TcpConnTable) Add(conn net.Conn) TcpConn {
     tcpConn := newTcpConn()
     tcpConn.LocalAddr = conn.LocalAddr().String()
     tcpConn.RemoteAddr = conn.RemoteAddr().String()
+    tcpConn.info.conn = conn
+    tcpConn.info.connectTime = time.Now()
+    tcpConn.info.lastActive = tcpConn.info.connectTime.UnixNano()
     
     t.lock.Lock()
     t.table[conn] = tcpConn
@@ -103,6 +369,18 @@ func (t *TcpConnTable) Exist(conn net.Conn) bool {
     return ok
 }
 
+/* get all tcp connections in table */
+func (t *TcpConnTable) GetAll() []TcpConn {
+    t.lock.Lock()
+    defer t.lock.Unlock()
+
+    conns := make([]TcpConn, 0, len(t.table))
+    for _, v := range t.table {
+        conns = append(conns, v)
+    }
+    return conns
+}
+
 /* get state of tcp connections */
 func (t *TcpConnTable) GetState() []TcpConnState {
     states := make([]TcpConnState, 0)
@@ -110,12 +388,7 @@ func (t *TcpConnTable) GetState() []TcpConnState {
     t.lock.Lock()
     
     for _, v := range t.table {
-        state := TcpConnState{}
-        state.QueueLen = v.SendQueue.Len()
-        state.LocalAddr = v.LocalAddr
-        state.RemoteAddr = v.RemoteAddr
-
-        states = append(states, state)
+        states = append(states, v.state())
     }    
     
     t.lock.Unlock()
@@ -4,6 +4,8 @@ modification history
 --------------------
 2014/3/11, by Zhang Miao, create
 2014/8/6, by Zhang Miao, move from waf_server
+2026/10/18, by agent, modify
+    - add test for overflow policy of send queue
 */
 /*
 DESCRIPTION
@@ -13,6 +15,7 @@ package net_server
 import (
     "net"
     "testing"
+    "time"
 )
 
 import "www.baidu.com/golang-lib/log"
@@ -42,3 +45,110 @@ func TestTcpConnTableAdd(t *testing.T) {
     
     log.Logger.Close()
 }
+
+/* create TcpConn with bounded send queue   */
+func prepareTcpConn(maxLen int, policy int) (TcpConn, net.Conn, *TcpServer) {
+    srv := NewTcpServer(nil, WithSendQueue(maxLen, policy))
+
+    conn, peer := net.Pipe()
+    tcpConn := srv.tcpTable.Add(conn)
+    srv.tcpConnInit(tcpConn)
+    return tcpConn, peer, srv
+}
+
+func TestSendQueueDrop(t *testing.T) {
+    // drop newest
+    tcpConn, _, srv := prepareTcpConn(2, SEND_QUEUE_DROP_NEWEST)
+    for i := 0; i < 3; i++ {
+        err := tcpConn.Send(i)
+        if (i < 2 && err != nil) || (i == 2 && err != ErrSendQueueFull) {
+            t.Errorf("unexpected err for Send(%d): %v", i, err)
+        }
+    }
+    if item := tcpConn.SendQueue.Remove().(*SendMsg); item.data.(int) != 0 {
+        t.Errorf("oldest msg should be kept, got %v", item.data)
+    }
+    if srv.TcpStateGet().GetCounter("TCP_SEND_DROP_NEWEST") != 1 {
+        t.Errorf("drop should be counted")
+    }
+
+    // drop oldest
+    tcpConn, _, srv = prepareTcpConn(2, SEND_QUEUE_DROP_OLDEST)
+    for i := 0; i < 3; i++ {
+        if err := tcpConn.Send(i); err != nil {
+            t.Errorf("Send(%d): %s", i, err.Error())
+        }
+    }
+    if item := tcpConn.SendQueue.Remove().(*SendMsg); item.data.(int) != 1 {
+        t.Errorf("oldest msg should be dropped, got %v", item.data)
+    }
+    if srv.TcpStateGet().GetCounter("TCP_SEND_DROP_OLDEST") != 1 {
+        t.Errorf("drop should be counted")
+    }
+
+    states := srv.tcpTable.GetState()
+    if states[0].QueueHighWater != 2 || states[0].DropNum != 1 || states[0].QueueLen != 1 {
+        t.Errorf("unexpected state: %+v", states[0])
+    }
+
+    // no msg accepted after quit
+    tcpConn.quit()
+    if err := tcpConn.Send(3); err != ErrConnClosed {
+        t.Errorf("err should be ErrConnClosed, got %v", err)
+    }
+}
+
+func TestSendQueueBlock(t *testing.T) {
+    tcpConn, _, srv := prepareTcpConn(1, SEND_QUEUE_BLOCK)
+    tcpConn.Send(0)
+
+    done := make(chan error)
+    go func() {
+        done <- tcpConn.Send(1)
+    }()
+    select {
+    case <-done:
+        t.Fatalf("Send() should block when send queue is full")
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    tcpConn.SendQueue.Remove()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Errorf("Send(): %s", err.Error())
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("Send() should return after msg removed")
+    }
+
+    // fail if connection is removed while waiting
+    go func() {
+        done <- tcpConn.Send(2)
+    }()
+    time.Sleep(10 * time.Millisecond)
+    srv.removeTcpConn(tcpConn.info.conn)
+    select {
+    case err := <-done:
+        if err != ErrConnClosed {
+            t.Errorf("err should be ErrConnClosed, got %v", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("Send() should return after connection removed")
+    }
+}
+
+func TestSendQueueClose(t *testing.T) {
+    tcpConn, peer, srv := prepareTcpConn(1, SEND_QUEUE_CLOSE)
+    tcpConn.Send(0)
+
+    if err := tcpConn.Send(1); err != ErrSendQueueFull {
+        t.Errorf("err should be ErrSendQueueFull, got %v", err)
+    }
+    if _, err := peer.Read(make([]byte, 1)); err == nil {
+        t.Errorf("connection should be closed")
+    }
+    if srv.TcpStateGet().GetCounter("TCP_SEND_QUEUE_FULL_CLOSE") != 1 {
+        t.Errorf("close should be counted")
+    }
+}
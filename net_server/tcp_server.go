@@ -4,6 +4,18 @@ modification history
 --------------------
 2014/3/10, by Zhang Miao, create
 2014/8/6, by Zhang Miao, move code from waf_server
+2026/10/18, by agent, modify
+    - add Shutdown() for graceful shutdown and connection draining
+2026/10/18, by agent, modify
+    - add options for limiting connections and timeouts of TcpConn
+2026/10/18, by agent, modify
+    - support TLS, see tls_server.go
+2026/10/18, by agent, modify
+    - bounded send queue with overflow policy
+2026/10/18, by agent, modify
+    - read and write msgs by Framer of server, see framer.go
+2026/10/18, by agent, modify
+    - record traffic and error of connections, see tcp_conn_monitor.go
 */
 /*
 DESCRIPTION
@@ -11,13 +23,19 @@ DESCRIPTION
 package net_server
 
 import (
+    "context"
     "encoding/json"
     "errors"
     "fmt"
     "net"
+    "os"
+    "sync"
+    "sync/atomic"
+    "time"
 )
 
 import (
+    "www.baidu.com/golang-lib/limit_rate"
     "www.baidu.com/golang-lib/log"
     "www.baidu.com/golang-lib/module_state2"
 )
@@ -31,6 +49,20 @@ const (
     SEND_CMD_SEND = 1   // ask sender to send msg
 )
 
+var ErrServerClosed = errors.New("net_server: server closed")
+
+/* error returned by Shutdown() if some connections are force closed */
+type ShutdownError struct {
+    ConnNum     int     // number of connections force closed
+    MsgNum      int64   // number of msgs dropped
+    Err         error   // reason, e.g., context.DeadlineExceeded
+}
+
+func (e *ShutdownError) Error() string {
+    return fmt.Sprintf("net_server: shutdown: %d connections force closed, %d msgs dropped: %s",
+                       e.ConnNum, e.MsgNum, e.Err.Error())
+}
+
 type SendMsg struct {
     cmd     int         // command, QUIT, SEND
     data    interface{} // data to send
@@ -52,10 +84,43 @@ type TcpServer struct {
     tcpTable    TcpConnTable        // for maintain tcp conn
     
     callBacks   CallBacks           // callback functions    
+    framer      Framer              // for reading and writing msgs
+
+    lock        sync.Mutex          // protect closed, connNum and ipConnNum
+    closed      bool                // server is shutdown
+    connNum     int                 // number of connections
+    ipConnNum   map[string]int      // number of connections for each remote ip
+
+    // options, see tcp_server_option.go
+    maxConns        int                             // max number of connections
+    maxConnsPerIP   int                             // max number of connections per ip
+    acceptLimiter   *limit_rate.TokenBucketLimiter  // rate limiter for accept
+    idleTimeout     time.Duration                   // timeout for waiting next msg
+    readTimeout     time.Duration                   // timeout for reading msg
+    writeTimeout    time.Duration                   // timeout for writing msg
+    sendQueueLen    int                             // max length of send queue, -1 for no limit
+    sendQueuePolicy int                             // overflow policy of send queue
+
+    // for TLS, see tls_server.go
+    tlsCerts        *tlsCerts                       // certificates, nil if tls not enabled
+    sighupChan      chan os.Signal                  // for reloading certificates on SIGHUP
 }
 
-func NewTcpServer(callBacks CallBacks) *TcpServer {
+/*
+* NewTcpServer - create TcpServer
+*
+* PARAMS:
+*   - callBacks: callback functions
+*   - opts: options of server, e.g., WithMaxConns()
+*
+* RETURNS: 
+*   TcpServer
+*/
+func NewTcpServer(callBacks CallBacks, opts ...ServerOption) *TcpServer {
     srv := new(TcpServer)
+    srv.ipConnNum = make(map[string]int)
+    srv.sendQueueLen = -1
+    srv.framer = NewMsgHeaderFramer(MAGIC_STR)
     
     // initialize tcpTable
     srv.tcpTable.Init()
@@ -65,6 +130,11 @@ func NewTcpServer(callBacks CallBacks) *TcpServer {
     
     // set callBacks
     srv.callBacks = callBacks
+
+    // apply options
+    for _, opt := range opts {
+        opt(srv)
+    }
     
     return srv
 }
@@ -74,20 +144,122 @@ func (srv *TcpServer) handleListen() {
     for {
         conn, err := srv.Listener.Accept()
         if err != nil {
+            if srv.isClosed() {
+                log.Logger.Info("handleListen():server closed, quit")
+                return
+            }
             log.Logger.Error("handleListen():error in accept(): %s", err.Error())
             srv.tcpState.Inc("TCP_ACCEPT_ERR", 1)
             continue
         }
         srv.tcpState.Inc("TCP_ACCEPT_SUCC", 1)
 
-        /* add to tcp connection table  */
+        /* add to tcp connection table, unless server closed   */
+        srv.lock.Lock()
+        if srv.closed {
+            srv.lock.Unlock()
+            conn.Close()
+            return
+        }
+        if reason := srv.connAcquire(conn); reason != "" {
+            srv.lock.Unlock()
+            log.Logger.Info("handleListen():reject %s: %s", conn.RemoteAddr().String(), reason)
+            srv.tcpState.Inc(reason, 1)
+            conn.Close()
+            continue
+        }
         tcpConn := srv.tcpTable.Add(conn)
+        srv.tcpConnInit(tcpConn)
+        srv.lock.Unlock()
+
         /* start two go-routines for this connection    */
         srv.startTcpConn(conn, tcpConn)
         
     }
 }
 
+// whether server is closed by Shutdown()
+func (srv *TcpServer) isClosed() bool {
+    srv.lock.Lock()
+    defer srv.lock.Unlock()
+    return srv.closed
+}
+
+/*
+* Shutdown - gracefully shutdown the server
+*   1. stop accepting new connections
+*   2. ask sender of each connection to quit after msgs in send queue are sent,
+*      Send() waiting for space in send queue fails with ErrConnClosed
+*   3. wait until all send queues are drained, or ctx is done
+*   4. close all connections
+*
+* PARAMS:
+*   - ctx: context for deadline of draining
+*
+* RETURNS: 
+*   nil, if all send queues are drained
+*   *ShutdownError, if some connections are force closed
+*   ErrServerClosed, if server is shutdown already
+*/
+func (srv *TcpServer) Shutdown(ctx context.Context) error {
+    srv.lock.Lock()
+    if srv.closed {
+        srv.lock.Unlock()
+        return ErrServerClosed
+    }
+    srv.closed = true
+    srv.lock.Unlock()
+    srv.sighupStop()
+
+    /* stop accepting   */
+    if srv.Listener != nil {
+        srv.Listener.Close()
+    }
+
+    /* ask senders to quit after send queues are drained    */
+    tcpConns := srv.tcpTable.GetAll()
+    for _, tcpConn := range tcpConns {
+        tcpConn.quit()
+    }
+
+    /* wait for senders to quit */
+    var err error
+    for _, tcpConn := range tcpConns {
+        select {
+        case <-tcpConn.info.senderDone:
+        case <-ctx.Done():
+            err = ctx.Err()
+        }
+        if err != nil {
+            break
+        }
+    }
+
+    /* close all connections, and count what is dropped */
+    shutdownErr := &ShutdownError{Err: err}
+    for _, tcpConn := range tcpConns {
+        select {
+        case <-tcpConn.info.senderDone:
+        default:
+            shutdownErr.ConnNum++
+        }
+        shutdownErr.MsgNum += tcpConn.pendingNum()
+        tcpConn.info.conn.Close()
+    }
+
+    if shutdownErr.ConnNum == 0 && shutdownErr.MsgNum == 0 {
+        return nil
+    }
+    if shutdownErr.Err == nil {
+        // msgs added after sender quit
+        shutdownErr.Err = ErrServerClosed
+    }
+    srv.tcpState.Inc("TCP_SHUTDOWN_CONN_FORCE_CLOSE", shutdownErr.ConnNum)
+    srv.tcpState.Inc("TCP_SHUTDOWN_MSG_DROP", int(shutdownErr.MsgNum))
+    log.Logger.Warn("Shutdown(): %s", shutdownErr.Error())
+    return shutdownErr
+}
+
 /*
 * ListenAndServe - tcp listen and start a new go-routine to serve
 *
@@ -166,90 +338,71 @@ func (srv *TcpServer) startTcpConn(conn net.Conn, tcpConn TcpConn) {
     go srv.tcpSender(conn, tcpConn)
 }
 
-/* read waf-body from connection  */
-func (srv *TcpServer) readBody(conn net.Conn, buff []byte, len int) ([]byte, error) {
-    /* read from socket */
-    readBuf, err := ReadWithLen(conn, buff, len)
-    if err != nil {
-        srv.tcpState.Inc("TCP_READ_BODY_ERR", 1)
-        return readBuf, err
-    }
-
-    return readBuf, nil
-}
-
 func (srv *TcpServer) removeTcpConn(conn net.Conn) {
     // remove from tcpTable
     tcpConn, err := srv.tcpTable.Remove(conn)    
     if err == nil {
         // close tcp connection
         conn.Close()
+        srv.connRelease(conn)
         
-        // notify sender go-routine to quit    
-        pMsg := &SendMsg{cmd:SEND_CMD_QUIT}
-        tcpConn.SendQueue.Append(pMsg)
+        // notify sender go-routine to quit, and fail Send() waiting for space in queue
+        tcpConn.quit()
     }
 }
 
 /*  tcpRecver - handle incoming msgs    */
 func (srv *TcpServer) tcpRecver(conn net.Conn, tcpConn TcpConn) {
     log.Logger.Debug("tcpRecver start")
-    var buff [RECV_BUF_LEN]byte
+
+    /* handshake for tls connection */
+    if err := srv.tlsHandshake(conn, tcpConn); err != nil {
+        log.Logger.Warn("tlsHandshake(): %s %s", conn.RemoteAddr().String(), err.Error())
+        srv.removeTcpConn(conn)
+        return
+    }
+
+    frameConn := &frameConn{srv: srv, conn: conn, info: tcpConn.info}
+    reader := srv.framer.NewFrameReader(frameConn, &srv.tcpState)
             
     for {
-        /* read header  */
-        header, err := ReadHeader(conn, buff[:], MSG_HEADER_LEN, &srv.tcpState)
-        
+        /* read frame   */
+        frameConn.frameStart(reader)
+        header, body, err := reader.ReadFrame()
+
         if err != nil && err != ErrNoDataClose {
-            log.Logger.Warn("ReadHeader(): %s %s", conn.RemoteAddr().String(), err.Error())            
-            break
+            tcpConn.info.errSet(err)
         }
 
-        if err == ErrNoDataClose {
-            log.Logger.Info("ReadHeader(): %s %s", conn.RemoteAddr().String(), err.Error())
+        if isTimeout(err) {
+            if frameConn.started {
+                log.Logger.Warn("ReadFrame(): %s read timeout", conn.RemoteAddr().String())
+                srv.tcpState.Inc("TCP_READ_TIMEOUT", 1)
+            } else {
+                log.Logger.Info("ReadFrame(): %s idle timeout", conn.RemoteAddr().String())
+                srv.tcpState.Inc("TCP_IDLE_TIMEOUT", 1)
+            }
             break
         }
-        
-        /* check msg type   */
-        if header.MsgType != MSG_TYPE_REQUEST &&
-                header.MsgType != MSG_TYPE_REQUEST_NO_RESPONSE {
-            log.Logger.Warn("tcpRecver():error: msg type is not request[%d]",
-                            header.MsgType)
-            srv.tcpState.Inc("TCP_READ_MSGTYPE_ERR", 1)
+
+        if err == ErrFrameBypassed {
+            log.Logger.Warn("ReadFrame(): %s %s", conn.RemoteAddr().String(), err.Error())
+            // to read next frame
+            continue
+        }
+
+        if err == ErrNoDataClose {
+            log.Logger.Info("ReadFrame(): %s %s", conn.RemoteAddr().String(), err.Error())
             break
-        }        
-        
-        /* calc and check body length   */
-        bodyLen := int(header.MsgSize) - MSG_HEADER_LEN
-        if bodyLen <= 0 {
-            log.Logger.Warn("tcpRecver():err: bodyLen = %d", bodyLen)
-            srv.tcpState.Inc("TCP_BODY_ZERO_ERR", 1)
-            break            
-        }        
-        if bodyLen > RECV_BUF_LEN {            
-            log.Logger.Warn("tcpRecver():err: bodyLen = %d", bodyLen)
-            srv.tcpState.Inc("TCP_BODY_TOOLONG_ERR", 1)
-            // bypass msg with bodyLen > RECV_BUF_LEN
-            err = ReadBypass(conn, buff[:], bodyLen)
-            if err != nil {
-                log.Logger.Warn("ReadBypass():", err.Error())
-                srv.tcpState.Inc("TCP_READ_BYPASS_ERR", 1)
-                break
-            } else {
-                // to read next header
-                continue
-            }
         }
 
-        /* read body    */
-        var body []byte
-        body, err = srv.readBody(conn, buff[:], bodyLen)        
         if err != nil {
-            log.Logger.Warn("tcpRecver():err in readBody():", err.Error())
+            log.Logger.Warn("ReadFrame(): %s %s", conn.RemoteAddr().String(), err.Error())
             break
         }
 
         // process received msg
+        atomic.AddInt64(&tcpConn.info.msgsIn, 1)
         srv.callBacks.RecvMsgProc(header, body, tcpConn, &srv.tcpState)
     }
     srv.removeTcpConn(conn)
@@ -258,6 +411,9 @@ func (srv *TcpServer) tcpRecver(conn net.Conn, tcpConn TcpConn) {
 /*  tcpSender - handle outgoing msgs    */
 func (srv *TcpServer) tcpSender(conn net.Conn, tcpConn TcpConn) {
     log.Logger.Debug("tcpSender start")
+    defer close(tcpConn.info.senderDone)
+    frameConn := &frameConn{srv: srv, conn: conn, info: tcpConn.info}
+
     for {
         // read SendMsg from sending queue
         sendMsg := tcpConn.SendQueue.Remove().(*SendMsg)        
@@ -271,20 +427,27 @@ func (srv *TcpServer) tcpSender(conn net.Conn, tcpConn TcpConn) {
             log.Logger.Warn("cmd should be SEND_CMD_SEND, now:%d", sendMsg.cmd)
             continue
         }
+        atomic.AddInt64(&tcpConn.info.sentNum, 1)
         
         // prepare msg ([]byte) to send
         msg, err := srv.callBacks.SendMsgMake(sendMsg.data)
         if err != nil {
             log.Logger.Warn("tcpSender():err in SendMsgMake():%s", err.Error())
+            tcpConn.info.errSet(err)
             srv.tcpState.Inc("RESPONSE_MAKE_ERR", 1)
             continue
         }
 
         // send out the msg
-        err = WriteMsg(conn, msg)        
+        srv.writeDeadlineSet(conn)
+        err = srv.framer.WriteFrame(frameConn, msg)
         if err != nil {
-            log.Logger.Warn("tcpSender:err in WriteMsg(): %s", err.Error())
+            log.Logger.Warn("tcpSender:err in WriteFrame(): %s", err.Error())
+            tcpConn.info.errSet(err)
             srv.tcpState.Inc("RESPONSE_SEND_ERR", 1)
+            if isTimeout(err) {
+                srv.tcpState.Inc("TCP_WRITE_TIMEOUT", 1)
+            }
             
             /* remove the connection    */
             srv.removeTcpConn(conn)
@@ -292,6 +455,7 @@ func (srv *TcpServer) tcpSender(conn net.Conn, tcpConn TcpConn) {
             break
         }
                 
+        atomic.AddInt64(&tcpConn.info.msgsOut, 1)
         log.Logger.Debug("tcpSender:succ in write()")
         srv.tcpState.Inc("RESPONSE_SEND_OK", 1)
     }
@@ -0,0 +1,267 @@
+/* tcp_server_option.go - options of TcpServer for limiting connections  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+2026/10/18, by agent, modify
+    - add WithSendQueue() for bounded send queue
+2026/10/18, by agent, modify
+    - add WithFramer() and WithMagicStr()
+*/
+/*
+DESCRIPTION
+Options for TcpServer, to protect server from misbehaving clients:
+- WithMaxConns       : max number of concurrent connections
+- WithMaxConnsPerIP  : max number of concurrent connections from one IP
+- WithAcceptRate     : max rate of accepting connections
+- WithIdleTimeout    : close connection if no msg received in timeout
+- WithReadTimeout    : timeout for reading a msg
+- WithWriteTimeout   : timeout for writing a msg
+- WithSendQueue      : max length and overflow policy of send queue
+- WithFramer         : protocol for reading and writing msgs, see framer.go
+- WithMagicStr       : magic string in MsgHeader, MAGIC_STR by default
+
+Rejected connections are counted in tcpState:
+- TCP_REJECT_MAX_CONNS
+- TCP_REJECT_MAX_CONNS_PER_IP
+- TCP_REJECT_RATE_LIMIT
+
+Overflow of send queue is counted in tcpState:
+- TCP_SEND_QUEUE_FULL       : send queue is full
+- TCP_SEND_DROP_NEWEST      : msg dropped for SEND_QUEUE_DROP_NEWEST
+- TCP_SEND_DROP_OLDEST      : msg dropped for SEND_QUEUE_DROP_OLDEST
+- TCP_SEND_QUEUE_FULL_CLOSE : connection closed for SEND_QUEUE_CLOSE
+- TCP_SEND_DROP_CLOSED      : msg dropped for connection closed
+
+Usage:
+    srv := NewTcpServer(callBacks,
+                        WithMaxConns(10000),
+                        WithMaxConnsPerIP(100),
+                        WithAcceptRate(1000, 100),
+                        WithIdleTimeout(60 * time.Second),
+                        WithSendQueue(1000, SEND_QUEUE_DROP_OLDEST))
+*/
+package net_server
+
+import (
+    "net"
+    "time"
+)
+
+import (
+    "www.baidu.com/golang-lib/limit_rate"
+)
+
+// option for creating TcpServer
+type ServerOption func(*TcpServer)
+
+// WithMaxConns sets max number of concurrent connections, 0 for no limit
+func WithMaxConns(maxConns int) ServerOption {
+    return func(srv *TcpServer) {
+        srv.maxConns = maxConns
+    }
+}
+
+// WithMaxConnsPerIP sets max number of concurrent connections from one IP, 0 for no limit
+func WithMaxConnsPerIP(maxConns int) ServerOption {
+    return func(srv *TcpServer) {
+        srv.maxConnsPerIP = maxConns
+    }
+}
+
+// WithAcceptRate limits rate of accepting connections, by token bucket
+func WithAcceptRate(ops int64, burst int64) ServerOption {
+    return func(srv *TcpServer) {
+        srv.acceptLimiter = limit_rate.NewTokenBucketLimiter(ops, burst)
+    }
+}
+
+// WithIdleTimeout sets timeout of waiting for next msg, ReadTimeout is used if not set
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+    return func(srv *TcpServer) {
+        srv.idleTimeout = timeout
+    }
+}
+
+// WithReadTimeout sets timeout of reading a msg
+func WithReadTimeout(timeout time.Duration) ServerOption {
+    return func(srv *TcpServer) {
+        srv.readTimeout = timeout
+    }
+}
+
+// WithWriteTimeout sets timeout of writing a msg
+func WithWriteTimeout(timeout time.Duration) ServerOption {
+    return func(srv *TcpServer) {
+        srv.writeTimeout = timeout
+    }
+}
+
+// WithSendQueue sets max length and overflow policy of send queue of each connection
+func WithSendQueue(maxLen int, policy int) ServerOption {
+    return func(srv *TcpServer) {
+        if maxLen <= 0 {
+            maxLen = -1
+        }
+        srv.sendQueueLen = maxLen
+        srv.sendQueuePolicy = policy
+    }
+}
+
+// WithFramer sets Framer for reading and writing msgs, MsgHeaderFramer by default
+func WithFramer(framer Framer) ServerOption {
+    return func(srv *TcpServer) {
+        srv.framer = framer
+    }
+}
+
+// WithMagicStr sets magic string in MsgHeader, instead of the global MAGIC_STR
+func WithMagicStr(magicStr [4]byte) ServerOption {
+    return WithFramer(NewMsgHeaderFramer(magicStr))
+}
+
+/* initialize TcpConn by options of server  */
+func (srv *TcpServer) tcpConnInit(tcpConn TcpConn) {
+    tcpConn.SendQueue.SetMaxLen(srv.sendQueueLen)
+    tcpConn.info.overflowPolicy = srv.sendQueuePolicy
+    tcpConn.info.tcpState = &srv.tcpState
+}
+
+/* get ip from address, address is returned if no ip in it */
+func addrToIP(addr net.Addr) string {
+    if addr == nil {
+        return ""
+    }
+    host, _, err := net.SplitHostPort(addr.String())
+    if err != nil {
+        return addr.String()
+    }
+    return host
+}
+
+/*
+* connAcquire - check limits for new connection, and count it if accepted
+*   Note: srv.lock should be held
+*
+* PARAMS:
+*   - conn: new connection
+*
+* RETURNS:
+*   "", if accepted
+*   counter key of rejection, if rejected
+*/
+func (srv *TcpServer) connAcquire(conn net.Conn) string {
+    if srv.acceptLimiter != nil && !srv.acceptLimiter.Try() {
+        return "TCP_REJECT_RATE_LIMIT"
+    }
+    if srv.maxConns > 0 && srv.connNum >= srv.maxConns {
+        return "TCP_REJECT_MAX_CONNS"
+    }
+    ip := addrToIP(conn.RemoteAddr())
+    if srv.maxConnsPerIP > 0 && srv.ipConnNum[ip] >= srv.maxConnsPerIP {
+        return "TCP_REJECT_MAX_CONNS_PER_IP"
+    }
+
+    srv.connNum++
+    srv.ipConnNum[ip]++
+    return ""
+}
+
+/* release count of connection acquired by connAcquire() */
+func (srv *TcpServer) connRelease(conn net.Conn) {
+    ip := addrToIP(conn.RemoteAddr())
+
+    srv.lock.Lock()
+    defer srv.lock.Unlock()
+
+    srv.connNum--
+    srv.ipConnNum[ip]--
+    if srv.ipConnNum[ip] <= 0 {
+        delete(srv.ipConnNum, ip)
+    }
+}
+
+/* set read deadline before waiting for next msg */
+func (srv *TcpServer) idleDeadlineSet(conn net.Conn) {
+    timeout := srv.idleTimeout
+    if timeout <= 0 {
+        timeout = srv.readTimeout
+    }
+    if timeout > 0 {
+        conn.SetReadDeadline(time.Now().Add(timeout))
+    }
+}
+
+/* set read deadline before reading body of msg */
+func (srv *TcpServer) readDeadlineSet(conn net.Conn) {
+    if srv.readTimeout > 0 {
+        conn.SetReadDeadline(time.Now().Add(srv.readTimeout))
+    } else if srv.idleTimeout > 0 {
+        // clear deadline set by idleDeadlineSet()
+        conn.SetReadDeadline(time.Time{})
+    }
+}
+
+/* set write deadline before writing msg */
+func (srv *TcpServer) writeDeadlineSet(conn net.Conn) {
+    if srv.writeTimeout > 0 {
+        conn.SetWriteDeadline(time.Now().Add(srv.writeTimeout))
+    }
+}
+
+/* 
+* frameConn - connection for FrameReader and Framer.WriteFrame()
+*   Deadline for reading is switched from idle timeout to read timeout, after
+*   the first data of a frame is read from connection, or is already buffered
+*   by FrameReader. Traffic is recorded in info.
+*/
+type frameConn struct {
+    srv         *TcpServer
+    conn        net.Conn
+    info        *tcpConnInfo
+    started     bool        // whether any data of current frame is read
+}
+
+/*
+* frameStart - prepare for reading next frame
+*
+* PARAMS:
+*   - reader: FrameReader of the connection; if it implements frameBuffer and
+*             has buffered data, the next frame has started already
+*/
+func (c *frameConn) frameStart(reader FrameReader) {
+    if buffer, ok := reader.(frameBuffer); ok && buffer.Buffered() > 0 {
+        c.started = true
+        c.srv.readDeadlineSet(c.conn)
+        return
+    }
+
+    c.started = false
+    c.srv.idleDeadlineSet(c.conn)
+}
+
+func (c *frameConn) Read(p []byte) (int, error) {
+    n, err := c.conn.Read(p)
+    if n > 0 {
+        c.info.readRecord(n)
+        if !c.started {
+            c.started = true
+            c.srv.readDeadlineSet(c.conn)
+        }
+    }
+    return n, err
+}
+
+func (c *frameConn) Write(p []byte) (int, error) {
+    n, err := c.conn.Write(p)
+    if n > 0 {
+        c.info.writeRecord(n)
+    }
+    return n, err
+}
+
+/* whether err is timeout */
+func isTimeout(err error) bool {
+    netErr, ok := err.(net.Error)
+    return ok && netErr.Timeout()
+}
@@ -0,0 +1,538 @@
+/* tcp_server_test.go - test for tcp_server.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+2026/10/18, by agent, modify
+    - add test for options of TcpServer
+2026/10/18, by agent, modify
+    - add test for framers
+*/
+/*
+DESCRIPTION
+*/
+package net_server
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/binary"
+    "io"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+import (
+    "www.baidu.com/golang-lib/b2log"
+    "www.baidu.com/golang-lib/module_state2"
+)
+
+/* data for response of echo server */
+type echoResponse struct {
+    reqId   uint32
+    body    []byte
+}
+
+/* callbacks of echo server, sending of each msg is delayed    */
+type echoCallBacks struct {
+    delay   time.Duration
+}
+
+func (cb *echoCallBacks) RecvMsgProc(header MsgHeader, body []byte, tcpConn TcpConn,
+                                     tcpState *module_state2.State) error {
+    if header.MsgType == MSG_TYPE_REQUEST {
+        data := make([]byte, len(body))
+        copy(data, body)
+        tcpConn.Send(&echoResponse{header.ReqId, data})
+    }
+    return nil
+}
+
+func (cb *echoCallBacks) SendMsgMake(data interface{}) ([]byte, error) {
+    time.Sleep(cb.delay)
+
+    res := data.(*echoResponse)
+    header, err := ResponseHeaderMake(res.reqId, len(res.body))
+    if err != nil {
+        return nil, err
+    }
+    return append(header, res.body...), nil
+}
+
+/* start echo server on loopback    */
+func prepareEchoServer(t *testing.T, delay time.Duration, opts ...ServerOption) *TcpServer {
+    srv := NewTcpServer(&echoCallBacks{delay}, opts...)
+    if err := srv.ListenAndServe2("tcp", "127.0.0.1:0"); err != nil {
+        t.Fatalf("ListenAndServe2(): %s", err.Error())
+    }
+    return srv
+}
+
+/* send request to server   */
+func requestSend(conn net.Conn, reqId uint32, body string) error {
+    header, err := RequestHeaderMake(reqId, len(body), true)
+    if err != nil {
+        return err
+    }
+    return WriteMsg(conn, append(header, body...))
+}
+
+/* read response from server    */
+func responseRead(conn net.Conn) (MsgHeader, string, error) {
+    var buff [RECV_BUF_LEN]byte
+    header, err := ReadHeader(conn, buff[:], MSG_HEADER_LEN, nil)
+    if err != nil {
+        return header, "", err
+    }
+    body, err := ReadWithLen(conn, buff[:], int(header.MsgSize) - MSG_HEADER_LEN)
+    return header, string(body), err
+}
+
+/* wait until number of connections in server reaches num    */
+func connNumWait(srv *TcpServer, num int) bool {
+    for i := 0; i < 200; i++ {
+        if len(srv.tcpTable.GetAll()) == num {
+            return true
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    return false
+}
+
+func TestShutdownDrain(t *testing.T) {
+    srv := prepareEchoServer(t, 20 * time.Millisecond)
+    addr := srv.Listener.Addr().String()
+
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    defer conn.Close()
+
+    for i := 0; i < 5; i++ {
+        if err := requestSend(conn, uint32(i), "hello"); err != nil {
+            t.Fatalf("requestSend(): %s", err.Error())
+        }
+    }
+    if !connNumWait(srv, 1) {
+        t.Fatalf("connection should be added")
+    }
+    time.Sleep(20 * time.Millisecond)
+
+    // responses in send queue are drained before shutdown returns
+    ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
+    defer cancel()
+    if err := srv.Shutdown(ctx); err != nil {
+        t.Errorf("Shutdown() should drain send queues: %s", err.Error())
+    }
+
+    for i := 0; i < 5; i++ {
+        header, body, err := responseRead(conn)
+        if err != nil {
+            t.Fatalf("responseRead(): %s", err.Error())
+        }
+        if header.ReqId != uint32(i) || body != "hello" {
+            t.Errorf("unexpected response: %v %s", header, body)
+        }
+    }
+
+    // connection closed by server
+    if _, _, err := responseRead(conn); err == nil {
+        t.Errorf("connection should be closed")
+    }
+
+    // no more connection accepted
+    if conn, err := net.Dial("tcp", addr); err == nil {
+        conn.Close()
+        t.Errorf("new connection should be refused")
+    }
+
+    if err := srv.Shutdown(ctx); err != ErrServerClosed {
+        t.Errorf("err should be ErrServerClosed, got %v", err)
+    }
+}
+
+func TestShutdownForceClose(t *testing.T) {
+    srv := prepareEchoServer(t, 100 * time.Millisecond)
+
+    conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    defer conn.Close()
+
+    for i := 0; i < 5; i++ {
+        if err := requestSend(conn, uint32(i), "hello"); err != nil {
+            t.Fatalf("requestSend(): %s", err.Error())
+        }
+    }
+    if !connNumWait(srv, 1) {
+        t.Fatalf("connection should be added")
+    }
+    time.Sleep(50 * time.Millisecond)
+
+    // deadline exceeded before send queue is drained
+    ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    err = srv.Shutdown(ctx)
+    shutdownErr, ok := err.(*ShutdownError)
+    if !ok {
+        t.Fatalf("err should be *ShutdownError, got %v", err)
+    }
+    if shutdownErr.ConnNum != 1 || shutdownErr.MsgNum <= 0 ||
+        shutdownErr.Err != context.DeadlineExceeded {
+        t.Errorf("unexpected ShutdownError: %+v", shutdownErr)
+    }
+    if srv.TcpStateGet().GetCounter("TCP_SHUTDOWN_CONN_FORCE_CLOSE") != 1 {
+        t.Errorf("force closed connection should be counted")
+    }
+}
+
+/* callbacks of server, sender is blocked until release is closed  */
+type blockCallBacks struct {
+    release chan bool
+    sendErr chan error      // result of Send()
+}
+
+func (cb *blockCallBacks) RecvMsgProc(header MsgHeader, body []byte, tcpConn TcpConn,
+                                      tcpState *module_state2.State) error {
+    cb.sendErr <- tcpConn.Send(&echoResponse{header.ReqId, nil})
+    return nil
+}
+
+func (cb *blockCallBacks) SendMsgMake(data interface{}) ([]byte, error) {
+    <-cb.release
+
+    res := data.(*echoResponse)
+    return ResponseHeaderMake(res.reqId, 0)
+}
+
+func TestShutdownBlockedSend(t *testing.T) {
+    cb := &blockCallBacks{release: make(chan bool), sendErr: make(chan error, 3)}
+    defer close(cb.release)
+    srv := NewTcpServer(cb, WithSendQueue(1, SEND_QUEUE_BLOCK))
+    if err := srv.ListenAndServe2("tcp", "127.0.0.1:0"); err != nil {
+        t.Fatalf("ListenAndServe2(): %s", err.Error())
+    }
+
+    conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    defer conn.Close()
+
+    // 1st msg is taken by blocked sender, 2nd fills send queue, 3rd waits for space
+    for i := 0; i < 3; i++ {
+        if err := requestSend(conn, uint32(i), "hello"); err != nil {
+            t.Fatalf("requestSend(): %s", err.Error())
+        }
+    }
+    for i := 0; i < 2; i++ {
+        if err := <-cb.sendErr; err != nil {
+            t.Fatalf("Send(): %s", err.Error())
+        }
+    }
+    time.Sleep(20 * time.Millisecond)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+    defer cancel()
+    if _, ok := srv.Shutdown(ctx).(*ShutdownError); !ok {
+        t.Errorf("err should be *ShutdownError")
+    }
+
+    // Send() waiting for space fails
+    select {
+    case err := <-cb.sendErr:
+        if err != ErrConnClosed {
+            t.Errorf("err should be ErrConnClosed, got %v", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("Send() should return after Shutdown()")
+    }
+}
+
+/* dial to server, and check whether connection is closed by server */
+func dialAndCheck(t *testing.T, addr string) (net.Conn, bool) {
+    conn, err := net.Dial("tcp", addr)
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    if err := requestSend(conn, 1, "hello"); err != nil {
+        return conn, false
+    }
+
+    conn.SetReadDeadline(time.Now().Add(time.Second))
+    _, _, err = responseRead(conn)
+    return conn, err == nil
+}
+
+func TestMaxConns(t *testing.T) {
+    cases := []struct {
+        opt     ServerOption
+        reason  string
+        wait    time.Duration   // wait before dialing
+    }{
+        {WithMaxConns(2), "TCP_REJECT_MAX_CONNS", 0},
+        {WithMaxConnsPerIP(2), "TCP_REJECT_MAX_CONNS_PER_IP", 0},
+        // bucket is empty at first, wait until it is full
+        {WithAcceptRate(10, 2), "TCP_REJECT_RATE_LIMIT", 300 * time.Millisecond},
+    }
+
+    for _, c := range cases {
+        srv := prepareEchoServer(t, 0, c.opt)
+        addr := srv.Listener.Addr().String()
+        time.Sleep(c.wait)
+
+        conns := make([]net.Conn, 0)
+        for i := 0; i < 3; i++ {
+            conn, ok := dialAndCheck(t, addr)
+            conns = append(conns, conn)
+            if ok != (i < 2) {
+                t.Errorf("%s: unexpected result for connection %d: %v", c.reason, i, ok)
+            }
+        }
+        if srv.TcpStateGet().GetCounter(c.reason) != 1 {
+            t.Errorf("%s: rejection should be counted", c.reason)
+        }
+
+        // connection is accepted after another is closed
+        if c.reason != "TCP_REJECT_RATE_LIMIT" {
+            conns[0].Close()
+            if !connNumWait(srv, 1) {
+                t.Fatalf("%s: connection should be removed", c.reason)
+            }
+            conn, ok := dialAndCheck(t, addr)
+            conns = append(conns, conn)
+            if !ok {
+                t.Errorf("%s: connection should be accepted", c.reason)
+            }
+        }
+
+        for _, conn := range conns {
+            conn.Close()
+        }
+        srv.Shutdown(context.Background())
+    }
+}
+
+func TestIdleTimeout(t *testing.T) {
+    srv := prepareEchoServer(t, 0, WithIdleTimeout(50 * time.Millisecond),
+                             WithReadTimeout(time.Second))
+    defer srv.Shutdown(context.Background())
+
+    conn, ok := dialAndCheck(t, srv.Listener.Addr().String())
+    defer conn.Close()
+    if !ok {
+        t.Fatalf("connection should be accepted")
+    }
+
+    // connection is closed after idle timeout
+    if _, _, err := responseRead(conn); err == nil || isTimeout(err) {
+        t.Errorf("connection should be closed by server, got %v", err)
+    }
+    if srv.TcpStateGet().GetCounter("TCP_IDLE_TIMEOUT") != 1 {
+        t.Errorf("idle timeout should be counted")
+    }
+}
+
+func TestReadTimeoutBuffered(t *testing.T) {
+    framers := []Framer{&LineFramer{}, &VarintFramer{}}
+    for _, framer := range framers {
+        srv, conn := prepareServer(t, &bodyEchoCallBacks{}, WithFramer(framer),
+                                   WithIdleTimeout(50 * time.Millisecond),
+                                   WithReadTimeout(100 * time.Millisecond))
+
+        // a frame and part of next frame, which is buffered by framer
+        var buf bytes.Buffer
+        framer.WriteFrame(&buf, []byte("hello"))
+        framer.WriteFrame(&buf, []byte("world"))
+        if _, err := conn.Write(buf.Bytes()[:buf.Len() - 2]); err != nil {
+            t.Fatalf("Write(): %s", err.Error())
+        }
+
+        if !connNumWait(srv, 0) {
+            t.Errorf("%T: connection should be closed by server", framer)
+        }
+        state := srv.TcpStateGet()
+        if state.GetCounter("TCP_READ_TIMEOUT") != 1 || state.GetCounter("TCP_IDLE_TIMEOUT") != 0 {
+            t.Errorf("%T: partial frame should be read timeout, got %v", framer, state.GetCounters())
+        }
+
+        conn.Close()
+        srv.Shutdown(context.Background())
+    }
+}
+
+/* callbacks of echo server for framers without MsgHeader    */
+type bodyEchoCallBacks struct {
+}
+
+func (cb *bodyEchoCallBacks) RecvMsgProc(header MsgHeader, body []byte, tcpConn TcpConn,
+                                         tcpState *module_state2.State) error {
+    data := make([]byte, len(body))
+    copy(data, body)
+    tcpConn.Send(data)
+    return nil
+}
+
+func (cb *bodyEchoCallBacks) SendMsgMake(data interface{}) ([]byte, error) {
+    return data.([]byte), nil
+}
+
+/* callbacks of echo server, with magic string of framer    */
+type magicEchoCallBacks struct {
+    framer  *MsgHeaderFramer
+}
+
+func (cb *magicEchoCallBacks) RecvMsgProc(header MsgHeader, body []byte, tcpConn TcpConn,
+                                          tcpState *module_state2.State) error {
+    data := make([]byte, len(body))
+    copy(data, body)
+    tcpConn.Send(&echoResponse{header.ReqId, data})
+    return nil
+}
+
+func (cb *magicEchoCallBacks) SendMsgMake(data interface{}) ([]byte, error) {
+    res := data.(*echoResponse)
+    header, err := cb.framer.ResponseHeaderMake(res.reqId, len(res.body))
+    if err != nil {
+        return nil, err
+    }
+    return append(header, res.body...), nil
+}
+
+/* start server with given callbacks and options on loopback */
+func prepareServer(t *testing.T, callBacks CallBacks, opts ...ServerOption) (*TcpServer, net.Conn) {
+    srv := NewTcpServer(callBacks, opts...)
+    if err := srv.ListenAndServe2("tcp", "127.0.0.1:0"); err != nil {
+        t.Fatalf("ListenAndServe2(): %s", err.Error())
+    }
+    conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    conn.SetDeadline(time.Now().Add(2 * time.Second))
+    return srv, conn
+}
+
+func TestLineFramer(t *testing.T) {
+    srv, conn := prepareServer(t, &bodyEchoCallBacks{}, WithFramer(&LineFramer{MaxLen: 16}))
+    defer srv.Shutdown(context.Background())
+    defer conn.Close()
+
+    // too long line is bypassed
+    input := "hello\r\n" + strings.Repeat("x", 40) + "\n\nworld\n"
+    if _, err := conn.Write([]byte(input)); err != nil {
+        t.Fatalf("Write(): %s", err.Error())
+    }
+
+    reader := bufio.NewReader(conn)
+    for _, expect := range []string{"hello\n", "\n", "world\n"} {
+        line, err := reader.ReadString('\n')
+        if err != nil || line != expect {
+            t.Errorf("ReadString(): expect %q, got %q %v", expect, line, err)
+        }
+    }
+    if srv.TcpStateGet().GetCounter("TCP_BODY_TOOLONG_ERR") != 1 {
+        t.Errorf("too long line should be counted")
+    }
+}
+
+func TestVarintFramer(t *testing.T) {
+    framer := &VarintFramer{MaxLen: 16}
+    srv, conn := prepareServer(t, &bodyEchoCallBacks{}, WithFramer(framer))
+    defer srv.Shutdown(context.Background())
+    defer conn.Close()
+
+    for _, msg := range []string{"hello", strings.Repeat("x", 40), "world"} {
+        if err := framer.WriteFrame(conn, []byte(msg)); err != nil {
+            t.Fatalf("WriteFrame(): %s", err.Error())
+        }
+    }
+
+    reader := bufio.NewReader(conn)
+    for _, expect := range []string{"hello", "world"} {
+        length, err := binary.ReadUvarint(reader)
+        if err != nil {
+            t.Fatalf("ReadUvarint(): %s", err.Error())
+        }
+        body := make([]byte, length)
+        if _, err := io.ReadFull(reader, body); err != nil || string(body) != expect {
+            t.Errorf("ReadFull(): expect %q, got %q %v", expect, body, err)
+        }
+    }
+}
+
+func TestB2logFramer(t *testing.T) {
+    framer := &B2logFramer{}
+    srv, conn := prepareServer(t, &bodyEchoCallBacks{}, WithFramer(framer))
+    defer srv.Shutdown(context.Background())
+    defer conn.Close()
+
+    // broken data between records is bypassed
+    var buf bytes.Buffer
+    framer.WriteFrame(&buf, []byte("hello"))
+    buf.WriteString("garbage")
+    framer.WriteFrame(&buf, []byte("world"))
+    if _, err := conn.Write(buf.Bytes()); err != nil {
+        t.Fatalf("Write(): %s", err.Error())
+    }
+
+    reader := b2log.NewReader(conn)
+    for _, expect := range []string{"hello", "world"} {
+        record, err := reader.Read()
+        if err != nil || string(record) != expect {
+            t.Errorf("Read(): expect %q, got %q %v", expect, record, err)
+        }
+    }
+    if srv.TcpStateGet().GetCounter("TCP_B2LOG_SKIP_BYTES") != int64(len("garbage")) {
+        t.Errorf("bypassed data should be counted")
+    }
+}
+
+func TestMagicStrPerServer(t *testing.T) {
+    magicStrs := [][4]byte{{1, 2, 3, 4}, {5, 6, 7, 8}}
+
+    srvs := make([]*TcpServer, 0)
+    conns := make([]net.Conn, 0)
+    for _, magicStr := range magicStrs {
+        framer := NewMsgHeaderFramer(magicStr)
+        srv, conn := prepareServer(t, &magicEchoCallBacks{framer}, WithMagicStr(magicStr))
+        defer srv.Shutdown(context.Background())
+        defer conn.Close()
+        srvs = append(srvs, srv)
+        conns = append(conns, conn)
+    }
+
+    for i, magicStr := range magicStrs {
+        framer := NewMsgHeaderFramer(magicStr)
+        header, _ := framer.RequestHeaderMake(uint32(i), len("hello"), true)
+        if err := WriteMsg(conns[i], append(header, "hello"...)); err != nil {
+            t.Fatalf("WriteMsg(): %s", err.Error())
+        }
+
+        var buff [RECV_BUF_LEN]byte
+        data, err := ReadWithLen(conns[i], buff[:], MSG_HEADER_LEN + len("hello"))
+        if err != nil {
+            t.Fatalf("ReadWithLen(): %s", err.Error())
+        }
+        res, _ := MsgHeaderDecode(data[:MSG_HEADER_LEN])
+        if res.MagicStr != magicStr || res.ReqId != uint32(i) ||
+                string(data[MSG_HEADER_LEN:]) != "hello" {
+            t.Errorf("unexpected response: %v %s", res, data[MSG_HEADER_LEN:])
+        }
+    }
+
+    // msg with magic string of another server is refused
+    header, _ := NewMsgHeaderFramer(magicStrs[1]).RequestHeaderMake(1, len("hello"), true)
+    WriteMsg(conns[0], append(header, "hello"...))
+    if _, err := ReadWithLen(conns[0], make([]byte, MSG_HEADER_LEN), MSG_HEADER_LEN); err == nil {
+        t.Errorf("connection should be closed by server")
+    }
+    if srvs[0].TcpStateGet().GetCounter("TCP_HEADER_MAGIC_ERR") != 1 {
+        t.Errorf("wrong magic string should be counted")
+    }
+}
@@ -0,0 +1,245 @@
+/* tls_server.go - TLS support for TcpServer  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+TcpServer may serve the msg protocol over TLS. Certificate, key and CA for
+verifying client certificates are loaded from files, and may be reloaded
+without restart:
+- on SIGHUP, if TLSConf.ReloadOnSighup is set
+- by a reload command of web_monitor, see TLSReloadRegister()
+
+If client certificate is verified, subject of the certificate is available by
+TcpConn.PeerSubject(), e.g., for authorizing callers in RecvMsgProc().
+
+Usage:
+    conf := TLSConf{
+        CertFile:       "./conf/server.crt",
+        KeyFile:        "./conf/server.key",
+        ClientCAFile:   "./conf/ca.crt",
+        ReloadOnSighup: true,
+    }
+    err := srv.ListenAndServeTLS("tcp", ":8443", conf)
+
+    // reload by web_monitor: /reload/tls_cert
+    err = srv.TLSReloadRegister(monitorServer, "tls_cert")
+*/
+package net_server
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+)
+
+import (
+    "www.baidu.com/golang-lib/log"
+    "www.baidu.com/golang-lib/web_monitor"
+)
+
+var ErrTLSNotEnabled = errors.New("net_server: tls not enabled")
+
+// config for TLS
+type TLSConf struct {
+    CertFile            string  // file of server certificate, PEM encoded
+    KeyFile             string  // file of server private key, PEM encoded
+    ClientCAFile        string  // file of CA for verifying client certificates, no verify if empty
+    ClientCertOptional  bool    // if true, verify client certificate only if it is given
+    ReloadOnSighup      bool    // reload files on SIGHUP
+}
+
+// certificates loaded from files in TLSConf
+type tlsCerts struct {
+    conf        TLSConf
+
+    lock        sync.RWMutex
+    cert        *tls.Certificate    // server certificate
+    clientCAs   *x509.CertPool      // CA for verifying client certificates
+}
+
+/* load certificates from files */
+func (c *tlsCerts) load() error {
+    cert, err := tls.LoadX509KeyPair(c.conf.CertFile, c.conf.KeyFile)
+    if err != nil {
+        return fmt.Errorf("load key pair: %s", err.Error())
+    }
+
+    var clientCAs *x509.CertPool
+    if c.conf.ClientCAFile != "" {
+        data, err := ioutil.ReadFile(c.conf.ClientCAFile)
+        if err != nil {
+            return fmt.Errorf("read client CA: %s", err.Error())
+        }
+        clientCAs = x509.NewCertPool()
+        if !clientCAs.AppendCertsFromPEM(data) {
+            return fmt.Errorf("no certificate in client CA file %s", c.conf.ClientCAFile)
+        }
+    }
+
+    c.lock.Lock()
+    c.cert = &cert
+    c.clientCAs = clientCAs
+    c.lock.Unlock()
+    return nil
+}
+
+/* make tls.Config for each handshake, with certificates loaded last */
+func (c *tlsCerts) configGet(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+    c.lock.RLock()
+    defer c.lock.RUnlock()
+
+    config := &tls.Config{
+        Certificates: []tls.Certificate{*c.cert},
+    }
+    if c.clientCAs != nil {
+        config.ClientCAs = c.clientCAs
+        if c.conf.ClientCertOptional {
+            config.ClientAuth = tls.VerifyClientCertIfGiven
+        } else {
+            config.ClientAuth = tls.RequireAndVerifyClientCert
+        }
+    }
+    return config, nil
+}
+
+/*
+* ListenAndServeTLS - tls listen and start a new go-routine to serve
+*
+* PARAMS:
+*   - netType: "tcp", "tcp4", "tcp6" or "unix"
+*   - addr: address, e.g., ":443"(for "tcp")
+*   - conf: config of TLS
+*
+* RETURNS:
+*   nil, if succeed
+*   error, if fail
+*/
+func (srv *TcpServer) ListenAndServeTLS(netType, addr string, conf TLSConf) error {
+    certs := &tlsCerts{conf: conf}
+    if err := certs.load(); err != nil {
+        return fmt.Errorf("err in load tls certs: %s", err.Error())
+    }
+
+    /* try to listen    */
+    l, err := net.Listen(netType, addr)
+    if err != nil {
+        return fmt.Errorf("err in listen(): %s", err.Error())
+    }
+    srv.Listener = tls.NewListener(l, &tls.Config{GetConfigForClient: certs.configGet})
+
+    srv.lock.Lock()
+    srv.tlsCerts = certs
+    if conf.ReloadOnSighup {
+        srv.sighupChan = make(chan os.Signal, 1)
+        signal.Notify(srv.sighupChan, syscall.SIGHUP)
+        go srv.handleSighup(srv.sighupChan)
+    }
+    srv.lock.Unlock()
+
+    /* use seperate go-routine to handle listen */
+    go srv.handleListen()
+
+    return nil
+}
+
+/* reload tls certs on SIGHUP, until sighupChan is closed    */
+func (srv *TcpServer) handleSighup(sighupChan chan os.Signal) {
+    for range sighupChan {
+        if err := srv.TLSReload(); err != nil {
+            log.Logger.Warn("handleSighup():err in TLSReload(): %s", err.Error())
+        } else {
+            log.Logger.Info("handleSighup():tls certs reloaded")
+        }
+    }
+}
+
+/* stop reloading tls certs on SIGHUP */
+func (srv *TcpServer) sighupStop() {
+    srv.lock.Lock()
+    defer srv.lock.Unlock()
+
+    if srv.sighupChan != nil {
+        signal.Stop(srv.sighupChan)
+        close(srv.sighupChan)
+        srv.sighupChan = nil
+    }
+}
+
+/*
+* TLSReload - reload certificate, key and client CA from files
+*   Note: new files are used by new connections, established connections
+*         are not affected
+*
+* RETURNS:
+*   nil, if succeed
+*   error, if fail, and certificates loaded last are still used
+*/
+func (srv *TcpServer) TLSReload() error {
+    srv.lock.Lock()
+    certs := srv.tlsCerts
+    srv.lock.Unlock()
+
+    if certs == nil {
+        return ErrTLSNotEnabled
+    }
+    if err := certs.load(); err != nil {
+        srv.tcpState.Inc("TCP_TLS_RELOAD_ERR", 1)
+        return err
+    }
+    srv.tcpState.Inc("TCP_TLS_RELOAD_SUCC", 1)
+    return nil
+}
+
+/*
+* TLSReloadRegister - register TLSReload() as reload handler of web_monitor
+*
+* PARAMS:
+*   - ms: monitor server
+*   - command: command of reload, e.g., "tls_cert"
+*
+* RETURNS:
+*   nil, if succeed
+*   error, if fail
+*/
+func (srv *TcpServer) TLSReloadRegister(ms *web_monitor.MonitorServer, command string) error {
+    return ms.RegisterHandler(web_monitor.WEB_HANDLE_RELOAD, command, srv.TLSReload)
+}
+
+/*
+* tlsHandshake - do handshake for tls connection, and save peer certificates
+*
+* PARAMS:
+*   - conn: connection, not tls connection is ignored
+*   - tcpConn: TcpConn for conn
+*
+* RETURNS:
+*   nil, if succeed
+*   error, if fail
+*/
+func (srv *TcpServer) tlsHandshake(conn net.Conn, tcpConn TcpConn) error {
+    tlsConn, ok := conn.(*tls.Conn)
+    if !ok {
+        return nil
+    }
+
+    srv.idleDeadlineSet(conn)
+    if err := tlsConn.Handshake(); err != nil {
+        srv.tcpState.Inc("TCP_TLS_HANDSHAKE_ERR", 1)
+        return err
+    }
+
+    tcpConn.info.lock.Lock()
+    tcpConn.info.peerCerts = tlsConn.ConnectionState().PeerCertificates
+    tcpConn.info.lock.Unlock()
+    return nil
+}
@@ -0,0 +1,203 @@
+/* tls_server_test.go - test for tls_server.go  */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+package net_server
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "io/ioutil"
+    "math/big"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+import (
+    "www.baidu.com/golang-lib/module_state2"
+)
+
+/* create certificate signed by parent, self-signed if parent is nil */
+func certCreate(t *testing.T, cn string, serial int64, isCA bool,
+                parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey(): %s", err.Error())
+    }
+
+    template := &x509.Certificate{
+        SerialNumber:           big.NewInt(serial),
+        Subject:                pkix.Name{CommonName: cn, Organization: []string{"test"}},
+        NotBefore:              time.Now().Add(-time.Hour),
+        NotAfter:               time.Now().Add(time.Hour),
+        KeyUsage:               x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+        ExtKeyUsage:            []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+        BasicConstraintsValid:  true,
+        IsCA:                   isCA,
+        DNSNames:               []string{"localhost"},
+    }
+    if parent == nil {
+        parent, parentKey = template, key
+    }
+
+    der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+    if err != nil {
+        t.Fatalf("CreateCertificate(): %s", err.Error())
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatalf("ParseCertificate(): %s", err.Error())
+    }
+    return cert, key
+}
+
+/* write certificate and key to files in PEM */
+func certWrite(t *testing.T, cert *x509.Certificate, key *ecdsa.PrivateKey, certFile, keyFile string) {
+    certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+    if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+        t.Fatalf("WriteFile(): %s", err.Error())
+    }
+    if keyFile == "" {
+        return
+    }
+
+    der, err := x509.MarshalECPrivateKey(key)
+    if err != nil {
+        t.Fatalf("MarshalECPrivateKey(): %s", err.Error())
+    }
+    keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+    if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+        t.Fatalf("WriteFile(): %s", err.Error())
+    }
+}
+
+/* callbacks of echo server, recording subject of peer  */
+type subjectCallBacks struct {
+    echoCallBacks
+
+    lock        sync.Mutex
+    subjects    []string
+}
+
+func (cb *subjectCallBacks) RecvMsgProc(header MsgHeader, body []byte, tcpConn TcpConn,
+                                        tcpState *module_state2.State) error {
+    cb.lock.Lock()
+    cb.subjects = append(cb.subjects, tcpConn.PeerSubject())
+    cb.lock.Unlock()
+
+    return cb.echoCallBacks.RecvMsgProc(header, body, tcpConn, tcpState)
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+    dir, err := ioutil.TempDir("", "net_server_tls")
+    if err != nil {
+        t.Fatalf("TempDir(): %s", err.Error())
+    }
+    defer os.RemoveAll(dir)
+
+    // prepare certificates
+    ca, caKey := certCreate(t, "ca", 1, true, nil, nil)
+    server, serverKey := certCreate(t, "server", 2, false, ca, caKey)
+    client, clientKey := certCreate(t, "client", 3, false, ca, caKey)
+
+    conf := TLSConf{
+        CertFile:       filepath.Join(dir, "server.crt"),
+        KeyFile:        filepath.Join(dir, "server.key"),
+        ClientCAFile:   filepath.Join(dir, "ca.crt"),
+    }
+    certWrite(t, server, serverKey, conf.CertFile, conf.KeyFile)
+    certWrite(t, ca, nil, conf.ClientCAFile, "")
+
+    callBacks := new(subjectCallBacks)
+    srv := NewTcpServer(callBacks)
+    if err := srv.ListenAndServeTLS("tcp", "127.0.0.1:0", conf); err != nil {
+        t.Fatalf("ListenAndServeTLS(): %s", err.Error())
+    }
+    defer srv.Shutdown(context.Background())
+    addr := srv.Listener.Addr().String()
+
+    roots := x509.NewCertPool()
+    roots.AddCert(ca)
+    clientConfig := &tls.Config{
+        RootCAs:        roots,
+        ServerName:     "localhost",
+        Certificates:   []tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}},
+    }
+
+    // request with client certificate
+    conn, err := tls.Dial("tcp", addr, clientConfig)
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    defer conn.Close()
+    if err := requestSend(conn, 1, "hello"); err != nil {
+        t.Fatalf("requestSend(): %s", err.Error())
+    }
+    if _, body, err := responseRead(conn); err != nil || body != "hello" {
+        t.Fatalf("responseRead(): %s %v", body, err)
+    }
+    callBacks.lock.Lock()
+    if len(callBacks.subjects) != 1 || callBacks.subjects[0] != "CN=client,O=test" {
+        t.Errorf("unexpected peer subject: %v", callBacks.subjects)
+    }
+    callBacks.lock.Unlock()
+
+    // no client certificate
+    noCertConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+    if conn, err := tls.Dial("tcp", addr, noCertConfig); err == nil {
+        conn.SetReadDeadline(time.Now().Add(time.Second))
+        requestSend(conn, 1, "hello")
+        if _, _, err := responseRead(conn); err == nil {
+            t.Errorf("connection without client certificate should be refused")
+        }
+        conn.Close()
+    }
+
+    // reload server certificate
+    server2, server2Key := certCreate(t, "server2", 4, false, ca, caKey)
+    certWrite(t, server2, server2Key, conf.CertFile, conf.KeyFile)
+    if err := srv.TLSReload(); err != nil {
+        t.Fatalf("TLSReload(): %s", err.Error())
+    }
+    conn2, err := tls.Dial("tcp", addr, clientConfig)
+    if err != nil {
+        t.Fatalf("Dial(): %s", err.Error())
+    }
+    defer conn2.Close()
+    peer := conn2.ConnectionState().PeerCertificates[0]
+    if peer.Subject.CommonName != "server2" {
+        t.Errorf("certificate should be reloaded, got %s", peer.Subject.CommonName)
+    }
+
+    // reload fails, certificate loaded last is used
+    os.Remove(conf.KeyFile)
+    if err := srv.TLSReload(); err == nil {
+        t.Errorf("TLSReload() should fail")
+    }
+    if conn3, err := tls.Dial("tcp", addr, clientConfig); err != nil {
+        t.Errorf("Dial() after reload failure: %s", err.Error())
+    } else {
+        conn3.Close()
+    }
+}
+
+func TestTLSReloadNotEnabled(t *testing.T) {
+    srv := NewTcpServer(&echoCallBacks{})
+    if err := srv.TLSReload(); err != ErrTLSNotEnabled {
+        t.Errorf("err should be ErrTLSNotEnabled, got %v", err)
+    }
+}
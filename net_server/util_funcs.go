@@ -121,7 +121,7 @@ func ReadHeader(conn net.Conn, buff []byte, len int,
 
 	/* compare with magic string    */
 	if header.MagicStr != MAGIC_STR {
-		err = errors.New("magic number is wrong")
+		err = ErrMagicStr
 		if tcpState != nil {
 			tcpState.Inc("TCP_HEADER_MAGIC_ERR", 1)
 		}
@@ -0,0 +1,161 @@
+/* chunked_buffer.go - an io.ReadWriter backed by a list of pooled chunks */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+ChunkedBuffer is a PipeBuffer without limit of size. Data is kept in a list
+of chunks of 4k, 16k or 64k, so large bodies don't need one big allocation,
+and data is never moved or copied as the buffer grows.
+
+Chunks are taken from package-level pools, and put back once they are read
+or the buffer is Reset(). Chunks grow from 4k to 64k as the list grows.
+
+For limiting memory, use ChunkedBuffer with Pipe.SetLimit().
+
+Usage:
+    pool := NewChunkedBufferPool()
+    p := NewPipeFromBufferPool(pool)
+    p.SetLimit(1024 * 1024)
+    defer p.Release(pool)
+*/
+
+package pipe
+
+import (
+	"io"
+	"sync"
+)
+
+// size of chunks, in ascending order
+var chunkSizes = []int{4 << 10, 16 << 10, 64 << 10}
+
+// pools of chunks, for each size in chunkSizes
+var chunkPools = func() []*sync.Pool {
+	pools := make([]*sync.Pool, len(chunkSizes))
+	for i, size := range chunkSizes {
+		size, class := size, i
+		pools[i] = &sync.Pool{
+			New: func() interface{} {
+				return &chunk{buf: make([]byte, size), class: class}
+			},
+		}
+	}
+	return pools
+}()
+
+// chunk of ChunkedBuffer
+type chunk struct {
+	buf   []byte
+	r, w  int
+	class int // index in chunkSizes
+}
+
+// get chunk of given class, or larger one for holding size bytes
+func chunkGet(class int, size int) *chunk {
+	for class < len(chunkSizes)-1 && chunkSizes[class] < size {
+		class++
+	}
+	return chunkPools[class].Get().(*chunk)
+}
+
+// put chunk back to pool
+func chunkPut(c *chunk) {
+	c.r = 0
+	c.w = 0
+	chunkPools[c.class].Put(c)
+}
+
+// ChunkedBuffer is an io.ReadWriter backed by a list of pooled chunks.
+type ChunkedBuffer struct {
+	chunks []*chunk
+	len    int
+}
+
+// NewChunkedBufferPool creates pool of ChunkedBuffer, for NewPipeFromBufferPool()
+func NewChunkedBufferPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return new(ChunkedBuffer)
+		},
+	}
+}
+
+// Len returns the number of bytes of the unread portion of the buffer.
+func (b *ChunkedBuffer) Len() int {
+	return b.len
+}
+
+// Read copies bytes from the buffer into p.
+// Like bytes.Buffer, it returns io.EOF when no data is available.
+func (b *ChunkedBuffer) Read(p []byte) (n int, err error) {
+	if b.len == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	for n < len(p) && b.len > 0 {
+		c := b.chunks[0]
+		m := copy(p[n:], c.buf[c.r:c.w])
+		c.r += m
+		n += m
+		b.len -= m
+
+		if c.r < c.w {
+			continue
+		}
+		if len(b.chunks) == 1 {
+			// keep the last chunk for following writes
+			c.r = 0
+			c.w = 0
+			break
+		}
+		chunkPut(c)
+		b.chunks[0] = nil
+		b.chunks = b.chunks[1:]
+	}
+	return n, nil
+}
+
+// Write copies bytes from p into the buffer, new chunks are added as needed.
+func (b *ChunkedBuffer) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		var c *chunk
+		if len(b.chunks) > 0 {
+			c = b.chunks[len(b.chunks)-1]
+		}
+		if c == nil || c.w == len(c.buf) {
+			// chunks grow as the list grows
+			class := len(b.chunks)
+			if c != nil && c.class+1 > class {
+				class = c.class + 1
+			}
+			if class >= len(chunkSizes) {
+				class = len(chunkSizes) - 1
+			}
+			c = chunkGet(class, len(p))
+			b.chunks = append(b.chunks, c)
+		}
+
+		m := copy(c.buf[c.w:], p)
+		c.w += m
+		b.len += m
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Reset clears state of ChunkedBuffer, all chunks are put back to pools.
+func (b *ChunkedBuffer) Reset() {
+	for i, c := range b.chunks {
+		chunkPut(c)
+		b.chunks[i] = nil
+	}
+	b.chunks = nil
+	b.len = 0
+}
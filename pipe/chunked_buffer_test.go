@@ -0,0 +1,106 @@
+/* chunked_buffer_test.go - test for chunked_buffer.go */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+
+package pipe
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestChunkedBuffer(t *testing.T) {
+	b := new(ChunkedBuffer)
+	if _, err := b.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read error = %v; want io.EOF", err)
+	}
+
+	// data across chunks of growing size
+	data := make([]byte, 100<<10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if n, err := b.Write(data); n != len(data) || err != nil {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if b.Len() != len(data) {
+		t.Errorf("Len() = %d; want %d", b.Len(), len(data))
+	}
+	sizes := make([]int, 0)
+	for _, c := range b.chunks {
+		sizes = append(sizes, len(c.buf))
+	}
+	if len(sizes) != 2 || sizes[0] != 64<<10 || sizes[1] != 64<<10 {
+		// a single large write takes the largest chunks
+		t.Errorf("unexpected sizes of chunks: %v", sizes)
+	}
+
+	read := make([]byte, 0, len(data))
+	buf := make([]byte, 3000)
+	for b.Len() > 0 {
+		n, _ := b.Read(buf)
+		read = append(read, buf[:n]...)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("data read is not equal to data written")
+	}
+	if len(b.chunks) != 1 {
+		t.Errorf("drained chunks should be released, got %d chunks", len(b.chunks))
+	}
+
+	// small writes, chunks grow from 4k
+	b.Reset()
+	for i := 0; i < 30; i++ {
+		b.Write(data[:1<<10])
+	}
+	if len(b.chunks) != 3 || len(b.chunks[0].buf) != 4<<10 ||
+		len(b.chunks[1].buf) != 16<<10 || len(b.chunks[2].buf) != 64<<10 {
+		t.Errorf("chunks should grow from 4k to 64k")
+	}
+
+	b.Reset()
+	if b.Len() != 0 || b.chunks != nil {
+		t.Errorf("chunks should be released by Reset()")
+	}
+}
+
+func TestPipeWithChunkedBuffer(t *testing.T) {
+	pool := NewChunkedBufferPool()
+	p := NewPipeFromBufferPool(pool)
+	p.SetLimit(32 << 10)
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	go func() {
+		p.Write(data)
+		p.CloseWrite()
+	}()
+	all, err := ioutil.ReadAll(p)
+	if !bytes.Equal(all, data) || err != nil {
+		t.Errorf("ReadAll() = %d bytes, %v", len(all), err)
+	}
+	p.Release(pool)
+}
+
+func BenchmarkChunkedBuffer1K(b *testing.B) {
+	benchmarkPipeBuffer(b, new(ChunkedBuffer), 1<<10)
+}
+
+func BenchmarkChunkedBuffer64K(b *testing.B) {
+	benchmarkPipeBuffer(b, new(ChunkedBuffer), 64<<10)
+}
+
+func BenchmarkChunkedBuffer1M(b *testing.B) {
+	benchmarkPipeBuffer(b, new(ChunkedBuffer), 1<<20)
+}
+
+func BenchmarkBytesBuffer1M(b *testing.B) {
+	benchmarkPipeBuffer(b, new(bytes.Buffer), 1<<20)
+}
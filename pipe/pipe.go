@@ -4,10 +4,19 @@ modification history
 --------------------
 2016/05/11, by Sijie Yang, modify
     - add NewPipeFromBufferPool() to optimize memory usage
+2026/10/18, by agent, modify
+    - add write limit, deadlines and CloseWrite()
 */
 /*
 DESCRIPTION
 This file is derived from net/http2/pipe.go
+
+Besides the original Pipe, it supports:
+- write limit: Write blocks while the buffer holds limit bytes, see SetLimit()
+- deadlines: blocked Read/Write returns ErrTimeout after deadline, see
+  SetReadDeadline() and SetWriteDeadline()
+- half-close: after CloseWrite(), Write fails and Read returns io.EOF once the
+  buffer is drained. Unlike CloseWithError, Done() is not closed.
 */
 
 // Copyright 2014 The Go Authors. All rights reserved.
@@ -17,9 +26,11 @@ This file is derived from net/http2/pipe.go
 package pipe
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"sync"
+	"time"
 )
 
 // Pipe is a goroutine-safe io.Reader/io.Writer pair.  It's like
@@ -33,6 +44,13 @@ type Pipe struct {
 	breakErr error         // immediate read error (caller doesn't see rest of b)
 	donec    chan struct{} // closed on error
 	readFn   func()        // optional code to run in Read before error
+
+	limit         int         // max bytes in b, Write blocks when reached; 0 for no limit
+	writeClosed   bool        // CloseWrite() called
+	readTimer     *time.Timer // wakes waiters at readDeadline
+	writeTimer    *time.Timer // wakes waiters at writeDeadline
+	readDeadline  time.Time
+	writeDeadline time.Time
 }
 
 type PipeBuffer interface {
@@ -42,19 +60,46 @@ type PipeBuffer interface {
 	io.Reader
 }
 
+// timeoutError is returned by Read/Write after deadline, it is a net.Error
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "pipe: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// ErrTimeout is returned by Read/Write after deadline
+var ErrTimeout error = timeoutError{}
+
+// requires p.mu be held.
+func (p *Pipe) condInitLocked() {
+	if p.c.L == nil {
+		p.c.L = &p.mu
+	}
+}
+
+// whether deadline is set and exceeded
+func deadlineExceeded(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
 // Read waits until data is available and copies bytes
 // from the buffer into p.
 func (p *Pipe) Read(d []byte) (n int, err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.c.L == nil {
-		p.c.L = &p.mu
-	}
+	p.condInitLocked()
 	for {
 		if p.breakErr != nil {
 			return 0, p.breakErr
 		}
+		if deadlineExceeded(p.readDeadline) {
+			return 0, ErrTimeout
+		}
 		if p.b != nil && p.b.Len() > 0 {
+			if p.limit > 0 {
+				// wake writers waiting for space
+				p.c.Broadcast()
+			}
 			return p.b.Read(d)
 		}
 		if p.err != nil {
@@ -64,6 +109,9 @@ func (p *Pipe) Read(d []byte) (n int, err error) {
 			}
 			return 0, p.err
 		}
+		if p.writeClosed {
+			return 0, io.EOF
+		}
 		p.c.Wait()
 	}
 }
@@ -71,21 +119,108 @@ func (p *Pipe) Read(d []byte) (n int, err error) {
 var errClosedPipeWrite = errors.New("write on closed buffer")
 
 // Write copies bytes from p into the buffer and wakes a reader.
-// It is an error to write more data than the buffer can hold.
+// If write limit is set, it blocks until all bytes are copied.
+// Otherwise, it is an error to write more data than the buffer can hold.
+// After BreakWithError, data is discarded.
 func (p *Pipe) Write(d []byte) (n int, err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.c.L == nil {
-		p.c.L = &p.mu
+	p.condInitLocked()
+	defer p.c.Broadcast()
+	for {
+		if p.err != nil || p.writeClosed || p.b == nil {
+			return n, errClosedPipeWrite
+		}
+		if p.breakErr != nil {
+			// reader is gone, discard data
+			return n + len(d), nil
+		}
+		if deadlineExceeded(p.writeDeadline) {
+			return n, ErrTimeout
+		}
+		if p.limit <= 0 {
+			m, err := p.b.Write(d)
+			return n + m, err
+		}
+
+		room := p.limit - p.b.Len()
+		if room <= 0 {
+			p.c.Wait()
+			continue
+		}
+		if room > len(d) {
+			room = len(d)
+		}
+		m, err := p.b.Write(d[:room])
+		n += m
+		d = d[m:]
+		if err != nil || len(d) == 0 {
+			return n, err
+		}
+		// wake reader before waiting for space
+		p.c.Broadcast()
 	}
-	defer p.c.Signal()
-	if p.err != nil {
-		return 0, errClosedPipeWrite
+}
+
+// SetLimit sets max number of bytes in the buffer, 0 for no limit.
+// Write blocks while the buffer holds limit bytes.
+func (p *Pipe) SetLimit(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.condInitLocked()
+	p.limit = limit
+	p.c.Broadcast()
+}
+
+// SetReadDeadline sets deadline for Read, zero value for no deadline.
+// A blocked Read is woken up and returns ErrTimeout after deadline.
+func (p *Pipe) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadlineSetLocked(&p.readDeadline, &p.readTimer, t)
+	return nil
+}
+
+// SetWriteDeadline sets deadline for Write, zero value for no deadline.
+// A blocked Write is woken up and returns ErrTimeout after deadline.
+func (p *Pipe) SetWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadlineSetLocked(&p.writeDeadline, &p.writeTimer, t)
+	return nil
+}
+
+// requires p.mu be held.
+func (p *Pipe) deadlineSetLocked(deadline *time.Time, timer **time.Timer, t time.Time) {
+	p.condInitLocked()
+	*deadline = t
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
 	}
-	if p.b == nil {
-		return 0, errClosedPipeWrite
+	// waiters check the new deadline
+	p.c.Broadcast()
+
+	d := t.Sub(time.Now())
+	if t.IsZero() || d <= 0 {
+		return
 	}
-	return p.b.Write(d)
+	*timer = time.AfterFunc(d, func() {
+		p.mu.Lock()
+		p.c.Broadcast()
+		p.mu.Unlock()
+	})
+}
+
+// CloseWrite closes the write half of the pipe. Following Writes fail, and
+// Read returns io.EOF after all data has been read.
+// Unlike CloseWithError, it does not close the channel returned by Done().
+func (p *Pipe) CloseWrite() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.condInitLocked()
+	p.writeClosed = true
+	p.c.Broadcast()
 }
 
 // CloseWithError causes the next Read (waking up a current blocked
@@ -110,10 +245,9 @@ func (p *Pipe) closeWithError(dst *error, err error, fn func()) {
 	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.c.L == nil {
-		p.c.L = &p.mu
-	}
-	defer p.c.Signal()
+	p.condInitLocked()
+	// wake both readers and writers blocked by write limit
+	defer p.c.Broadcast()
 	if *dst != nil {
 		// Already been done.
 		return
@@ -168,6 +302,15 @@ func NewPipeWithSize(size uint32) *Pipe {
 	return p
 }
 
+// NewPipeWithLimit creates Pipe with growing buffer, Write blocks while the
+// buffer holds limit bytes
+func NewPipeWithLimit(limit int) *Pipe {
+	p := new(Pipe)
+	p.b = new(bytes.Buffer)
+	p.limit = limit
+	return p
+}
+
 func NewPipeFromBufferPool(pool *sync.Pool) *Pipe {
 	p := new(Pipe)
 	p.b = pool.Get().(PipeBuffer)
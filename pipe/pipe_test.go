@@ -9,7 +9,9 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestPipeClose(t *testing.T) {
@@ -107,3 +109,108 @@ func TestPipeBreakWithError(t *testing.T) {
 		t.Logf("read error = %v, %v", err, a)
 	}
 }
+
+func TestPipeWriteLimit(t *testing.T) {
+	p := NewPipeWithLimit(4)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(p, "hello world")
+		done <- err
+	}()
+
+	// writer is blocked once limit is reached
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("write should be blocked, got %v", err)
+	default:
+	}
+	p.mu.Lock()
+	if n := p.b.Len(); n != 4 {
+		t.Errorf("buffered bytes = %d; want 4", n)
+	}
+	p.mu.Unlock()
+
+	// writer is unblocked by reader
+	buf := make([]byte, len("hello world"))
+	if _, err := io.ReadFull(p, buf); err != nil || string(buf) != "hello world" {
+		t.Errorf("ReadFull() = %q, %v", buf, err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("write error = %v", err)
+	}
+}
+
+func TestPipeWriteLimitBreak(t *testing.T) {
+	p := NewPipeWithLimit(4)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(p, "hello world")
+		done <- err
+	}()
+
+	// data is discarded after BreakWithError
+	time.Sleep(20 * time.Millisecond)
+	p.BreakWithError(errors.New("reader gone"))
+	if err := <-done; err != nil {
+		t.Errorf("write error = %v", err)
+	}
+}
+
+func TestPipeDeadline(t *testing.T) {
+	p := NewPipeWithLimit(4)
+
+	// blocked read is woken up by deadline
+	p.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err := p.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("read error = %v; want timeout", err)
+	}
+
+	// deadline is cleared
+	p.SetReadDeadline(time.Time{})
+	io.WriteString(p, "a")
+	if n, err := p.Read(make([]byte, 1)); n != 1 || err != nil {
+		t.Errorf("Read() = %d, %v", n, err)
+	}
+
+	// blocked write is woken up by deadline
+	p.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	n, err := io.WriteString(p, "hello world")
+	if n != 4 || err != ErrTimeout {
+		t.Errorf("Write() = %d, %v; want 4, ErrTimeout", n, err)
+	}
+
+	// deadline in the past
+	p.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := io.WriteString(p, "a"); err != ErrTimeout {
+		t.Errorf("write error = %v; want ErrTimeout", err)
+	}
+}
+
+func TestPipeCloseWrite(t *testing.T) {
+	p := &Pipe{b: new(bytes.Buffer)}
+	done := p.Done()
+	io.WriteString(p, "foo")
+	p.CloseWrite()
+
+	if _, err := io.WriteString(p, "bar"); err != errClosedPipeWrite {
+		t.Errorf("write error = %v; want %v", err, errClosedPipeWrite)
+	}
+	all, err := ioutil.ReadAll(p)
+	if string(all) != "foo" || err != nil {
+		t.Errorf("ReadAll() = %q, %v", all, err)
+	}
+	select {
+	case <-done:
+		t.Errorf("done should not be closed by CloseWrite")
+	default:
+	}
+
+	// error from CloseWithError takes precedence over io.EOF
+	a := errors.New("a")
+	p.CloseWithError(a)
+	if _, err := p.Read(make([]byte, 1)); err != a {
+		t.Errorf("read error = %v; want %v", err, a)
+	}
+}
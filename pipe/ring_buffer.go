@@ -0,0 +1,121 @@
+/* ring_buffer.go - an io.ReadWriter backed by a ring buffer */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+RingBuffer is a PipeBuffer of fixed capacity. Unlike FixedBuffer, data is
+never moved: read and write positions wrap around the end of the buffer.
+
+Read only updates the read position, and Write only updates the write
+position, both by atomic operations. So one reader and one writer may use
+RingBuffer concurrently without lock, e.g., outside of Pipe.
+
+Usage:
+    pool := NewRingBufferPool(64 * 1024)
+    p := NewPipeFromBufferPool(pool)
+    defer p.Release(pool)
+*/
+
+package pipe
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	errRingReadEmpty = errors.New("read from empty RingBuffer")
+	errRingWriteFull = errors.New("write on full RingBuffer")
+)
+
+// RingBuffer is an io.ReadWriter backed by a ring buffer.
+// It never allocates after created.
+type RingBuffer struct {
+	buf  []byte
+	mask uint64 // len(buf) - 1, len(buf) is power of 2
+	r    uint64 // total bytes read, updated by Read only
+	w    uint64 // total bytes written, updated by Write only
+}
+
+// NewRingBuffer creates RingBuffer, size is rounded up to power of 2
+func NewRingBuffer(size int) *RingBuffer {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	b := new(RingBuffer)
+	b.buf = make([]byte, n)
+	b.mask = uint64(n - 1)
+	return b
+}
+
+// NewRingBufferPool creates pool of RingBuffer, for NewPipeFromBufferPool()
+func NewRingBufferPool(size int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return NewRingBuffer(size)
+		},
+	}
+}
+
+// Len returns the number of bytes of the unread portion of the buffer.
+func (b *RingBuffer) Len() int {
+	return int(atomic.LoadUint64(&b.w) - atomic.LoadUint64(&b.r))
+}
+
+// Cap returns capacity of the buffer.
+func (b *RingBuffer) Cap() int {
+	return len(b.buf)
+}
+
+// Read copies bytes from the buffer into p.
+// It is an error to read when no data is available.
+func (b *RingBuffer) Read(p []byte) (n int, err error) {
+	r := atomic.LoadUint64(&b.r)
+	w := atomic.LoadUint64(&b.w)
+	if r == w {
+		return 0, errRingReadEmpty
+	}
+
+	n = int(w - r)
+	if n > len(p) {
+		n = len(p)
+	}
+	m := copy(p[:n], b.buf[r&b.mask:])
+	copy(p[m:n], b.buf)
+
+	atomic.StoreUint64(&b.r, r+uint64(n))
+	return n, nil
+}
+
+// Write copies bytes from p into the buffer.
+// It is an error to write more data than the buffer can hold.
+func (b *RingBuffer) Write(p []byte) (n int, err error) {
+	r := atomic.LoadUint64(&b.r)
+	w := atomic.LoadUint64(&b.w)
+
+	n = len(b.buf) - int(w-r)
+	if n > len(p) {
+		n = len(p)
+	}
+	m := copy(b.buf[w&b.mask:], p[:n])
+	copy(b.buf, p[m:n])
+
+	atomic.StoreUint64(&b.w, w+uint64(n))
+	if n < len(p) {
+		err = errRingWriteFull
+	}
+	return n, err
+}
+
+// Reset clears state of RingBuffer.
+// It should not be called concurrently with Read or Write.
+func (b *RingBuffer) Reset() {
+	atomic.StoreUint64(&b.r, 0)
+	atomic.StoreUint64(&b.w, 0)
+}
@@ -0,0 +1,142 @@
+/* ring_buffer_test.go - test for ring_buffer.go */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+*/
+
+package pipe
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	b := NewRingBuffer(5)
+	if b.Cap() != 8 {
+		t.Fatalf("Cap() = %d; want 8", b.Cap())
+	}
+
+	read := make([]byte, 8)
+	if _, err := b.Read(read); err != errRingReadEmpty {
+		t.Errorf("read error = %v; want %v", err, errRingReadEmpty)
+	}
+
+	// write and read across the end of buffer
+	for i, s := range []string{"abcde", "fghij", "klmno"} {
+		if n, err := b.Write([]byte(s)); n != 5 || err != nil {
+			t.Fatalf("#%d: Write() = %d, %v", i, n, err)
+		}
+		if b.Len() != 5 {
+			t.Errorf("#%d: Len() = %d; want 5", i, b.Len())
+		}
+		if n, err := b.Read(read); n != 5 || err != nil || string(read[:n]) != s {
+			t.Errorf("#%d: Read() = %q, %v", i, read[:n], err)
+		}
+	}
+
+	// write more than capacity
+	n, err := b.Write([]byte("0123456789"))
+	if n != 8 || err != errRingWriteFull {
+		t.Errorf("Write() = %d, %v; want 8, %v", n, err, errRingWriteFull)
+	}
+	if n, _ := b.Read(read[:3]); string(read[:n]) != "012" {
+		t.Errorf("Read() = %q; want 012", read[:n])
+	}
+
+	b.Reset()
+	if b.Len() != 0 {
+		t.Errorf("Len() = %d after Reset(); want 0", b.Len())
+	}
+}
+
+// one reader and one writer, without lock
+func TestRingBufferConcurrent(t *testing.T) {
+	b := NewRingBuffer(16)
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for p := data; len(p) > 0; {
+			n, _ := b.Write(p)
+			if n == 0 {
+				runtime.Gosched()
+			}
+			p = p[n:]
+		}
+	}()
+
+	read := make([]byte, 0, len(data))
+	buf := make([]byte, 7)
+	for len(read) < len(data) {
+		n, _ := b.Read(buf)
+		if n == 0 {
+			runtime.Gosched()
+		}
+		read = append(read, buf[:n]...)
+	}
+	wg.Wait()
+
+	if !bytes.Equal(read, data) {
+		t.Errorf("data read is not equal to data written")
+	}
+}
+
+func TestPipeWithRingBuffer(t *testing.T) {
+	pool := NewRingBufferPool(8)
+	p := NewPipeFromBufferPool(pool)
+	p.SetLimit(8)
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	go func() {
+		p.Write(data)
+		p.CloseWrite()
+	}()
+	all, err := ioutil.ReadAll(p)
+	if !bytes.Equal(all, data) || err != nil {
+		t.Errorf("ReadAll() = %q, %v", all, err)
+	}
+	p.Release(pool)
+}
+
+/* write and read data in chunks of given size through buffer */
+func benchmarkPipeBuffer(b *testing.B, buf PipeBuffer, size int) {
+	data := make([]byte, size)
+	read := make([]byte, size)
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Write(data)
+		if _, err := io.ReadFull(buf, read); err != nil {
+			b.Fatalf("ReadFull(): %s", err.Error())
+		}
+	}
+}
+
+func BenchmarkBytesBuffer1K(b *testing.B) {
+	benchmarkPipeBuffer(b, new(bytes.Buffer), 1<<10)
+}
+
+func BenchmarkBytesBuffer64K(b *testing.B) {
+	benchmarkPipeBuffer(b, new(bytes.Buffer), 64<<10)
+}
+
+func BenchmarkRingBuffer1K(b *testing.B) {
+	benchmarkPipeBuffer(b, NewRingBuffer(64<<10), 1<<10)
+}
+
+func BenchmarkRingBuffer64K(b *testing.B) {
+	benchmarkPipeBuffer(b, NewRingBuffer(64<<10), 64<<10)
+}
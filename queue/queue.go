@@ -3,6 +3,9 @@
 modification history
 --------------------
 2014/3/10, by Zhang Miao, create
+2026/10/18, by agent, modify
+    - add AppendWait(), AppendForce() and TryRemove() for bounded queue
+    - add Close() to wake up and fail producers
 */
 /*
 DESCRIPTION
@@ -20,6 +23,17 @@ Usage:
     msg = q.Remove()
     // type convert is required here
     msgStr := msg.(string)
+
+    // for queue with max length
+    q.SetMaxLen(100)
+    err := q.Append("abcd")     // fail if queue is full
+    err = q.AppendWait("abcd")  // wait until queue is not full
+    q.AppendForce("abcd")       // ignore max length
+    msg, ok := q.TryRemove()    // not wait if queue is empty
+
+    // Append() and AppendWait() fail after Close(), waiters are woken up;
+    // items in queue can still be removed
+    q.Close()
 */
 package queue
 
@@ -29,17 +43,23 @@ import (
     "sync"    
 )
 
+var ErrQueueFull = errors.New("Queue is full")
+var ErrQueueClosed = errors.New("Queue is closed")
+
 /* queue    */
 type Queue struct {
     lock    sync.Mutex
-    cond    *sync.Cond
+    cond    *sync.Cond      // signaled when queue is not empty
+    notFull *sync.Cond      // signaled when queue is not full
     queue   *list.List 
     maxLen  int             // max queue length   
+    closed  bool            // whether Close() is called
 }
 
 /* Initialize the queue */
 func (q *Queue) Init() {
     q.cond = sync.NewCond(&q.lock)
+    q.notFull = sync.NewCond(&q.lock)
     q.queue = list.New()
     q.maxLen = -1
 }
@@ -48,17 +68,34 @@ func (q *Queue) Init() {
 func (q *Queue) SetMaxLen(maxLen int) {
     q.lock.Lock()
     q.maxLen = maxLen
+    // waiters in AppendWait() should check again
+    q.notFull.Broadcast()
     q.lock.Unlock()    
 }
 
+/* whether queue is full, q.lock should be held */
+func (q *Queue) isFull() bool {
+    return q.maxLen != -1 && q.queue.Len() >= q.maxLen
+}
+
+/* Close the queue, wake up and fail waiters in AppendWait()    */
+func (q *Queue) Close() {
+    q.lock.Lock()
+    q.closed = true
+    q.notFull.Broadcast()
+    q.lock.Unlock()
+}
+
 /* Add to the queue */
 func (q *Queue) Append(item interface{}) error {
     var err error
     
     q.cond.L.Lock()
     
-    if q.maxLen != -1 && q.queue.Len() >= q.maxLen {
-        err = errors.New("Queue is full")
+    if q.closed {
+        err = ErrQueueClosed
+    } else if q.isFull() {
+        err = ErrQueueFull
     } else {
         q.queue.PushBack(item)
         q.cond.Signal()
@@ -69,6 +106,33 @@ func (q *Queue) Append(item interface{}) error {
     return err
 }
 
+/* Add to the queue, wait if queue is full; return ErrQueueClosed if queue is closed   */
+func (q *Queue) AppendWait(item interface{}) error {
+    q.cond.L.Lock()
+    defer q.cond.L.Unlock()
+
+    for !q.closed && q.isFull() {
+        q.notFull.Wait()
+    }
+    if q.closed {
+        return ErrQueueClosed
+    }
+    q.queue.PushBack(item)
+    q.cond.Signal()
+
+    return nil
+}
+
+/* Add to the queue, even if queue is full or closed  */
+func (q *Queue) AppendForce(item interface{}) {
+    q.cond.L.Lock()
+
+    q.queue.PushBack(item)
+    q.cond.Signal()
+
+    q.cond.L.Unlock()
+}
+
 /* Remove from the queue */
 func (q *Queue) Remove() interface{} {
     q.cond.L.Lock()
@@ -79,12 +143,29 @@ func (q *Queue) Remove() interface{} {
         
     item := q.queue.Front()
     q.queue.Remove(item)
+    q.notFull.Signal()
     
     q.cond.L.Unlock()
 
     return item.Value
 }
 
+/* Remove from the queue, return false if queue is empty    */
+func (q *Queue) TryRemove() (interface{}, bool) {
+    q.cond.L.Lock()
+    defer q.cond.L.Unlock()
+
+    if q.queue.Len() == 0 {
+        return nil, false
+    }
+
+    item := q.queue.Front()
+    q.queue.Remove(item)
+    q.notFull.Signal()
+
+    return item.Value, true
+}
+
 /* Get length of the queue */
 func (q *Queue) Len() int {
     var len int
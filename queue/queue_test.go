@@ -3,6 +3,9 @@
 modification history
 --------------------
 2014/3/10, by Zhang Miao, create
+2026/10/18, by agent, modify
+    - add test for AppendWait(), AppendForce() and TryRemove()
+    - add test for Close()
 */
 /*
 DESCRIPTION
@@ -61,3 +64,108 @@ func TestQueueIsFull(t *testing.T) {
         }
     }    
 }
+
+func TestQueueAppendWait(t *testing.T) {
+    var queue Queue
+    queue.Init()
+    queue.SetMaxLen(1)
+
+    queue.AppendWait(0)
+
+    // wait until an item is removed
+    done := make(chan bool)
+    go func() {
+        queue.AppendWait(1)
+        done <- true
+    }()
+
+    select {
+    case <-done:
+        t.Fatal("queue.AppendWait() should wait when queue is full")
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    if item := queue.Remove(); item.(int) != 0 {
+        t.Errorf("queue.Remove() should return 0, got %v", item)
+    }
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("queue.AppendWait() should return after queue.Remove()")
+    }
+
+    // wake up by SetMaxLen()
+    go func() {
+        queue.AppendWait(2)
+        done <- true
+    }()
+    time.Sleep(10 * time.Millisecond)
+    queue.SetMaxLen(-1)
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("queue.AppendWait() should return after queue.SetMaxLen()")
+    }
+}
+
+func TestQueueAppendForce(t *testing.T) {
+    var queue Queue
+    queue.Init()
+    queue.SetMaxLen(1)
+
+    queue.Append(0)
+    queue.AppendForce(1)
+    if queue.Len() != 2 {
+        t.Errorf("queue.AppendForce() should ignore max length")
+    }
+
+    for i := 0; i < 2; i++ {
+        item, ok := queue.TryRemove()
+        if !ok || item.(int) != i {
+            t.Errorf("queue.TryRemove() should return %d, got %v %v", i, item, ok)
+        }
+    }
+    if _, ok := queue.TryRemove(); ok {
+        t.Errorf("queue.TryRemove() should return false for empty queue")
+    }
+}
+
+func TestQueueClose(t *testing.T) {
+    var queue Queue
+    queue.Init()
+    queue.SetMaxLen(1)
+
+    queue.Append(0)
+
+    // wake up and fail by Close()
+    done := make(chan error)
+    go func() {
+        done <- queue.AppendWait(1)
+    }()
+    time.Sleep(10 * time.Millisecond)
+    queue.Close()
+    select {
+    case err := <-done:
+        if err != ErrQueueClosed {
+            t.Errorf("queue.AppendWait() should return ErrQueueClosed, got %v", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("queue.AppendWait() should return after queue.Close()")
+    }
+
+    if err := queue.AppendWait(2); err != ErrQueueClosed {
+        t.Errorf("queue.AppendWait() should return ErrQueueClosed, got %v", err)
+    }
+    if err := queue.Append(3); err != ErrQueueClosed {
+        t.Errorf("queue.Append() should return ErrQueueClosed, got %v", err)
+    }
+
+    // items in queue can still be removed
+    queue.AppendForce(4)
+    for _, i := range []int{0, 4} {
+        item, ok := queue.TryRemove()
+        if !ok || item.(int) != i {
+            t.Errorf("queue.TryRemove() should return %d, got %v %v", i, item, ok)
+        }
+    }
+}
@@ -0,0 +1,345 @@
+/* balancer.go - load balancing policies for Client */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+    - move Weighted Round Robin from client.go
+    - add least pending calls, power of two choices and consistent hashing
+*/
+/*
+DESCRIPTION
+Balancer selects one SClient from the clients of Client for each request.
+All methods of Balancer are called with Client.mutex held, so Balancer
+need not be goroutine-safe.
+
+Usage:
+    // select balancer by option
+    client := NewClientByAddr("tcp", addrInfo, 1*time.Second, 8, nil, 100,
+        WithBalancer(NewHashBalancer()))
+
+    // requests with the same key are sent to the same backend
+    err := client.CallByKey(userId, request, response, 10*time.Millisecond)
+*/
+
+package remote
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+)
+
+// name of balancers
+const (
+	BALANCE_WRR           = "wrr"           // smooth weighted round robin
+	BALANCE_LEAST_PENDING = "least_pending" // least pending calls
+	BALANCE_P2C           = "p2c"           // power of two choices
+	BALANCE_HASH          = "hash"          // consistent hashing on request key
+)
+
+// number of virtual nodes for each address, in consistent hashing
+const HASH_VIRTUAL_NODES = 160
+
+var (
+	ErrNoClients = fmt.Errorf("no clients in pool")
+	ErrAllBroken = fmt.Errorf("all connections to servers are broken")
+)
+
+// Balancer selects one client for each request
+type Balancer interface {
+	// Init is called when clients of Client are created or updated
+	Init(clients []*SClient)
+
+	// Balance selects an available client for request
+	// key is the request key for affinity; it may be empty
+	// clients to excluded addresses should not be selected; excluded may be nil
+	Balance(clients []*SClient, key string, excluded map[string]bool) (*SClient, error)
+}
+
+/*
+BalancerCreate - create balancer by name
+
+Params:
+    - name: BALANCE_WRR, BALANCE_LEAST_PENDING, BALANCE_P2C or BALANCE_HASH
+
+Returns:
+    (balancer, error)
+*/
+func BalancerCreate(name string) (Balancer, error) {
+	switch name {
+	case BALANCE_WRR:
+		return NewWrrBalancer(), nil
+	case BALANCE_LEAST_PENDING:
+		return NewLeastPendingBalancer(), nil
+	case BALANCE_P2C:
+		return NewP2cBalancer(), nil
+	case BALANCE_HASH:
+		return NewHashBalancer(), nil
+	default:
+		return nil, fmt.Errorf("unknown balancer:%s", name)
+	}
+}
+
+// check whether client is available for request, and not excluded
+func clientAvailable(client *SClient, excluded map[string]bool) bool {
+	if excluded[client.Address] {
+		return false
+	}
+	return atomic.LoadInt32(&client.Status) == CONNECTED && client.breaker.available()
+}
+
+// get number of calls not finished in client
+// Calls waiting for response are counted, besides calls waiting to send as
+// in PendingCallNum(), which is almost always 0 for a healthy connection.
+func clientActiveCalls(client *SClient) int {
+	return client.GetInternal().activeCallNum()
+}
+
+// Weighted Round Robin balancer
+type WrrBalancer struct {
+	index int // current client index
+}
+
+func NewWrrBalancer() *WrrBalancer {
+	return new(WrrBalancer)
+}
+
+func (b *WrrBalancer) Init(clients []*SClient) {
+	for i := 0; i < len(clients); i++ {
+		clients[i].Left = clients[i].Weight
+	}
+	b.index = 0
+}
+
+// select a client using weighted round robin balancing
+// Excluded clients are skipped like unavailable ones, and Left of them is kept.
+func (b *WrrBalancer) Balance(clients []*SClient, key string, excluded map[string]bool) (*SClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoClients
+	}
+	if b.index >= len(clients) {
+		b.index = 0
+	}
+
+	var client *SClient
+	allBroken := true
+	used := b.index
+
+	for {
+		client = clients[used]
+
+		available := clientAvailable(client, excluded)
+		if available && client.Left > 0 {
+			break
+		}
+
+		if available && client.Left <= 0 {
+			allBroken = false
+		}
+
+		// next client to check
+		used = (used + 1) % len(clients)
+
+		// if all clients have been checked
+		if used == b.index {
+			if allBroken {
+				return nil, ErrAllBroken
+			} else {
+				b.Init(clients)
+				used = 0
+			}
+		}
+	}
+	client.Left -= 1
+	b.index = (used + 1) % len(clients)
+
+	return client, nil
+}
+
+// balancer selecting the client with least pending calls
+// Pending calls include calls waiting for response, see clientActiveCalls().
+// Weight of client is not used.
+type LeastPendingBalancer struct {
+	index int // start index for the next selection, to break ties
+}
+
+func NewLeastPendingBalancer() *LeastPendingBalancer {
+	return new(LeastPendingBalancer)
+}
+
+func (b *LeastPendingBalancer) Init(clients []*SClient) {
+	b.index = 0
+}
+
+func (b *LeastPendingBalancer) Balance(clients []*SClient, key string,
+	excluded map[string]bool) (*SClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoClients
+	}
+
+	var best *SClient
+	bestCalls := 0
+	for i := 0; i < len(clients); i++ {
+		client := clients[(b.index+i)%len(clients)]
+		if !clientAvailable(client, excluded) {
+			continue
+		}
+
+		calls := clientActiveCalls(client)
+		if best == nil || calls < bestCalls {
+			best = client
+			bestCalls = calls
+		}
+	}
+	b.index = (b.index + 1) % len(clients)
+
+	if best == nil {
+		return nil, ErrAllBroken
+	}
+	return best, nil
+}
+
+// balancer of power of two choices
+// Two available clients are selected randomly, and the one with less pending
+// calls is used. Weight of client is not used.
+type P2cBalancer struct {
+	rand *rand.Rand
+}
+
+func NewP2cBalancer() *P2cBalancer {
+	b := new(P2cBalancer)
+	b.rand = rand.New(rand.NewSource(rand.Int63()))
+	return b
+}
+
+func (b *P2cBalancer) Init(clients []*SClient) {
+}
+
+func (b *P2cBalancer) Balance(clients []*SClient, key string, excluded map[string]bool) (*SClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoClients
+	}
+
+	// collect available clients
+	available := make([]*SClient, 0, len(clients))
+	for _, client := range clients {
+		if clientAvailable(client, excluded) {
+			available = append(available, client)
+		}
+	}
+
+	switch len(available) {
+	case 0:
+		return nil, ErrAllBroken
+	case 1:
+		return available[0], nil
+	}
+
+	// choose two different clients
+	i := b.rand.Intn(len(available))
+	j := b.rand.Intn(len(available) - 1)
+	if j >= i {
+		j++
+	}
+
+	if clientActiveCalls(available[j]) < clientActiveCalls(available[i]) {
+		return available[j], nil
+	}
+	return available[i], nil
+}
+
+// node in hash ring
+type hashNode struct {
+	hash    uint32
+	address string
+}
+
+type hashRing []hashNode
+
+func (r hashRing) Len() int           { return len(r) }
+func (r hashRing) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r hashRing) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// balancer of consistent hashing on request key
+// Requests with the same key are sent to the same address, unless all
+// connections to the address are broken or the address is excluded; then
+// the next address on the hash ring is used. Requests without key are sent
+// in round robin. Weight of client is not used.
+type HashBalancer struct {
+	ring    hashRing              // hash ring of addresses
+	clients map[string][]*SClient // clients for each address
+	index   int                   // index for round robin
+}
+
+func NewHashBalancer() *HashBalancer {
+	return new(HashBalancer)
+}
+
+func (b *HashBalancer) Init(clients []*SClient) {
+	b.clients = make(map[string][]*SClient)
+	for _, client := range clients {
+		b.clients[client.Address] = append(b.clients[client.Address], client)
+	}
+
+	b.ring = make(hashRing, 0, len(b.clients)*HASH_VIRTUAL_NODES)
+	for address := range b.clients {
+		for i := 0; i < HASH_VIRTUAL_NODES; i++ {
+			hash := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", address, i)))
+			b.ring = append(b.ring, hashNode{hash, address})
+		}
+	}
+	sort.Sort(b.ring)
+	b.index = 0
+}
+
+func (b *HashBalancer) Balance(clients []*SClient, key string, excluded map[string]bool) (*SClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoClients
+	}
+
+	// round robin for request without key
+	if key == "" {
+		for i := 0; i < len(clients); i++ {
+			client := clients[(b.index+i)%len(clients)]
+			if clientAvailable(client, excluded) {
+				b.index = (b.index + i + 1) % len(clients)
+				return client, nil
+			}
+		}
+		return nil, ErrAllBroken
+	}
+
+	if b.ring == nil {
+		b.Init(clients)
+	}
+
+	// find the first node after hash of key
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= hash
+	})
+
+	// walk along the ring, until an address with available client is found
+	visited := make(map[string]bool)
+	for i := 0; i < len(b.ring) && len(visited) < len(b.clients); i++ {
+		address := b.ring[(start+i)%len(b.ring)].address
+		if visited[address] {
+			continue
+		}
+		visited[address] = true
+
+		// select available client of the address, by hash of key
+		addrClients := b.clients[address]
+		first := int(hash % uint32(len(addrClients)))
+		for j := 0; j < len(addrClients); j++ {
+			client := addrClients[(first+j)%len(addrClients)]
+			if clientAvailable(client, excluded) {
+				return client, nil
+			}
+		}
+	}
+
+	return nil, ErrAllBroken
+}
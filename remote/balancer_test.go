@@ -0,0 +1,251 @@
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func prepareClientWithBalancer(addrInfo map[string]int32, concurrency int, balancer Balancer) *Client {
+	// Note: address in addrInfo should be unaccessable
+	clientPool := NewClientByAddr("unix", addrInfo, 1*time.Second, concurrency, nil, 100,
+		WithBalancer(balancer))
+
+	for _, sclient := range clientPool.clients {
+		sclient.Status = CONNECTED
+	}
+	sort.Sort(SClients(clientPool.clients))
+	clientPool.balancer.Init(clientPool.clients)
+
+	return clientPool
+}
+
+func markBroken(clientPool *Client, address string) {
+	for _, client := range clientPool.clients {
+		if client.Address == address {
+			client.Status = CONNECTING
+		}
+	}
+}
+
+// test of BalancerCreate
+func TestBalancerCreate(t *testing.T) {
+	names := []string{BALANCE_WRR, BALANCE_LEAST_PENDING, BALANCE_P2C, BALANCE_HASH}
+	for _, name := range names {
+		if _, err := BalancerCreate(name); err != nil {
+			t.Errorf("BalancerCreate(%s): %s", name, err.Error())
+		}
+	}
+
+	if _, err := BalancerCreate("unknown"); err == nil {
+		t.Errorf("BalancerCreate() should fail for unknown balancer")
+	}
+}
+
+// test of LeastPendingBalancer
+func TestLeastPendingBalancer(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 3,
+		"/tmp/notexist/b": 2,
+		"/tmp/notexist/c": 1,
+	}
+	clientPool := prepareClientWithBalancer(addrInfo, 1, NewLeastPendingBalancer())
+	markBroken(clientPool, "/tmp/notexist/b")
+
+	// without pending calls, available clients are used in turn
+	expectResult := []string{
+		"/tmp/notexist/a",
+		"/tmp/notexist/c",
+		"/tmp/notexist/c",
+		"/tmp/notexist/a",
+	}
+	actualResult, err := getBalanceResult(clientPool, len(expectResult))
+	if err != nil {
+		t.Fatalf("should not catch error: %s", err.Error())
+	}
+	for i := range expectResult {
+		if actualResult[i] != expectResult[i] {
+			t.Errorf("Balance error (expect: %v, actual %v)", expectResult, actualResult)
+			break
+		}
+	}
+
+	// all broken
+	markBroken(clientPool, "/tmp/notexist/a")
+	markBroken(clientPool, "/tmp/notexist/c")
+	if _, err := clientPool.Balance(); err != ErrAllBroken {
+		t.Errorf("err should be ErrAllBroken, got %v", err)
+	}
+}
+
+// test of P2cBalancer
+func TestP2cBalancer(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 1,
+		"/tmp/notexist/b": 1,
+		"/tmp/notexist/c": 1,
+	}
+	clientPool := prepareClientWithBalancer(addrInfo, 2, NewP2cBalancer())
+	markBroken(clientPool, "/tmp/notexist/b")
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		client, err := clientPool.Balance()
+		if err != nil {
+			t.Fatalf("should not catch error: %s", err.Error())
+		}
+		counts[client.Address]++
+	}
+
+	if counts["/tmp/notexist/b"] != 0 {
+		t.Errorf("broken client should not be selected")
+	}
+	if counts["/tmp/notexist/a"] == 0 || counts["/tmp/notexist/c"] == 0 {
+		t.Errorf("available clients should be selected: %v", counts)
+	}
+}
+
+// test of HashBalancer
+func TestHashBalancer(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 1,
+		"/tmp/notexist/b": 1,
+		"/tmp/notexist/c": 1,
+	}
+	clientPool := prepareClientWithBalancer(addrInfo, 2, NewHashBalancer())
+
+	// the same key is always sent to the same client
+	selected := make(map[string]*SClient)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		client, err := clientPool.BalanceByKey(key)
+		if err != nil {
+			t.Fatalf("should not catch error: %s", err.Error())
+		}
+		selected[key] = client
+	}
+	for key, client := range selected {
+		client2, _ := clientPool.BalanceByKey(key)
+		if client2 != client {
+			t.Errorf("key %s: client changed from %s to %s", key, client.Address, client2.Address)
+		}
+	}
+
+	// keys of broken address are moved to other addresses, others unchanged
+	markBroken(clientPool, "/tmp/notexist/b")
+	for key, client := range selected {
+		client2, err := clientPool.BalanceByKey(key)
+		if err != nil {
+			t.Fatalf("should not catch error: %s", err.Error())
+		}
+		if client2.Address == "/tmp/notexist/b" {
+			t.Errorf("key %s: broken address selected", key)
+		}
+		if client.Address != "/tmp/notexist/b" && client2 != client {
+			t.Errorf("key %s: client changed from %s to %s", key, client.Address, client2.Address)
+		}
+	}
+
+	// requests without key are sent in round robin
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		client, _ := clientPool.Balance()
+		counts[client.Address]++
+	}
+	if counts["/tmp/notexist/a"] != 4 || counts["/tmp/notexist/c"] != 4 {
+		t.Errorf("requests without key should be balanced: %v", counts)
+	}
+}
+
+// test of balancing with excluded addresses
+func TestBalanceExclude(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 2,
+		"/tmp/notexist/b": 2,
+		"/tmp/notexist/c": 2,
+	}
+	balancers := []Balancer{
+		NewWrrBalancer(),
+		NewLeastPendingBalancer(),
+		NewP2cBalancer(),
+		NewHashBalancer(),
+	}
+	excluded := map[string]bool{"/tmp/notexist/a": true, "/tmp/notexist/b": true}
+
+	for _, balancer := range balancers {
+		clientPool := prepareClientWithBalancer(addrInfo, 1, balancer)
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			client, err := clientPool.balanceExclude(key, excluded, false)
+			if err != nil {
+				t.Fatalf("%T: should not catch error: %s", balancer, err.Error())
+			}
+			if client.Address != "/tmp/notexist/c" {
+				t.Errorf("%T: excluded address %s selected", balancer, client.Address)
+			}
+		}
+
+		// excluded addresses are not used, even if no other client is available
+		markBroken(clientPool, "/tmp/notexist/c")
+		client, err := clientPool.balanceExclude("key", excluded, false)
+		if err != ErrAllBroken {
+			t.Errorf("%T: balanceExclude() = %v, %v", balancer, client, err)
+		}
+		clientPool.Close()
+	}
+}
+
+// test of WrrBalancer, weight of excluded client is not used
+func TestWrrBalancerExclude(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 3,
+		"/tmp/notexist/b": 1,
+	}
+	clientPool := prepareClientWithBalancer(addrInfo, 1, NewWrrBalancer())
+	defer clientPool.Close()
+
+	excluded := map[string]bool{"/tmp/notexist/a": true}
+	for i := 0; i < 3; i++ {
+		clientPool.balanceExclude("", excluded, false)
+	}
+	if clientPool.clients[0].Left != 3 {
+		t.Errorf("Left of excluded client should be 3, now it's %d", clientPool.clients[0].Left)
+	}
+}
+
+// test of HashBalancer, key is moved to the next address if excluded
+func TestHashBalancerExclude(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 1,
+		"/tmp/notexist/b": 1,
+		"/tmp/notexist/c": 1,
+	}
+	clientPool := prepareClientWithBalancer(addrInfo, 2, NewHashBalancer())
+	defer clientPool.Close()
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		first, _ := clientPool.BalanceByKey(key)
+
+		// each retry goes to a different address
+		tried := map[string]bool{first.Address: true}
+		for j := 0; j < 2; j++ {
+			client, err := clientPool.balanceExclude(key, tried, false)
+			if err != nil {
+				t.Fatalf("should not catch error: %s", err.Error())
+			}
+			if tried[client.Address] {
+				t.Errorf("key %s: address %s selected again", key, client.Address)
+			}
+			tried[client.Address] = true
+		}
+
+		// the next address is stable for the same key
+		next1, _ := clientPool.balanceExclude(key, map[string]bool{first.Address: true}, false)
+		next2, _ := clientPool.balanceExclude(key, map[string]bool{first.Address: true}, false)
+		if next1 != next2 {
+			t.Errorf("key %s: next client changed from %s to %s", key, next1.Address, next2.Address)
+		}
+	}
+}
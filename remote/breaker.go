@@ -0,0 +1,306 @@
+/* breaker.go - circuit breaker and outlier ejection for SClient */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Each SClient may have a circuit breaker, which accounts errors and timeouts
+of calls to the backend:
+- closed   : calls are allowed. If error rate in the current window crosses
+             ErrorRate (with at least MinRequests calls), breaker is opened
+             and the backend is ejected.
+- open     : calls are not allowed, until OpenTime has passed. Then breaker
+             is changed to half-open, when the client is selected for a
+             call whose result is recorded.
+- half-open: at most HalfOpenProbes calls are allowed. Breaker is closed if
+             all of them succeed, or opened again on any failure.
+
+At most MaxEjectPercent of clients are ejected at the same time.
+
+Breaker state is exposed through module_state2.State:
+- States[address#N]        : "closed", "open" or "half_open"
+- States[address#N_reason] : reason of the last ejection
+- SCounters                : BREAKER_OPEN, BREAKER_HALF_OPEN, BREAKER_CLOSE,
+                             BREAKER_EJECT_LIMITED
+
+Usage:
+    client := NewClientByAddr("tcp", addrInfo, 1*time.Second, 8, nil, 100,
+        WithBreaker(DefaultBreakerConf()))
+
+    // register breaker state to web monitor
+    state := client.BreakerStateGet()
+*/
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/module_state2"
+)
+
+// state of circuit breaker
+const (
+	BREAKER_CLOSED    = iota // calls are allowed
+	BREAKER_OPEN             // backend is ejected
+	BREAKER_HALF_OPEN        // probing the backend
+)
+
+var breakerStateNames = []string{"closed", "open", "half_open"}
+
+// counters of breaker
+var breakerCounterKeys = []string{
+	"BREAKER_OPEN",          // number of transitions to open
+	"BREAKER_HALF_OPEN",     // number of transitions to half-open
+	"BREAKER_CLOSE",         // number of transitions to closed
+	"BREAKER_EJECT_LIMITED", // ejection not done for MaxEjectPercent
+}
+
+// config of circuit breaker
+type BreakerConf struct {
+	Window          time.Duration // window for error rate statistics
+	MinRequests     int           // min calls in window for opening breaker
+	ErrorRate       float64       // open breaker if error rate >= ErrorRate, in [0, 1]
+	OpenTime        time.Duration // time for backend ejected
+	HalfOpenProbes  int           // number of probe calls in half-open state
+	MaxEjectPercent int           // max percent of clients ejected, in [0, 100]
+}
+
+// DefaultBreakerConf returns default config of circuit breaker
+func DefaultBreakerConf() BreakerConf {
+	return BreakerConf{
+		Window:          10 * time.Second,
+		MinRequests:     20,
+		ErrorRate:       0.5,
+		OpenTime:        30 * time.Second,
+		HalfOpenProbes:  3,
+		MaxEjectPercent: 50,
+	}
+}
+
+// check config of circuit breaker
+func (conf *BreakerConf) check() error {
+	if conf.Window <= 0 {
+		return fmt.Errorf("Window should be > 0")
+	}
+	if conf.MinRequests <= 0 {
+		return fmt.Errorf("MinRequests should be > 0")
+	}
+	if conf.ErrorRate <= 0 || conf.ErrorRate > 1 {
+		return fmt.Errorf("ErrorRate should be in (0, 1]")
+	}
+	if conf.OpenTime <= 0 {
+		return fmt.Errorf("OpenTime should be > 0")
+	}
+	if conf.HalfOpenProbes <= 0 {
+		return fmt.Errorf("HalfOpenProbes should be > 0")
+	}
+	if conf.MaxEjectPercent < 0 || conf.MaxEjectPercent > 100 {
+		return fmt.Errorf("MaxEjectPercent should be in [0, 100]")
+	}
+	return nil
+}
+
+// circuit breaker for a SClient
+type CircuitBreaker struct {
+	lock  sync.Mutex
+	name  string               // name of breaker, address#N
+	conf  BreakerConf          // config of breaker
+	state *module_state2.State // for exposing breaker state, may be nil
+
+	status      int       // BREAKER_CLOSED, BREAKER_OPEN or BREAKER_HALF_OPEN
+	windowStart time.Time // start of statistics window
+	requests    int       // calls in window
+	errors      int       // failed calls in window, including timeouts
+	timeouts    int       // timeout calls in window
+	openTime    time.Time // time of breaker opened
+	probes      int       // probe calls allowed in half-open state
+	successes   int       // successful probe calls in half-open state
+}
+
+// create circuit breaker
+func newCircuitBreaker(name string, conf BreakerConf, state *module_state2.State) *CircuitBreaker {
+	cb := new(CircuitBreaker)
+	cb.name = name
+	cb.conf = conf
+	cb.state = state
+	cb.windowStart = time.Now()
+	cb.state.Set(cb.name, breakerStateNames[BREAKER_CLOSED])
+	return cb
+}
+
+// Status returns state of breaker
+func (cb *CircuitBreaker) Status() int {
+	if cb == nil {
+		return BREAKER_CLOSED
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	return cb.status
+}
+
+// check whether calls are allowed, without changing state of breaker
+// Open breaker allows calls after OpenTime; it is changed to half-open by
+// acquire(), when a call is sent.
+func (cb *CircuitBreaker) available() bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	switch cb.status {
+	case BREAKER_OPEN:
+		return time.Since(cb.openTime) >= cb.conf.OpenTime
+	case BREAKER_HALF_OPEN:
+		return cb.probes < cb.conf.HalfOpenProbes
+	default:
+		return true
+	}
+}
+
+// notify breaker that a call is to be sent as a probe
+// Breaker is changed from open to half-open after OpenTime.
+func (cb *CircuitBreaker) acquire() {
+	if cb == nil {
+		return
+	}
+
+	cb.lock.Lock()
+	if cb.status == BREAKER_OPEN && time.Since(cb.openTime) >= cb.conf.OpenTime {
+		cb.statusSet(BREAKER_HALF_OPEN, "")
+	}
+	if cb.status == BREAKER_HALF_OPEN {
+		cb.probes++
+	}
+	cb.lock.Unlock()
+}
+
+/*
+record - record result of a call
+
+Params:
+    - err: error of the call; context.Canceled is not counted
+
+Returns:
+    reason for opening the breaker; empty if breaker should not be opened
+*/
+func (cb *CircuitBreaker) record(err error) string {
+	if cb == nil {
+		return ""
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	// call cancelled by caller, not counted
+	if err == context.Canceled {
+		if cb.status == BREAKER_HALF_OPEN && cb.probes > 0 {
+			cb.probes--
+		}
+		return ""
+	}
+
+	switch cb.status {
+	case BREAKER_HALF_OPEN:
+		if err != nil {
+			return fmt.Sprintf("probe failed: %s", err.Error())
+		}
+		cb.successes++
+		if cb.successes >= cb.conf.HalfOpenProbes {
+			cb.statusSet(BREAKER_CLOSED, "")
+		}
+		return ""
+
+	case BREAKER_CLOSED:
+		// start a new window
+		if time.Since(cb.windowStart) >= cb.conf.Window {
+			cb.windowReset()
+		}
+
+		cb.requests++
+		if err != nil {
+			cb.errors++
+		}
+		if err == ErrTimeout {
+			cb.timeouts++
+		}
+
+		if cb.requests >= cb.conf.MinRequests &&
+			float64(cb.errors) >= cb.conf.ErrorRate*float64(cb.requests) {
+			return fmt.Sprintf("error rate %.2f (errors %d, timeouts %d, requests %d) in %s",
+				float64(cb.errors)/float64(cb.requests), cb.errors, cb.timeouts,
+				cb.requests, cb.conf.Window)
+		}
+		return ""
+
+	default:
+		// calls sent before breaker opened
+		return ""
+	}
+}
+
+// open the breaker, for given reason
+func (cb *CircuitBreaker) open(reason string) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if cb.status != BREAKER_OPEN {
+		cb.statusSet(BREAKER_OPEN, reason)
+	}
+}
+
+// reset statistics of the breaker, e.g., ejection is limited
+func (cb *CircuitBreaker) reset() {
+	cb.lock.Lock()
+	cb.windowReset()
+	cb.lock.Unlock()
+}
+
+// reset statistics window, with lock held
+func (cb *CircuitBreaker) windowReset() {
+	cb.windowStart = time.Now()
+	cb.requests = 0
+	cb.errors = 0
+	cb.timeouts = 0
+}
+
+// set status of breaker, with lock held
+func (cb *CircuitBreaker) statusSet(status int, reason string) {
+	cb.status = status
+
+	switch status {
+	case BREAKER_OPEN:
+		cb.openTime = time.Now()
+		cb.state.Inc("BREAKER_OPEN", 1)
+		cb.state.Set(cb.name+"_reason", reason)
+	case BREAKER_HALF_OPEN:
+		cb.probes = 0
+		cb.successes = 0
+		cb.state.Inc("BREAKER_HALF_OPEN", 1)
+	case BREAKER_CLOSED:
+		cb.windowReset()
+		cb.state.Inc("BREAKER_CLOSE", 1)
+	}
+	cb.state.Set(cb.name, breakerStateNames[status])
+}
+
+// remove breaker state
+func (cb *CircuitBreaker) stateDelete() {
+	if cb == nil {
+		return
+	}
+
+	cb.state.Delete(cb.name)
+	cb.state.Delete(cb.name + "_reason")
+}
@@ -0,0 +1,281 @@
+package remote
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBreakerConf() BreakerConf {
+	return BreakerConf{
+		Window:          10 * time.Second,
+		MinRequests:     10,
+		ErrorRate:       0.5,
+		OpenTime:        50 * time.Millisecond,
+		HalfOpenProbes:  2,
+		MaxEjectPercent: 50,
+	}
+}
+
+func prepareClientWithBreaker(addrInfo map[string]int32, conf BreakerConf) *Client {
+	// Note: address in addrInfo should be unaccessable
+	clientPool := NewClientByAddr("unix", addrInfo, 1*time.Second, 1, nil, 100,
+		WithBreaker(conf))
+
+	for _, sclient := range clientPool.clients {
+		sclient.Status = CONNECTED
+	}
+	sort.Sort(SClients(clientPool.clients))
+	clientPool.balancer.Init(clientPool.clients)
+
+	return clientPool
+}
+
+// test of CircuitBreaker, closed => open => half-open => closed
+func TestCircuitBreaker_1(t *testing.T) {
+	cb := newCircuitBreaker("test#0", testBreakerConf(), nil)
+
+	// error rate is below threshold
+	for i := 0; i < 10; i++ {
+		var err error
+		if i%3 == 0 {
+			err = ErrTimeout
+		}
+		if reason := cb.record(err); reason != "" {
+			t.Fatalf("breaker should not be opened: %s", reason)
+		}
+	}
+
+	// error rate crosses threshold
+	var reason string
+	for i := 0; i < 10 && reason == ""; i++ {
+		reason = cb.record(ErrTimeout)
+	}
+	if reason == "" {
+		t.Fatalf("breaker should be opened")
+	}
+	cb.open(reason)
+	if cb.Status() != BREAKER_OPEN || cb.available() {
+		t.Fatalf("breaker should be open")
+	}
+
+	// available after OpenTime, half-open when a probe is sent
+	time.Sleep(60 * time.Millisecond)
+	if !cb.available() || cb.Status() != BREAKER_OPEN {
+		t.Fatalf("breaker should be available, and not changed")
+	}
+	cb.acquire()
+	if cb.Status() != BREAKER_HALF_OPEN {
+		t.Fatalf("breaker should be half-open")
+	}
+	cb.acquire()
+	if cb.available() {
+		t.Errorf("breaker should not allow more than HalfOpenProbes calls")
+	}
+
+	// closed after probes succeed
+	cb.record(nil)
+	cb.record(nil)
+	if cb.Status() != BREAKER_CLOSED || !cb.available() {
+		t.Errorf("breaker should be closed")
+	}
+}
+
+// test of balancers, breaker is changed to half-open only for selected client
+func TestBalancerBreakerHalfOpen(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 1,
+		"/tmp/notexist/b": 1,
+		"/tmp/notexist/c": 1,
+	}
+	balancers := []Balancer{NewWrrBalancer(), NewLeastPendingBalancer(), NewP2cBalancer(), NewHashBalancer()}
+	for _, balancer := range balancers {
+		clientPool := NewClientByAddr("unix", addrInfo, 1*time.Second, 1, nil, 100,
+			WithBreaker(testBreakerConf()), WithBalancer(balancer))
+		for _, client := range clientPool.clients {
+			client.Status = CONNECTED
+			client.breaker.open("test")
+		}
+		balancer.Init(clientPool.clients)
+		time.Sleep(60 * time.Millisecond)
+
+		// not changed by selection without probe
+		for i := 0; i < 10; i++ {
+			if _, err := clientPool.BalanceByKey("key"); err != nil {
+				t.Fatalf("%T: BalanceByKey(): %s", balancer, err.Error())
+			}
+		}
+		for _, client := range clientPool.clients {
+			if client.breaker.Status() != BREAKER_OPEN {
+				t.Errorf("%T: breaker of %s should be open", balancer, client.Address)
+			}
+		}
+
+		// only selected client is changed to half-open
+		selected, err := clientPool.balanceExclude("key", nil, true)
+		if err != nil {
+			t.Fatalf("%T: balanceExclude(): %s", balancer, err.Error())
+		}
+		for _, client := range clientPool.clients {
+			if (client.breaker.Status() == BREAKER_HALF_OPEN) != (client == selected) {
+				t.Errorf("%T: breaker of %s: unexpected status %d", balancer, client.Address,
+					client.breaker.Status())
+			}
+		}
+	}
+}
+
+// test of CircuitBreaker, probe failed in half-open state
+func TestCircuitBreaker_2(t *testing.T) {
+	cb := newCircuitBreaker("test#0", testBreakerConf(), nil)
+	cb.open("test")
+
+	time.Sleep(60 * time.Millisecond)
+	if !cb.available() {
+		t.Fatalf("breaker should be available")
+	}
+	cb.acquire()
+
+	reason := cb.record(errors.New("connection reset"))
+	if !strings.Contains(reason, "probe failed") {
+		t.Errorf("breaker should be opened for failed probe, reason: %s", reason)
+	}
+}
+
+// test of BreakerConf.check
+func TestBreakerConfCheck(t *testing.T) {
+	conf := DefaultBreakerConf()
+	if err := conf.check(); err != nil {
+		t.Errorf("default conf should be valid: %s", err.Error())
+	}
+
+	conf.ErrorRate = 1.5
+	if err := conf.check(); err == nil {
+		t.Errorf("ErrorRate 1.5 should be invalid")
+	}
+
+	// client with invalid conf has no breaker
+	clientPool := NewClientByAddr("unix", map[string]int32{"/tmp/notexist/a": 1},
+		1*time.Second, 1, nil, 100, WithBreaker(conf))
+	defer clientPool.Close()
+	if clientPool.BreakerStateGet() != nil {
+		t.Errorf("breaker should be disabled for invalid conf")
+	}
+}
+
+// test of ejection in Client
+func TestClientEject(t *testing.T) {
+	addrInfo := map[string]int32{
+		"/tmp/notexist/a": 1,
+		"/tmp/notexist/b": 1,
+		"/tmp/notexist/c": 1,
+		"/tmp/notexist/d": 1,
+	}
+	clientPool := prepareClientWithBreaker(addrInfo, testBreakerConf())
+	clients := clientPool.clients
+
+	// eject a
+	for i := 0; i < 10; i++ {
+		clientPool.breakerRecord(clients[0], ErrTimeout)
+	}
+	if clients[0].breaker.Status() != BREAKER_OPEN {
+		t.Fatalf("client a should be ejected")
+	}
+	for i := 0; i < 6; i++ {
+		client, err := clientPool.Balance()
+		if err != nil {
+			t.Fatalf("should not catch error: %s", err.Error())
+		}
+		if client == clients[0] {
+			t.Errorf("ejected client should not be selected")
+		}
+	}
+
+	// check state
+	state := clientPool.BreakerStateGet()
+	if state.GetState("/tmp/notexist/a#0") != "open" {
+		t.Errorf("state of a should be open, got %s", state.GetState("/tmp/notexist/a#0"))
+	}
+	if !strings.Contains(state.GetState("/tmp/notexist/a#0_reason"), "error rate") {
+		t.Errorf("reason of a should be set")
+	}
+	if state.GetCounters()["BREAKER_OPEN"] != 1 {
+		t.Errorf("BREAKER_OPEN should be 1")
+	}
+
+	// eject b, ejected clients reach MaxEjectPercent
+	for i := 0; i < 10; i++ {
+		clientPool.breakerRecord(clients[1], errors.New("error"))
+	}
+	if clients[1].breaker.Status() != BREAKER_OPEN {
+		t.Fatalf("client b should be ejected")
+	}
+
+	// c should not be ejected
+	for i := 0; i < 10; i++ {
+		clientPool.breakerRecord(clients[2], ErrTimeout)
+	}
+	if clients[2].breaker.Status() != BREAKER_CLOSED {
+		t.Errorf("client c should not be ejected for MaxEjectPercent")
+	}
+	if state.GetCounters()["BREAKER_EJECT_LIMITED"] != 1 {
+		t.Errorf("BREAKER_EJECT_LIMITED should be 1")
+	}
+
+	// a is probed after OpenTime
+	time.Sleep(60 * time.Millisecond)
+	selected := false
+	for i := 0; i < 4; i++ {
+		client, _ := clientPool.balanceExclude("", nil, true)
+		if client == clients[0] {
+			selected = true
+		}
+	}
+	if !selected {
+		t.Errorf("client a should be probed after OpenTime")
+	}
+	if state.GetState("/tmp/notexist/a#0") != "half_open" {
+		t.Errorf("state of a should be half_open, got %s", state.GetState("/tmp/notexist/a#0"))
+	}
+
+	// state is removed for address removed
+	clientPool.Update(map[string]int32{"/tmp/notexist/b": 1, "/tmp/notexist/e": 1})
+	if state.GetState("/tmp/notexist/a#0") != "" {
+		t.Errorf("state of a should be removed")
+	}
+	if state.GetState("/tmp/notexist/e#0") != "closed" {
+		t.Errorf("state of e should be closed")
+	}
+	clientPool.Close()
+}
+
+// test of breaker in half-open state, with calls without response
+func TestClientBreakerNoReturn(t *testing.T) {
+	conf := testBreakerConf()
+	client, _, cleanup := prepareRetryClient(t, []Handler{&delayHandler{}}, WithBreaker(conf))
+	defer cleanup()
+
+	sclient := client.clients[0]
+	sclient.breaker.open("test")
+	time.Sleep(60 * time.Millisecond)
+
+	// calls without response are not probes, breaker is not changed
+	for i := 0; i < 2*conf.HalfOpenProbes; i++ {
+		client.GoNoReturn(wafRequestNew("test"))
+	}
+	if sclient.breaker.Status() != BREAKER_OPEN {
+		t.Fatalf("breaker should be open")
+	}
+
+	// breaker is closed after probes succeed
+	for i := 0; i < conf.HalfOpenProbes; i++ {
+		if err := client.Call(wafRequestNew("test"), nil, time.Second); err != nil {
+			t.Fatalf("Call(): %s", err.Error())
+		}
+	}
+	if sclient.breaker.Status() != BREAKER_CLOSED {
+		t.Errorf("breaker should be closed")
+	}
+}
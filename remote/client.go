@@ -10,6 +10,18 @@ modification history
     - reload support for server address and weight
 2015/5/29, by Sijie Yang, modify
     - support BNS for service instance discovery
+2026/10/18, by agent, modify
+    - support pluggable load balancer, and request key for affinity
+2026/10/18, by agent, modify
+    - support circuit breaker and outlier ejection for each SClient
+2026/10/18, by agent, modify
+    - add CallContext() for deadline and cancellation by context
+2026/10/18, by agent, modify
+    - support retry on different backend, and hedged requests
+2026/10/18, by agent, modify
+    - exponential backoff with jitter and health check in AsyncDial
+2026/10/18, by agent, modify
+    - statistics of calls and delay, per backend and aggregate
 */
 /*
 DESCRIPTION
@@ -26,11 +38,20 @@ client example:
 
 	// request no response case
 	err := client.GoNoReturn(request)
+
+    // request, response, with deadline and cancellation of ctx:
+    // key for balancer may be set by NewKeyContext()
+    err := client.CallContext(NewKeyContext(ctx, userId), request, response)
+
+    // select load balancer by option (WRR default)
+    client := NewClientByAddr("tcp", addrInfo, 1*time.Second, 8, nil, 100,
+        WithBalancer(NewLeastPendingBalancer()))
 */
 
 package remote
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"reflect"
@@ -42,8 +63,23 @@ import (
 import (
 	"www.baidu.com/golang-lib/bns"
 	"www.baidu.com/golang-lib/log"
+	"www.baidu.com/golang-lib/module_state2"
 )
 
+// key of context value for balancer key
+type keyContextKey struct{}
+
+// NewKeyContext returns a context carrying key for balancer, used by CallContext()
+func NewKeyContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, key)
+}
+
+// get key for balancer from context
+func keyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(keyContextKey{}).(string)
+	return key
+}
+
 // client connect to server status
 const (
 	UNCONNECTED int32 = iota // not connected
@@ -61,6 +97,10 @@ type SClient struct {
 	Weight  int32  // initial weight
 	Left    int32  // atomic weight left
 	Address string // address of server connected to
+
+	breaker  *CircuitBreaker      // circuit breaker, nil if not enabled
+	dialConf *DialConf            // config for dial, default if nil
+	state    *module_state2.State // state of Client, may be nil
 }
 
 func NewSClient(address string, weight int32, left int32) *SClient {
@@ -74,33 +114,75 @@ func NewSClient(address string, weight int32, left int32) *SClient {
 
 // async dial to server
 // try to keep connection until Close() called
+// Interval between dials is decided by exponential backoff with full jitter.
 func (s *SClient) AsyncDial(network, address string, timeout time.Duration, fn fnCreateCodec,
 	pendingNum int) {
-	// go routine will dial every second until success
+	conf := s.dialConf
+	if conf == nil {
+		defaultConf := DefaultDialConf()
+		conf = &defaultConf
+	}
+
+	attempt := 0 // number of failed attempts since last stable connection
 	for s.shouldDial() {
-		interval := 1 * time.Second
-		conn, err := net.DialTimeout(network, address, timeout)
-		if err == nil {
-			client := NewInternalClient(conn, fn, pendingNum)
-			s.SetInternal(client)
-			atomic.StoreInt32(&s.Status, CONNECTED)
-
-			// wait until client stop
-			closing := client.WaitClose()
-			atomic.StoreInt32(&s.Status, CONNECTING)
-
-			// close internal client conn
-			if !closing {
-				client.Close()
-			}
-		} else {
+		client, err := s.dial(network, address, timeout, fn, pendingNum, conf)
+		if err != nil {
 			log.Logger.Debug("connect to %s %s failed %s, %v", network, address,
 				err.Error(), timeout)
-			s.wait(interval)
+			s.wait(backoffInterval(conf, attempt))
+			attempt++
+			continue
+		}
+
+		s.SetInternal(client)
+		atomic.StoreInt32(&s.Status, CONNECTED)
+		s.state.Inc("DIAL_SUCC", 1)
+		connectTime := time.Now()
+
+		// wait until client stop
+		closing := client.WaitClose()
+		atomic.StoreInt32(&s.Status, CONNECTING)
+
+		// close internal client conn
+		if !closing {
+			client.Close()
+			s.state.Inc("CONN_BROKEN", 1)
+		}
+
+		// if the connection was stable, wait with jitter of the first attempt,
+		// so clients of a restarted server do not reconnect all at once;
+		// otherwise backoff
+		if time.Since(connectTime) >= conf.MaxInterval {
+			s.wait(backoffInterval(conf, 0))
+			attempt = 0
+		} else {
+			s.wait(backoffInterval(conf, attempt))
+			attempt++
 		}
 	}
 }
 
+// dial to server, and check health of the connection
+func (s *SClient) dial(network, address string, timeout time.Duration, fn fnCreateCodec,
+	pendingNum int, conf *DialConf) (*InternalClient, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		s.state.Inc("DIAL_FAIL", 1)
+		return nil, err
+	}
+	client := NewInternalClient(conn, fn, pendingNum)
+
+	if conf.HealthCheck != nil {
+		if err := conf.HealthCheck(client); err != nil {
+			s.state.Inc("DIAL_HEALTH_CHECK_FAIL", 1)
+			client.Close()
+			return nil, fmt.Errorf("health check: %s", err.Error())
+		}
+	}
+
+	return client, nil
+}
+
 func (s *SClient) shouldDial() bool {
 	select {
 	case <-s.StopDial:
@@ -149,12 +231,45 @@ type Client struct {
 	connectTimeout time.Duration    // connect timeout
 	pendingNum     int              // max pending msg number waiting to send for each internal client
 	fn             fnCreateCodec    // used to add create codec
-	mutex          sync.Mutex       // protect clients and index
+	mutex          sync.Mutex       // protect clients and balancer
 	clients        []*SClient       // actual clients
-	index          int              // current client index
+	balancer       Balancer         // load balancer for clients
 	concurrency    int              // number of clients per address
 	closed         bool             // client closed
 	bnsClient      *bns.Client      // bns client
+
+	breakerConf  *BreakerConf        // config of circuit breaker, nil if not enabled
+	breakerState module_state2.State // state of circuit breakers
+
+	retryConf *RetryConf // config of retry and hedging, nil if not enabled
+
+	dialConf DialConf            // config for dial
+	state    module_state2.State // state of Client, e.g., counters for dial
+
+	stats *clientStats // statistics of calls, nil if not enabled
+}
+
+// option for creating Client
+type ClientOption func(*Client)
+
+// WithBalancer sets load balancer of Client, WrrBalancer by default
+func WithBalancer(balancer Balancer) ClientOption {
+	return func(rec *Client) {
+		if balancer != nil {
+			rec.balancer = balancer
+		}
+	}
+}
+
+// WithBreaker enables circuit breaker for each connection of Client
+func WithBreaker(conf BreakerConf) ClientOption {
+	return func(rec *Client) {
+		if err := conf.check(); err != nil {
+			log.Logger.Warn("remote: invalid breaker conf(%s), breaker disabled", err.Error())
+			return
+		}
+		rec.breakerConf = &conf
+	}
 }
 
 //
@@ -165,10 +280,11 @@ type Client struct {
 // concurrency: internal connections
 // fn: function to create codec, if fn is nil, pbcodec is used as default
 // pendingNum is pending queue(waiting for send message) max size
+// opts: options of client, e.g., WithBalancer()
 func NewClient(network, address string, connectTimeout time.Duration, concurrency int, fn fnCreateCodec,
-	pendingNum int) *Client {
+	pendingNum int, opts ...ClientOption) *Client {
 	addrInfo := map[string]int32{address: 1000}
-	return NewClientByAddr(network, addrInfo, connectTimeout, concurrency, fn, pendingNum)
+	return NewClientByAddr(network, addrInfo, connectTimeout, concurrency, fn, pendingNum, opts...)
 }
 
 /* NewClientByAddr - Create a client to communicate with server
@@ -180,27 +296,18 @@ func NewClient(network, address string, connectTimeout time.Duration, concurrenc
  *     - concurrency   : number of connections to per address
  *     - fn            : function to create codec (pbcodec default)
  *     - pendingNum    : max size of pending queue
+ *     - opts          : options of client, e.g., WithBalancer()
  *
  * Return:
  *     - Client
  */
 func NewClientByAddr(network string, addrInfo map[string]int32,
 	connectTimeout time.Duration, concurrency int, fn fnCreateCodec,
-	pendingNum int) *Client {
+	pendingNum int, opts ...ClientOption) *Client {
 	if concurrency <= 0 {
 		concurrency = 1
 	}
 
-	// try to establish connection once created
-	clients := make([]*SClient, 0, len(addrInfo)*concurrency)
-	for address, weight := range addrInfo {
-		for i := 0; i < concurrency; i++ {
-			client := NewSClient(address, weight, weight)
-			clients = append(clients, client)
-			go client.AsyncDial(network, address, connectTimeout, fn, pendingNum)
-		}
-	}
-
 	// create and initialize Client
 	rec := &Client{
 		network:        network,
@@ -208,9 +315,27 @@ func NewClientByAddr(network string, addrInfo map[string]int32,
 		connectTimeout: connectTimeout,
 		pendingNum:     pendingNum,
 		fn:             fn,
-		clients:        clients,
 		concurrency:    concurrency,
+		balancer:       NewWrrBalancer(),
+		dialConf:       DefaultDialConf(),
+	}
+	for _, opt := range opts {
+		opt(rec)
 	}
+	rec.state.Init()
+	rec.state.CountersInit(clientCounterKeys)
+
+	// try to establish connection once created
+	clients := make([]*SClient, 0, len(addrInfo)*concurrency)
+	for address, weight := range addrInfo {
+		for i := 0; i < concurrency; i++ {
+			clients = append(clients, rec.sclientCreate(address, weight))
+		}
+	}
+	rec.clients = clients
+
+	rec.breakerInit()
+	rec.balancer.Init(rec.clients)
 
 	return rec
 }
@@ -223,13 +348,14 @@ func NewClientByAddr(network string, addrInfo map[string]int32,
  *     - concurrency   : number of connections to per address
  *     - fn            : function to create codec (pbcodec default)
  *     - pendingNum    : max size of pending queue
+ *     - opts          : options of client, e.g., WithBalancer()
  *
  * Return:
  *     - client        : client instance
  *     - error         : error if fail
  */
 func NewClientByName(serviceName string, connectTimeout time.Duration,
-	concurrency int, fn fnCreateCodec, pendingNum int) *Client {
+	concurrency int, fn fnCreateCodec, pendingNum int, opts ...ClientOption) *Client {
 	bnsClient := bns.NewClient()
 	addrInfo, err := bns.GetAddrAndWeight(bnsClient, serviceName)
 	if err != nil {
@@ -238,13 +364,27 @@ func NewClientByName(serviceName string, connectTimeout time.Duration,
 		addrInfo = make(map[string]int32)
 	}
 
-	client := NewClientByAddr("tcp", addrInfo, connectTimeout, concurrency, fn, pendingNum)
+	client := NewClientByAddr("tcp", addrInfo, connectTimeout, concurrency, fn, pendingNum, opts...)
 	client.bnsClient = bnsClient
 	go client.checkServiceInstance(serviceName)
 
 	return client
 }
 
+// create SClient, and start dialing to address
+func (rec *Client) sclientCreate(address string, weight int32) *SClient {
+	client := NewSClient(address, weight, weight)
+	client.dialConf = &rec.dialConf
+	client.state = &rec.state
+	go client.AsyncDial(rec.network, address, rec.connectTimeout, rec.fn, rec.pendingNum)
+	return client
+}
+
+// StateGet returns state of Client
+func (rec *Client) StateGet() *module_state2.State {
+	return &rec.state
+}
+
 func (rec *Client) checkServiceInstance(serviceName string) {
 	for !rec.closed {
 		time.Sleep(10 * time.Second)
@@ -269,65 +409,126 @@ func (rec *Client) checkServiceInstance(serviceName string) {
 	}
 }
 
-// try to get an available client instance
-func (rec *Client) Balance() (*SClient, error) {
-	rec.mutex.Lock()
-	defer rec.mutex.Unlock()
-
-	client, err := rec.balance()
-	if err != nil {
-		return nil, err
+// initialize circuit breakers of clients
+func (rec *Client) breakerInit() {
+	if rec.breakerConf == nil {
+		return
 	}
 
-	return client, nil
+	rec.breakerState.Init()
+	rec.breakerState.CountersInit(breakerCounterKeys)
+	rec.breakerCreate(rec.clients)
 }
 
-// select a client using weighted round robin balancing
-// Note: just return SClient for unit test
-func (rec *Client) balance() (*SClient, error) {
-	if len(rec.clients) == 0 {
-		return nil, fmt.Errorf("no clients in pool")
+// create circuit breakers for clients without breaker
+func (rec *Client) breakerCreate(clients []*SClient) {
+	if rec.breakerConf == nil {
+		return
 	}
 
-	var client *SClient
-	allBroken := true
-	used := rec.index
-
-	for {
-		client = rec.clients[used]
-
-		if atomic.LoadInt32(&client.Status) == CONNECTED && client.Left > 0 {
-			break
+	// number of clients for each address
+	nums := make(map[string]int)
+	for _, client := range rec.clients {
+		if client.breaker != nil {
+			nums[client.Address]++
 		}
+	}
 
-		if atomic.LoadInt32(&client.Status) == CONNECTED && client.Left <= 0 {
-			allBroken = false
+	for _, client := range clients {
+		if client.breaker != nil {
+			continue
 		}
+		name := fmt.Sprintf("%s#%d", client.Address, nums[client.Address])
+		nums[client.Address]++
+		client.breaker = newCircuitBreaker(name, *rec.breakerConf, &rec.breakerState)
+	}
+}
+
+/* breakerRecord - record result of call to client, and eject client if needed
+ *
+ * Params:
+ *     - client: client the call sent to
+ *     - err   : error of the call
+ */
+func (rec *Client) breakerRecord(client *SClient, err error) {
+	reason := client.breaker.record(err)
+	if reason == "" {
+		return
+	}
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
 
-		// next client to check
-		used = (used + 1) % len(rec.clients)
-
-		// if all clients have been checked
-		if used == rec.index {
-			if allBroken {
-				return nil, fmt.Errorf("all connections to servers are broken")
-			} else {
-				rec.initWeight()
-				rec.index = 0
-				used = 0
+	// check number of clients ejected
+	if client.breaker.Status() == BREAKER_CLOSED {
+		ejected := 0
+		for _, c := range rec.clients {
+			if c.breaker.Status() != BREAKER_CLOSED {
+				ejected++
 			}
 		}
+		if (ejected+1)*100 > len(rec.clients)*rec.breakerConf.MaxEjectPercent {
+			rec.breakerState.Inc("BREAKER_EJECT_LIMITED", 1)
+			client.breaker.reset()
+			return
+		}
 	}
-	client.Left -= 1
-	rec.index = (used + 1) % len(rec.clients)
 
-	return client, nil
+	log.Logger.Info("remote: eject %s: %s", client.breaker.name, reason)
+	client.breaker.open(reason)
 }
 
-func (rec *Client) initWeight() {
-	for i := 0; i < len(rec.clients); i++ {
-		rec.clients[i].Left = rec.clients[i].Weight
+// BreakerStateGet returns state of circuit breakers
+// Note: nil is returned if breaker is not enabled
+func (rec *Client) BreakerStateGet() *module_state2.State {
+	if rec.breakerConf == nil {
+		return nil
 	}
+	return &rec.breakerState
+}
+
+// try to get an available client instance
+func (rec *Client) Balance() (*SClient, error) {
+	return rec.BalanceByKey("")
+}
+
+// try to get an available client instance for request with given key
+func (rec *Client) BalanceByKey(key string) (*SClient, error) {
+	return rec.balanceExclude(key, nil, false)
+}
+
+/* balanceExclude - try to get an available client, not connected to given addresses
+ *
+ * Params:
+ *     - key     : request key for balancer
+ *     - excluded: addresses to avoid, may be nil
+ *     - probe   : whether the call is a probe of breaker in half-open state;
+ *                 it should be true only if result of the call is recorded
+ *                 by breakerRecord(), which releases the probe
+ *
+ * Return:
+ *     - (client, error)
+ *       ErrAllBroken is returned, if no client to other address is available
+ */
+func (rec *Client) balanceExclude(key string, excluded map[string]bool, probe bool) (*SClient, error) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	client, err := rec.balancer.Balance(rec.clients, key, excluded)
+	if err != nil {
+		return nil, err
+	}
+	if probe {
+		client.breaker.acquire()
+	}
+
+	return client, nil
+}
+
+// select a client using the balancer, with mutex held
+// Note: just return SClient for unit test
+func (rec *Client) balance() (*SClient, error) {
+	return rec.balancer.Balance(rec.clients, "", nil)
 }
 
 /* Update - update server addr and weights
@@ -354,10 +555,7 @@ func (rec *Client) Update(addrInfo map[string]int32) error {
 	for address, weight := range addrInfo {
 		if _, ok := rec.addrInfo[address]; !ok {
 			for i := 0; i < rec.concurrency; i++ {
-				client := NewSClient(address, weight, weight)
-				clients = append(clients, client)
-				go client.AsyncDial(rec.network, address, rec.connectTimeout,
-					rec.fn, rec.pendingNum)
+				clients = append(clients, rec.sclientCreate(address, weight))
 			}
 		}
 	}
@@ -370,18 +568,21 @@ func (rec *Client) Update(addrInfo map[string]int32) error {
 			clients = append(clients, client)
 		} else {
 			client.CloseAll()
+			client.breaker.stateDelete()
+			rec.stats.backendDelete(client.Address)
 		}
 	}
 
 	rec.addrInfo = addrInfo
 	rec.clients = clients
-	rec.index = 0
+	rec.breakerCreate(rec.clients)
+	rec.balancer.Init(rec.clients)
 	return nil
 }
 
-// try to get an available client instance
-func (rec *Client) getClient() (*InternalClient, error) {
-	client, err := rec.Balance()
+// try to get an available client instance, for call without result recorded
+func (rec *Client) getClient(key string) (*InternalClient, error) {
+	client, err := rec.BalanceByKey(key)
 	if err != nil {
 		return nil, err
 	}
@@ -391,7 +592,12 @@ func (rec *Client) getClient() (*InternalClient, error) {
 
 // just send requst ,no response.
 func (rec *Client) GoNoReturn(req interface{}) {
-	client, err := rec.getClient()
+	rec.GoNoReturnByKey("", req)
+}
+
+// just send requst with key for balancer, no response.
+func (rec *Client) GoNoReturnByKey(key string, req interface{}) {
+	client, err := rec.getClient(key)
 	if err != nil {
 		log.Logger.Warn("no available connection now")
 		return
@@ -406,11 +612,72 @@ func (rec *Client) GoNoReturn(req interface{}) {
 
 // sync call, before the response is revceived, wait for timeout at most
 func (rec *Client) Call(req interface{}, res interface{}, timeout time.Duration) error {
-	client, err := rec.getClient()
-	if err == nil {
-		err = client.Call(req, res, timeout)
+	return rec.CallByKey("", req, res, timeout)
+}
+
+// sync call with key for balancer, e.g., consistent hashing on key
+func (rec *Client) CallByKey(key string, req interface{}, res interface{},
+	timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return rec.callContext(ctx, key, req, res)
+}
+
+/* CallContext - sync call, wait until the response is received or ctx is done
+ *
+ * Params:
+ *     - ctx: context for deadline and cancellation, key for balancer may be
+ *            set by NewKeyContext()
+ *     - req: request message
+ *     - res: response message
+ *
+ * Return:
+ *     - error: ErrTimeout if deadline exceeded, context.Canceled if cancelled
+ */
+func (rec *Client) CallContext(ctx context.Context, req interface{}, res interface{}) error {
+	return rec.callContext(ctx, keyFromContext(ctx), req, res)
+}
+
+// send call to a client selected by key, within the remaining budget of ctx
+func (rec *Client) callContext(ctx context.Context, key string, req interface{},
+	res interface{}) error {
+	// no budget left
+	if err := ctx.Err(); err != nil {
+		return contextErrConvert(err)
+	}
+
+	start := time.Now()
+	err := rec.callSend(ctx, key, req, res)
+	rec.stats.callRecord(start, err)
+
+	return err
+}
+
+// send call with retry if enabled, or to a single client
+func (rec *Client) callSend(ctx context.Context, key string, req interface{},
+	res interface{}) error {
+	// retries and hedged requests share the budget of ctx
+	if rec.retryConf != nil {
+		return rec.callRetry(ctx, key, req, res)
 	}
 
+	client, err := rec.balanceExclude(key, nil, true)
+	if err != nil {
+		return err
+	}
+
+	return rec.callClient(ctx, client, req, res)
+}
+
+// send call to given client, and record result for breaker and stats
+func (rec *Client) callClient(ctx context.Context, client *SClient, req interface{},
+	res interface{}) error {
+	start := time.Now()
+	err := client.GetInternal().CallContext(ctx, req, res)
+	rec.breakerRecord(client, err)
+	rec.stats.backendRecord(client.Address, start, err)
+
 	return err
 }
 
@@ -365,7 +365,7 @@ func TestWRR_case3(t *testing.T) {
 		return
 	}
 	sort.Sort(SClients(clientPool.clients))
-	clientPool.index = 0
+	clientPool.balancer.Init(clientPool.clients)
 
 	expectResult := []string{
 		"/tmp/notexist/a",
@@ -3,6 +3,7 @@
 modification history
 --------------------
 2014/7/1, by Weiwei, create
+2026/10/18, by agent, add ServerCodec interface
 */
 /*
 DESCRIPTION
@@ -17,6 +18,7 @@ import (
 )
 
 var ErrCodecType = errors.New("not expecting codec type")
+var ErrMagicStr = errors.New("magic str mismatch")
 
 // A ClientCodec implements writing of requests and
 // reading of responses for the client side of an session.
@@ -38,7 +40,28 @@ type ClientCodec interface {
 // codec create func type def
 type fnCreateCodec func(wrc io.ReadWriteCloser) ClientCodec
 
+// A ServerCodec implements reading of requests and writing of
+// responses for the server side of an session.
+// The server calls ReadRequestHeader and ReadRequestBody in pairs
+// to read requests from the connection, and calls WriteResponse to
+// write a response back. The server calls Close when finished with the
+// connection. ReadRequestBody may be called with a nil argument to force
+// the body of the request to be read and then discarded.
+type ServerCodec interface {
+	ReadRequestHeader(*Header) error
+	ReadRequestBody(interface{}) error
+	// WriteResponse must be safe for concurrent use by multiple goroutines.
+	WriteResponse(*Header, interface{}) error
+
+	Close() error
+}
+
+// server codec create func type def
+type fnCreateServerCodec func(wrc io.ReadWriteCloser) ServerCodec
+
 // protocol header length
 var HEADER_LEN = func() int { return binary.Size(Header{}) }()
 
 var DefautCreateCodec = NewPbClientCodec
+
+var DefaultCreateServerCodec = NewPbServerCodec
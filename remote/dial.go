@@ -0,0 +1,104 @@
+/* dial.go - backoff and health check for dialing in SClient.AsyncDial */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+When dialing to server fails, SClient waits before the next dial. The wait
+interval is decided by exponential backoff with full jitter:
+    interval = random(0, min(MaxInterval, BaseInterval * Multiplier ^ attempt))
+so clients do not reconnect in lockstep when a backend pool restarts.
+
+If HealthCheck is set, it is called with the new connection, and the
+connection is marked CONNECTED only if it succeeds.
+
+Counters of dialing are kept in Client.StateGet():
+- DIAL_SUCC              : connections established
+- DIAL_FAIL              : dials failed
+- DIAL_HEALTH_CHECK_FAIL : connections closed for health check failure
+- CONN_BROKEN            : connections broken (not closed by Client)
+
+Usage:
+    conf := DefaultDialConf()
+    conf.HealthCheck = func(client *InternalClient) error {
+        return client.Call(pingRequest, new(PingResponse), 100*time.Millisecond)
+    }
+    client := NewClientByAddr("tcp", addrInfo, 1*time.Second, 8, nil, 100,
+        WithDial(conf))
+*/
+
+package remote
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// counters of Client
+var clientCounterKeys = []string{
+	"DIAL_SUCC",
+	"DIAL_FAIL",
+	"DIAL_HEALTH_CHECK_FAIL",
+	"CONN_BROKEN",
+}
+
+// config for dialing to server
+type DialConf struct {
+	BaseInterval time.Duration // base interval of backoff
+	MaxInterval  time.Duration // max interval of backoff
+	Multiplier   float64       // multiplier of interval for each failure, >= 1
+
+	// check health of new connection, nil for no check
+	HealthCheck func(client *InternalClient) error
+}
+
+// DefaultDialConf returns default config for dialing
+func DefaultDialConf() DialConf {
+	return DialConf{
+		BaseInterval: 100 * time.Millisecond,
+		MaxInterval:  10 * time.Second,
+		Multiplier:   2,
+	}
+}
+
+// WithDial sets config for dialing to server
+func WithDial(conf DialConf) ClientOption {
+	return func(rec *Client) {
+		defaultConf := DefaultDialConf()
+		if conf.BaseInterval <= 0 {
+			conf.BaseInterval = defaultConf.BaseInterval
+		}
+		if conf.MaxInterval < conf.BaseInterval {
+			conf.MaxInterval = conf.BaseInterval
+		}
+		if conf.Multiplier < 1 {
+			conf.Multiplier = defaultConf.Multiplier
+		}
+		rec.dialConf = conf
+	}
+}
+
+/*
+backoffInterval - get wait interval before the next dial
+
+Params:
+    - conf: config for dialing
+    - attempt: number of failed attempts before, starting from 0
+
+Returns:
+    interval, in [0, min(MaxInterval, BaseInterval * Multiplier ^ attempt))
+*/
+func backoffInterval(conf *DialConf, attempt int) time.Duration {
+	ceiling := float64(conf.BaseInterval) * math.Pow(conf.Multiplier, float64(attempt))
+	if ceiling > float64(conf.MaxInterval) || math.IsInf(ceiling, 0) {
+		ceiling = float64(conf.MaxInterval)
+	}
+	if ceiling < 1 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
@@ -0,0 +1,124 @@
+package remote
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/remote/test_pb"
+)
+
+// test of backoffInterval
+func TestBackoffInterval(t *testing.T) {
+	conf := DialConf{
+		BaseInterval: 100 * time.Millisecond,
+		MaxInterval:  time.Second,
+		Multiplier:   2,
+	}
+
+	for attempt := 0; attempt < 100; attempt++ {
+		ceiling := conf.BaseInterval << uint(attempt)
+		if attempt >= 4 {
+			ceiling = conf.MaxInterval
+		}
+
+		for i := 0; i < 100; i++ {
+			interval := backoffInterval(&conf, attempt)
+			if interval < 0 || interval >= ceiling {
+				t.Fatalf("attempt %d: interval %v out of [0, %v)", attempt, interval, ceiling)
+			}
+		}
+	}
+}
+
+// test of WithDial
+func TestWithDial(t *testing.T) {
+	clientPool := NewClientByAddr("unix", map[string]int32{}, time.Second, 1, nil, 100,
+		WithDial(DialConf{BaseInterval: time.Second, Multiplier: 0.5}))
+
+	conf := clientPool.dialConf
+	if conf.BaseInterval != time.Second || conf.MaxInterval != time.Second || conf.Multiplier != 2 {
+		t.Errorf("unexpected dial conf: %+v", conf)
+	}
+}
+
+// wait until counter of Client reaches value
+func counterWait(clientPool *Client, key string, value int64) bool {
+	for i := 0; i < 200; i++ {
+		if clientPool.StateGet().GetCounters()[key] >= value {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// test of AsyncDial, with failure and backoff
+func TestAsyncDialBackoff(t *testing.T) {
+	conf := DialConf{BaseInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond}
+	clientPool := NewClientByAddr("unix", map[string]int32{"/tmp/notexist/a": 1}, time.Second,
+		1, nil, 100, WithDial(conf))
+	defer clientPool.Close()
+
+	if !counterWait(clientPool, "DIAL_FAIL", 3) {
+		t.Errorf("dial should be retried")
+	}
+	if clientPool.StateGet().GetCounters()["DIAL_SUCC"] != 0 {
+		t.Errorf("dial should not succeed")
+	}
+}
+
+// test of AsyncDial, with health check
+func TestAsyncDialHealthCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote_dial")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "server.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen(): %s", err.Error())
+	}
+	server := NewServer(nil)
+	server.Handle(MSG_TYPE_REQUEST, new(wafHandler))
+	go server.Serve(l)
+	defer server.Close()
+
+	// health check failed, until healthy is set
+	var healthy int32
+	conf := DialConf{BaseInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond}
+	conf.HealthCheck = func(client *InternalClient) error {
+		if atomic.LoadInt32(&healthy) == 0 {
+			return errors.New("not healthy")
+		}
+		return client.Call(wafRequestNew("ping"), new(test_pb.WafResponse), time.Second)
+	}
+
+	clientPool := NewClientByAddr("unix", map[string]int32{path: 1}, time.Second, 1, nil, 100,
+		WithDial(conf))
+	defer clientPool.Close()
+
+	if !counterWait(clientPool, "DIAL_HEALTH_CHECK_FAIL", 2) {
+		t.Fatalf("health check should fail")
+	}
+	if atomic.LoadInt32(&clientPool.clients[0].Status) == CONNECTED {
+		t.Errorf("client should not be connected before health check succeeds")
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	if !counterWait(clientPool, "DIAL_SUCC", 1) {
+		t.Fatalf("dial should succeed after health check succeeds")
+	}
+	if err := clientPool.Call(wafRequestNew("test"), new(test_pb.WafResponse), time.Second); err != nil {
+		t.Errorf("Call(): %s", err.Error())
+	}
+}
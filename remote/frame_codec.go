@@ -0,0 +1,211 @@
+/* frame_codec.go - json and raw codecs, on the same binary header as pb codec */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+ Message = header + body
+
+ header is encode/decode using encoding/binary. BigEndian
+    |MagicStr(4)|MessageType(2)|ReservedSize(2)|MessageSize(4)|Sequence(4)|
+
+ body is encoded by:
+ - json codec: encoding/json
+ - raw codec : no encoding, body of request must be []byte, and body of
+               response must be *[]byte
+
+ Both codecs implement interface ClientCodec and ServerCodec.
+
+client example:
+    // json codec
+    client := NewClient("unix", "/tmp/json.sock", 1*time.Second, 8, NewJsonClientCodec, 100)
+
+    // raw codec
+    client := NewClient("unix", "/tmp/raw.sock", 1*time.Second, 8, NewRawClientCodec, 100)
+    var res []byte
+    err := client.Call([]byte("request"), &res, 10*time.Millisecond)
+
+server example:
+    server := NewServer(NewJsonServerCodec)
+*/
+
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// marshal and unmarshal of message body
+type bodyCodec interface {
+	// marshal body to bytes
+	marshal(body interface{}) ([]byte, error)
+
+	// unmarshal data to body; data is reused after return
+	unmarshal(data []byte, body interface{}) error
+}
+
+// binary header + body encoded by bodyCodec
+type frameCodec struct {
+	rwc  io.ReadWriteCloser
+	r    *bufio.Reader
+	body bodyCodec
+
+	// buffer to the write side of the connection so the header
+	// and payload are sent as a unit
+	encBuf  *bufio.Writer
+	sending sync.Mutex // messages may be written by multiple goroutines
+
+	bodySize uint32 // body size parsed from header
+}
+
+func newFrameCodec(rwc io.ReadWriteCloser, body bodyCodec) *frameCodec {
+	c := new(frameCodec)
+	c.rwc = rwc
+	c.r = bufio.NewReader(rwc)
+	c.body = body
+	c.encBuf = bufio.NewWriter(rwc)
+	return c
+}
+
+// NewJsonClientCodec creates client codec with json body
+func NewJsonClientCodec(rwc io.ReadWriteCloser) ClientCodec {
+	return newFrameCodec(rwc, jsonCodec{})
+}
+
+// NewJsonServerCodec creates server codec with json body
+func NewJsonServerCodec(rwc io.ReadWriteCloser) ServerCodec {
+	return newFrameCodec(rwc, jsonCodec{})
+}
+
+// NewRawClientCodec creates client codec with raw []byte body
+func NewRawClientCodec(rwc io.ReadWriteCloser) ClientCodec {
+	return newFrameCodec(rwc, rawCodec{})
+}
+
+// NewRawServerCodec creates server codec with raw []byte body
+func NewRawServerCodec(rwc io.ReadWriteCloser) ServerCodec {
+	return newFrameCodec(rwc, rawCodec{})
+}
+
+// write header and body
+func (c *frameCodec) write(r *Header, body interface{}) error {
+	data, err := c.body.marshal(body)
+	if err != nil {
+		return err
+	}
+	if len(data)+HEADER_LEN > MAX_MESSAGE_SIZE {
+		return ErrMessageSize
+	}
+
+	c.sending.Lock()
+	defer c.sending.Unlock()
+
+	r.MessageSize = uint32(len(data) + HEADER_LEN)
+	if err := binary.Write(c.encBuf, binary.BigEndian, r); err != nil {
+		return err
+	}
+	if _, err := c.encBuf.Write(data); err != nil {
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+// read header
+func (c *frameCodec) readHeader(r *Header) error {
+	if err := binary.Read(c.r, binary.BigEndian, r); err != nil {
+		return err
+	}
+	if r.MagicStr != MAGIC_STR {
+		return ErrMagicStr
+	}
+
+	var err error
+	c.bodySize, err = bodySizeGet(r)
+	return err
+}
+
+// read body; body is discarded if nil
+func (c *frameCodec) readBody(body interface{}) error {
+	if body == nil {
+		_, err := c.r.Discard(int(c.bodySize))
+		return err
+	}
+
+	buf, err := bodyRead(c.r, int(c.bodySize))
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+
+	return c.body.unmarshal(buf, body)
+}
+
+func (c *frameCodec) WriteRequest(r *Header, body interface{}) error {
+	return c.write(r, body)
+}
+
+func (c *frameCodec) ReadResponseHeader(r *Header) error {
+	return c.readHeader(r)
+}
+
+func (c *frameCodec) ReadResponseBody(body interface{}) error {
+	return c.readBody(body)
+}
+
+func (c *frameCodec) ReadRequestHeader(r *Header) error {
+	return c.readHeader(r)
+}
+
+func (c *frameCodec) ReadRequestBody(body interface{}) error {
+	return c.readBody(body)
+}
+
+func (c *frameCodec) WriteResponse(r *Header, body interface{}) error {
+	return c.write(r, body)
+}
+
+func (c *frameCodec) Close() error {
+	return c.rwc.Close()
+}
+
+// body encoded by encoding/json
+type jsonCodec struct{}
+
+func (jsonCodec) marshal(body interface{}) ([]byte, error) {
+	return json.Marshal(body)
+}
+
+func (jsonCodec) unmarshal(data []byte, body interface{}) error {
+	return json.Unmarshal(data, body)
+}
+
+// raw body, []byte or *[]byte
+type rawCodec struct{}
+
+func (rawCodec) marshal(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		return *b, nil
+	default:
+		return nil, ErrCodecType
+	}
+}
+
+func (rawCodec) unmarshal(data []byte, body interface{}) error {
+	b, ok := body.(*[]byte)
+	if !ok {
+		return ErrCodecType
+	}
+
+	// data is reused, so copy it
+	*b = append((*b)[:0], data...)
+	return nil
+}
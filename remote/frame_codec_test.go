@@ -0,0 +1,224 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// json message for test
+type jsonMessage struct {
+	Name  string
+	Value int
+}
+
+// handler echoes json message, with Value increased
+type jsonEchoHandler struct{}
+
+func (jsonEchoHandler) NewRequest() interface{} {
+	return new(jsonMessage)
+}
+
+func (jsonEchoHandler) Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error) {
+	msg := req.(*jsonMessage)
+	return &jsonMessage{Name: msg.Name, Value: msg.Value + 1}, nil
+}
+
+// handler echoes raw message
+type rawEchoHandler struct{}
+
+func (rawEchoHandler) NewRequest() interface{} {
+	return new([]byte)
+}
+
+func (rawEchoHandler) Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error) {
+	return *req.(*[]byte), nil
+}
+
+// start server with given codec, and dial to it
+func prepareCodecClient(t *testing.T, serverFn fnCreateServerCodec, clientFn fnCreateCodec,
+	handler Handler) (*InternalClient, func()) {
+	dir, err := ioutil.TempDir("", "remote_codec")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	path := filepath.Join(dir, "server.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen(): %s", err.Error())
+	}
+	server := NewServer(serverFn)
+	server.Handle(MSG_TYPE_REQUEST, handler)
+	go server.Serve(l)
+
+	client, err := Dial("unix", path, time.Second, clientFn, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+
+	return client, func() {
+		client.Close()
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// test of json codec
+func TestJsonCodec(t *testing.T) {
+	client, cleanup := prepareCodecClient(t, NewJsonServerCodec, NewJsonClientCodec,
+		jsonEchoHandler{})
+	defer cleanup()
+
+	res := new(jsonMessage)
+	if err := client.Call(&jsonMessage{"test", 1}, res, time.Second); err != nil {
+		t.Fatalf("Call(): %s", err.Error())
+	}
+	if res.Name != "test" || res.Value != 2 {
+		t.Errorf("unexpected response: %+v", res)
+	}
+}
+
+// test of raw codec, with message larger than 64k
+func TestRawCodec(t *testing.T) {
+	client, cleanup := prepareCodecClient(t, NewRawServerCodec, NewRawClientCodec,
+		rawEchoHandler{})
+	defer cleanup()
+
+	for _, size := range []int{0, 100, 100 * 1024, 2 * 1024 * 1024, 5 * 1024 * 1024} {
+		req := bytes.Repeat([]byte("a"), size)
+		var res []byte
+		if err := client.Call(req, &res, 5*time.Second); err != nil {
+			t.Fatalf("Call() with size %d: %s", size, err.Error())
+		}
+		if !bytes.Equal(req, res) {
+			t.Errorf("response mismatch for size %d, got size %d", size, len(res))
+		}
+	}
+
+	// body of wrong type
+	if err := client.Call("string", new([]byte), time.Second); err != ErrCodecType {
+		t.Errorf("err should be ErrCodecType, got %v", err)
+	}
+}
+
+// test of newBuffer and putBuffer
+func TestNewBuffer(t *testing.T) {
+	cases := []struct {
+		size int
+		cap  int
+	}{
+		{1, 4 * 1024},
+		{4 * 1024, 4 * 1024},
+		{64*1024 + 1, 256 * 1024},
+		{1024 * 1024, 1024 * 1024},
+		{4 * 1024 * 1024, 4 * 1024 * 1024},
+	}
+	for _, c := range cases {
+		buf, err := newBuffer(c.size)
+		if err != nil {
+			t.Fatalf("newBuffer(%d): %s", c.size, err.Error())
+		}
+		if len(buf) != c.size || cap(buf) != c.cap {
+			t.Errorf("newBuffer(%d): len %d, cap %d", c.size, len(buf), cap(buf))
+		}
+		putBuffer(buf)
+	}
+
+	// larger than buffers in pool
+	if buf, err := newBuffer(4*1024*1024 + 1); err != nil || len(buf) != 4*1024*1024+1 {
+		t.Errorf("newBuffer(4M+1): len %d, %v", len(buf), err)
+	}
+
+	if _, err := newBuffer(MAX_MESSAGE_SIZE + 1); err != ErrTooLarge {
+		t.Errorf("err should be ErrTooLarge, got %v", err)
+	}
+	if ErrTooLarge.Error() != "required slice size exceed 64M" {
+		t.Errorf("ErrTooLarge = %s", ErrTooLarge.Error())
+	}
+}
+
+// test of bodyRead
+func TestBodyRead(t *testing.T) {
+	// small body, from pool
+	buf, err := bodyRead(bytes.NewReader([]byte("hello")), 5)
+	if err != nil || string(buf) != "hello" {
+		t.Errorf("bodyRead(): %s, %v", buf, err)
+	}
+	putBuffer(buf)
+
+	// large body
+	data := bytes.Repeat([]byte("a"), 5*1024*1024)
+	if buf, err := bodyRead(bytes.NewReader(data), len(data)); err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("bodyRead(5M): len %d, %v", len(buf), err)
+	}
+
+	// memory is not allocated by size in header, if data is not sent
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := bodyRead(bytes.NewReader(data[:10]), MAX_MESSAGE_SIZE-HEADER_LEN); err != io.ErrUnexpectedEOF {
+		t.Errorf("err should be ErrUnexpectedEOF, got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 8*1024*1024 {
+		t.Errorf("bodyRead() should not allocate by size in header, got %d", alloc)
+	}
+}
+
+// pb message for test, with given size
+type sizeMessage struct {
+	size int
+}
+
+func (m *sizeMessage) Reset()         {}
+func (m *sizeMessage) String() string { return "sizeMessage" }
+func (m *sizeMessage) ProtoMessage()  {}
+func (m *sizeMessage) Size() int      { return m.size }
+
+func (m *sizeMessage) Marshal() ([]byte, error) {
+	return make([]byte, m.size), nil
+}
+
+func (m *sizeMessage) MarshalTo(data []byte) (int, error) {
+	return m.size, nil
+}
+
+// test of PbEncoder, message larger than MAX_MESSAGE_SIZE
+func TestPbEncoderTooLarge(t *testing.T) {
+	var buff bytes.Buffer
+	enc := NewPbEncoder(&buff)
+
+	if err := enc.Encode(new(Header), &sizeMessage{MAX_MESSAGE_SIZE - HEADER_LEN + 1}); err != ErrTooLarge {
+		t.Errorf("err should be ErrTooLarge, got %v", err)
+	}
+	if buff.Len() != 0 {
+		t.Errorf("nothing should be written, got %d bytes", buff.Len())
+	}
+
+	if err := enc.Encode(new(Header), &sizeMessage{10}); err != nil {
+		t.Errorf("Encode(): %s", err.Error())
+	}
+	if buff.Len() != HEADER_LEN+10 {
+		t.Errorf("%d bytes should be written, got %d", HEADER_LEN+10, buff.Len())
+	}
+}
+
+// test of bodySizeGet
+func TestBodySizeGet(t *testing.T) {
+	if size, err := bodySizeGet(&Header{MessageSize: uint32(HEADER_LEN) + 10}); err != nil || size != 10 {
+		t.Errorf("body size should be 10, got %d, %v", size, err)
+	}
+	if _, err := bodySizeGet(&Header{MessageSize: 1}); err != ErrMessageSize {
+		t.Errorf("err should be ErrMessageSize, got %v", err)
+	}
+	if _, err := bodySizeGet(&Header{MessageSize: MAX_MESSAGE_SIZE + 1}); err != ErrMessageSize {
+		t.Errorf("err should be ErrMessageSize, got %v", err)
+	}
+}
@@ -6,6 +6,8 @@ modification history
 2016/3/10, by Sijie Yang, modify
     - merge bug fix for close from upstream source
       (see https://codereview.appspot.com/91230045)
+2026/10/18, by agent, modify
+    - add CallContext() for deadline and cancellation by context
 */
 /*
 DESCRIPTION
@@ -16,6 +18,9 @@ client example:
     // request, response, sync case:
     err := client.Call(request, response, 10*time.Millisecond)
 
+    // request, response, with deadline and cancellation of ctx:
+    err := client.CallContext(ctx, request, response)
+
 	// request no response case
 	err := client.GoNoReturn(request)
 */
@@ -23,6 +28,7 @@ client example:
 package remote
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net"
@@ -111,12 +117,13 @@ func (client *InternalClient) send(call *Call) {
 	select {
 	case client.calls <- call:
 		client.pending[call.Seq] = call
+		client.mutex.Unlock()
 	default:
 		// chan is full
 		call.Error = ErrFull
+		client.mutex.Unlock()
+		call.done()
 	}
-
-	client.mutex.Unlock()
 }
 
 // send message to server
@@ -340,6 +347,43 @@ func (client *InternalClient) Call(req interface{}, res interface{}, timeout tim
 	}
 }
 
+/*
+CallContext - invoke the call, and wait for it to complete, or ctx to be done
+
+Params:
+    - ctx: context for deadline and cancellation
+    - req: request message
+    - res: response message
+
+Returns:
+    error of the call
+    - ErrTimeout: deadline of ctx exceeded
+    - context.Canceled: ctx cancelled
+*/
+func (client *InternalClient) CallContext(ctx context.Context, req interface{}, res interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return contextErrConvert(err)
+	}
+
+	call := client.Go(req, res, make(chan *Call, 1), MSG_TYPE_REQUEST)
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		// response is not needed; Done is buffered, so input() never blocks on it
+		client.RemovePendingOnCall(call)
+		return contextErrConvert(ctx.Err())
+	}
+}
+
+// convert error of context to error of call
+func contextErrConvert(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
+
 // return pending call num
 func (client *InternalClient) pendingCallNum() int {
 	if client == nil {
@@ -347,3 +391,14 @@ func (client *InternalClient) pendingCallNum() int {
 	}
 	return len(client.calls)
 }
+
+// return number of calls waiting to send or waiting for response
+func (client *InternalClient) activeCallNum() int {
+	if client == nil {
+		return 0
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return len(client.pending)
+}
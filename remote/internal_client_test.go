@@ -0,0 +1,183 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// codec for test, responses are sent by test through channel
+type testCodec struct {
+	requests  chan Header // requests written
+	responses chan Header // responses to read
+	closed    chan bool
+}
+
+func newTestCodec() *testCodec {
+	c := new(testCodec)
+	c.requests = make(chan Header, 100)
+	c.responses = make(chan Header, 100)
+	c.closed = make(chan bool)
+	return c
+}
+
+func (c *testCodec) WriteRequest(h *Header, body interface{}) error {
+	c.requests <- *h
+	return nil
+}
+
+func (c *testCodec) ReadResponseHeader(h *Header) error {
+	select {
+	case *h = <-c.responses:
+		return nil
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+func (c *testCodec) ReadResponseBody(body interface{}) error {
+	return nil
+}
+
+func (c *testCodec) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func pendingNumGet(client *InternalClient) int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return len(client.pending)
+}
+
+// test of CallContext, response received
+func TestCallContext_1(t *testing.T) {
+	codec := newTestCodec()
+	client := NewInternalClientWithCodec(codec, 10)
+	defer client.Close()
+
+	go func() {
+		h := <-codec.requests
+		codec.responses <- Header{Seq: h.Seq, MessageType: MSG_TYPE_RESPONSE}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.CallContext(ctx, "req", nil); err != nil {
+		t.Errorf("CallContext() should succeed: %v", err)
+	}
+	if pendingNumGet(client) != 0 {
+		t.Errorf("pending should be empty")
+	}
+}
+
+// test of CallContext, deadline exceeded
+func TestCallContext_2(t *testing.T) {
+	codec := newTestCodec()
+	client := NewInternalClientWithCodec(codec, 10)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.CallContext(ctx, "req", nil); err != ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+	if pendingNumGet(client) != 0 {
+		t.Errorf("pending should be empty after timeout")
+	}
+
+	// no call is sent with expired ctx
+	<-codec.requests
+	if err := client.CallContext(ctx, "req", nil); err != ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+	select {
+	case <-codec.requests:
+		t.Errorf("call should not be sent with expired ctx")
+	default:
+	}
+}
+
+// test of CallContext, cancelled
+func TestCallContext_3(t *testing.T) {
+	codec := newTestCodec()
+	client := NewInternalClientWithCodec(codec, 10)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		h := <-codec.requests
+		cancel()
+
+		// late response is discarded
+		time.Sleep(10 * time.Millisecond)
+		codec.responses <- Header{Seq: h.Seq, MessageType: MSG_TYPE_RESPONSE}
+	}()
+
+	if err := client.CallContext(ctx, "req", nil); err != context.Canceled {
+		t.Errorf("err should be context.Canceled, got %v", err)
+	}
+	if pendingNumGet(client) != 0 {
+		t.Errorf("pending should be empty after cancel")
+	}
+}
+
+// test of Client.CallContext, with key in context
+func TestClientCallContext(t *testing.T) {
+	ctx := NewKeyContext(context.Background(), "user-1")
+	if keyFromContext(ctx) != "user-1" {
+		t.Errorf("key should be user-1")
+	}
+	if keyFromContext(context.Background()) != "" {
+		t.Errorf("key should be empty")
+	}
+
+	// no client available
+	clientPool := NewClientByAddr("unix", map[string]int32{}, time.Second, 1, nil, 100)
+	if err := clientPool.CallContext(ctx, "req", nil); err != ErrNoClients {
+		t.Errorf("err should be ErrNoClients, got %v", err)
+	}
+
+	// no budget left
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := clientPool.CallContext(ctx, "req", nil); err != context.Canceled {
+		t.Errorf("err should be context.Canceled, got %v", err)
+	}
+}
+
+// test of CallContext, pending queue is full
+func TestCallContext_Full(t *testing.T) {
+	codec := newTestCodec()
+	codec.requests = make(chan Header) // block output() on WriteRequest
+	client := NewInternalClientWithCodec(codec, 1)
+	defer client.Close()
+
+	// the first call is being written, and the second fills the queue
+	client.Go(nil, nil, nil, MSG_TYPE_REQUEST)
+	for i := 0; i < 100 && client.pendingCallNum() != 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	client.Go(nil, nil, nil, MSG_TYPE_REQUEST)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.CallContext(context.Background(), nil, nil)
+	}()
+	select {
+	case err := <-errCh:
+		if err != ErrFull {
+			t.Errorf("err should be ErrFull, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("CallContext() should return when pending queue is full")
+	}
+
+	// with deadline, ErrFull is returned instead of timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.CallContext(ctx, nil, nil); err != ErrFull {
+		t.Errorf("err should be ErrFull, got %v", err)
+	}
+}
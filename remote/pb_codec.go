@@ -5,6 +5,10 @@ modification history
 2014/7/1, by Weiwei02, create
 2014/9/28, modified by weiwei, reuse buffer to reduce memory assumption
         accept message type Gogopb instead of go pb
+2026/10/18, by agent, add PbServerCodec implementing interface ServerCodec
+2026/10/18, by agent, add pooled buffers for message larger than 64k, up to 4M
+2026/10/18, by agent, read body larger than 4M incrementally, refuse to encode message
+        larger than MAX_MESSAGE_SIZE
 */
 /*
 DESCRIPTION
@@ -23,8 +27,10 @@ package remote
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
 )
@@ -49,6 +55,24 @@ func NewPbClientCodec(wrc io.ReadWriteCloser) ClientCodec {
 	return &PbClientCodec{wrc, NewPbDecoder(bufio.NewReader(wrc)), NewPbEncoder(encBuf), encBuf}
 }
 
+// binary header encoding + pb body encoding, for server side
+type PbServerCodec struct {
+	rwc io.ReadWriteCloser
+	dec *PbDecoder
+	enc *PbEncoder
+
+	// buffer to the write side of the connection so the header
+	// and payload are sent as a unit
+	encBuf  *bufio.Writer
+	sending sync.Mutex // responses may be written by multiple goroutines
+}
+
+func NewPbServerCodec(wrc io.ReadWriteCloser) ServerCodec {
+	encBuf := bufio.NewWriter(wrc)
+	return &PbServerCodec{rwc: wrc, dec: NewPbDecoder(bufio.NewReader(wrc)),
+		enc: NewPbEncoder(encBuf), encBuf: encBuf}
+}
+
 type PbEncoder struct {
 	w io.Writer
 }
@@ -68,8 +92,12 @@ func NewPbDecoder(r io.Reader) *PbDecoder {
 	return d
 }
 
+// max message size, including header size
+const MAX_MESSAGE_SIZE = 64 * 1024 * 1024
+
 var (
-	ErrTooLarge = errors.New("required slice size exceed 64k")
+	ErrTooLarge    = fmt.Errorf("required slice size exceed %dM", MAX_MESSAGE_SIZE/(1024*1024))
+	ErrMessageSize = errors.New("invalid message size")
 )
 
 var (
@@ -77,48 +105,99 @@ var (
 	buf4kPool  sync.Pool
 	buf16kPool sync.Pool
 	buf64kPool sync.Pool
+
+	// buffer for large message
+	buf256kPool sync.Pool
+	buf1mPool   sync.Pool
+	buf4mPool   sync.Pool
 )
 
+// size classes of buffer pools, in ascending order
+var bufPools = []struct {
+	size int
+	pool *sync.Pool
+}{
+	{4 * 1024, &buf4kPool},
+	{16 * 1024, &buf16kPool},
+	{64 * 1024, &buf64kPool},
+	{256 * 1024, &buf256kPool},
+	{1024 * 1024, &buf1mPool},
+	{4 * 1024 * 1024, &buf4mPool},
+}
+
 // get proper []byte from pool
-// if size > 64K, return ErrTooLarge
+// if size > 4M, slice is allocated without pool
+// if size > MAX_MESSAGE_SIZE, return ErrTooLarge
 func newBuffer(size int) ([]byte, error) {
-	var pool *sync.Pool
-
-	// return buffer size
-	originSize := size
-
-	if size <= 4096 {
-		size = 4096
-		pool = &buf4kPool
-	} else if size <= 16*1024 {
-		size = 16 * 1024
-		pool = &buf16kPool
-	} else if size <= 64*1024 {
-		size = 64 * 1024
-		pool = &buf64kPool
-	} else {
-		// if message is larger than 16K, return err
+	for _, class := range bufPools {
+		if size > class.size {
+			continue
+		}
+
+		if v := class.pool.Get(); v != nil {
+			return v.([]byte)[:size], nil
+		}
+		return make([]byte, class.size)[:size], nil
+	}
+
+	if size > MAX_MESSAGE_SIZE {
 		return nil, ErrTooLarge
 	}
+	return make([]byte, size), nil
+}
 
-	if v := pool.Get(); v != nil {
-		return v.([]byte)[:originSize], nil
+/* bodyRead - read body with given size
+ *
+ * Params:
+ *     - r: reader
+ *     - size: size of body, not larger than MAX_MESSAGE_SIZE
+ *
+ * Return:
+ *     - (body, error)
+ *       body larger than buffers in pool is read incrementally, so memory is
+ *       allocated as data arrives, not by size in header; body should be
+ *       returned by putBuffer() after use
+ */
+func bodyRead(r io.Reader, size int) ([]byte, error) {
+	if size <= bufPools[len(bufPools)-1].size {
+		buf, err := newBuffer(size)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			putBuffer(buf)
+			return nil, err
+		}
+		return buf, nil
 	}
 
-	return make([]byte, size)[:originSize], nil
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, r, int64(size))
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
 }
 
 func putBuffer(b []byte) {
 	b = b[:cap(b)]
-	if cap(b) == 4096 {
-		buf4kPool.Put(b)
-	}
-	if cap(b) == 16*1024 {
-		buf16kPool.Put(b)
+	for _, class := range bufPools {
+		if cap(b) == class.size {
+			class.pool.Put(b)
+			return
+		}
 	}
-	if cap(b) == 64*1024 {
-		buf64kPool.Put(b)
+}
+
+// check message size in header, and get body size
+func bodySizeGet(r *Header) (uint32, error) {
+	if r.MessageSize < uint32(HEADER_LEN) || r.MessageSize > MAX_MESSAGE_SIZE {
+		return 0, ErrMessageSize
 	}
+	return r.MessageSize - uint32(HEADER_LEN), nil
 }
 
 // GogoPB don't define a gogomarshal interface
@@ -137,15 +216,18 @@ func (enc *PbEncoder) Encode(r *Header, body interface{}) error {
 		return ErrCodecType
 	}
 
-	// get from pb recycle buffer
+	// message larger than MAX_MESSAGE_SIZE would be refused by peer
 	size := pb.Size()
+	if size+HEADER_LEN > MAX_MESSAGE_SIZE {
+		return ErrTooLarge
+	}
+
+	// get from pb recycle buffer
 	buf, err := newBuffer(size)
 	if err != nil {
-		// if size is too large, alloc directly
-		buf = make([]byte, size)
-	} else {
-		defer putBuffer(buf)
+		return err
 	}
+	defer putBuffer(buf)
 
 	// marshal to buffer
 	n, err := pb.MarshalTo(buf)
@@ -165,23 +247,19 @@ func (enc *PbEncoder) Encode(r *Header, body interface{}) error {
 func (dec *PbDecoder) DecodeHeader(r *Header) error {
 	err := binary.Read(dec.r, binary.BigEndian, r)
 	if err == nil {
-		dec.BodySize = r.MessageSize - uint32(HEADER_LEN)
+		dec.BodySize, err = bodySizeGet(r)
 	}
 	return err
 }
 
 func (dec *PbDecoder) Decode(body interface{}) error {
-	buf, err := newBuffer(int(dec.BodySize))
+	buf, err := bodyRead(dec.r, int(dec.BodySize))
 	if err != nil {
-		// message should be read
-		// so if newBuffer failed, make a new slice
-		buf = make([]byte, dec.BodySize)
-	} else {
-		defer putBuffer(buf)
+		return err
 	}
+	defer putBuffer(buf)
 
-	_, err = io.ReadFull(dec.r, buf)
-	if err == nil && body != nil {
+	if body != nil {
 		pb, ok := body.(proto.Message)
 		if !ok {
 			return ErrCodecType
@@ -209,3 +287,31 @@ func (c *PbClientCodec) ReadResponseBody(body interface{}) error {
 func (c *PbClientCodec) Close() error {
 	return c.rwc.Close()
 }
+
+func (c *PbServerCodec) ReadRequestHeader(r *Header) error {
+	if err := c.dec.DecodeHeader(r); err != nil {
+		return err
+	}
+	if r.MagicStr != MAGIC_STR {
+		return ErrMagicStr
+	}
+	return nil
+}
+
+func (c *PbServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *PbServerCodec) WriteResponse(r *Header, body interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+
+	if err := c.enc.Encode(r, body); err != nil {
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *PbServerCodec) Close() error {
+	return c.rwc.Close()
+}
@@ -0,0 +1,407 @@
+/* mock_server.go - mock backend speaking the remote protocol, with fault injection */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Server is a fake backend for testing code using remote.Client. It listens on
+a unix socket or loopback, reads messages with the remote protocol header:
+    |MagicStr(4)|MessageType(2)|Reserved(2)|MessageSize(4)|Seq(4)|
+and responds by Responder registered for the message type.
+
+Body of message is not decoded, so Server works with any codec on the same
+header, e.g., pb, json and raw codec.
+
+For each request, Responder returns an Action, which may inject faults:
+- Delay       : respond after delay; responses of one connection may be out
+                of order with delays
+- Drop        : no response
+- SeqOffset   : respond with seq of request + SeqOffset, i.e., seq unknown
+                to client
+- PartialWrite: write only first n bytes of response, and close connection
+- Reset       : close connection instead of responding
+
+Usage:
+    server := remotetest.NewUnixServer()
+    defer server.Close()
+
+    server.Handle(remote.MSG_TYPE_REQUEST, remotetest.Script(
+        remotetest.Action{Drop: true},
+        remotetest.Respond(remotetest.Pb(response)),
+    ))
+
+    client := remote.NewClient(server.Network(), server.Addr(), time.Second, 1, nil, 100)
+*/
+
+package remotetest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+import (
+	"code.google.com/p/gogoprotobuf/proto"
+)
+
+import (
+	"www.baidu.com/golang-lib/remote"
+)
+
+// request received by Server
+type Request struct {
+	Header remote.Header // header of request
+	Body   []byte        // body of request, not decoded
+	Conn   int           // id of connection, increased from 0 in order of accept
+}
+
+// how Server responds to a request
+type Action struct {
+	Body         []byte        // body of response
+	Delay        time.Duration // delay before response
+	Drop         bool          // no response
+	SeqOffset    uint32        // seq of response = seq of request + SeqOffset
+	PartialWrite int           // if > 0, write only first n bytes of response, then close connection
+	Reset        bool          // close connection instead of responding
+}
+
+// Responder decides Action for a request; it is called in order of requests
+// received on a connection
+type Responder func(req *Request) Action
+
+// Respond returns Action responding body
+func Respond(body []byte) Action {
+	return Action{Body: body}
+}
+
+// Echo is a Responder responding body of request
+func Echo(req *Request) Action {
+	return Respond(req.Body)
+}
+
+// Script returns a Responder returning actions in order, the last action is
+// repeated after all actions are returned
+func Script(actions ...Action) Responder {
+	var lock sync.Mutex
+	index := 0
+
+	return func(req *Request) Action {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if len(actions) == 0 {
+			return Action{Drop: true}
+		}
+		action := actions[index]
+		if index < len(actions)-1 {
+			index++
+		}
+		return action
+	}
+}
+
+// Pb marshals pb message to body; it panics if marshal fails
+func Pb(msg proto.Message) []byte {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		panic(fmt.Sprintf("remotetest: marshal pb: %s", err.Error()))
+	}
+	return body
+}
+
+// mock backend
+type Server struct {
+	listener net.Listener
+	dir      string // temp dir for unix socket, empty for loopback
+
+	lock       sync.Mutex
+	responders map[uint16]Responder // responders for message types
+	conns      map[*mockConn]bool   // active connections
+	connNum    int                  // number of accepted connections
+	requests   []*Request           // requests received
+	closed     bool
+
+	done chan struct{} // closed when Server is closed
+	wg   sync.WaitGroup
+}
+
+// NewUnixServer starts a Server on a unix socket in a temp dir; it panics if
+// listen fails
+func NewUnixServer() *Server {
+	dir, err := ioutil.TempDir("", "remotetest")
+	if err != nil {
+		panic(fmt.Sprintf("remotetest: create temp dir: %s", err.Error()))
+	}
+
+	l, err := net.Listen("unix", filepath.Join(dir, "server.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		panic(fmt.Sprintf("remotetest: listen: %s", err.Error()))
+	}
+	return newServer(l, dir)
+}
+
+// NewTCPServer starts a Server on loopback; it panics if listen fails
+func NewTCPServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("remotetest: listen: %s", err.Error()))
+	}
+	return newServer(l, "")
+}
+
+func newServer(l net.Listener, dir string) *Server {
+	s := &Server{
+		listener:   l,
+		dir:        dir,
+		responders: make(map[uint16]Responder),
+		conns:      make(map[*mockConn]bool),
+		done:       make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Network returns network of Server, "unix" or "tcp"
+func (s *Server) Network() string {
+	return s.listener.Addr().Network()
+}
+
+// Addr returns address of Server
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Handle registers responder for message type; requests of message type
+// without responder get no response
+func (s *Server) Handle(msgType uint16, responder Responder) {
+	s.lock.Lock()
+	s.responders[msgType] = responder
+	s.lock.Unlock()
+}
+
+// Requests returns requests received
+func (s *Server) Requests() []*Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	requests := make([]*Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// RequestNum returns number of requests received
+func (s *Server) RequestNum() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.requests)
+}
+
+// ConnNum returns number of connections accepted
+func (s *Server) ConnNum() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.connNum
+}
+
+// ActiveConnNum returns number of active connections
+func (s *Server) ActiveConnNum() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.conns)
+}
+
+// ResetConns closes all active connections
+func (s *Server) ResetConns() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for c := range s.conns {
+		c.reset()
+	}
+}
+
+// Close stops Server, closes all connections and waits for them to finish
+func (s *Server) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	err := s.listener.Close()
+	for c := range s.conns {
+		c.reset()
+	}
+	s.lock.Unlock()
+
+	s.wg.Wait()
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+	return err
+}
+
+// accept connections until listener closed
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			conn.Close()
+			return
+		}
+		c := &mockConn{server: s, conn: conn, id: s.connNum}
+		s.connNum++
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.lock.Unlock()
+
+		go c.serve()
+	}
+}
+
+// record request, and get responder for it
+func (s *Server) requestRecord(req *Request) Responder {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, req)
+	return s.responders[req.Header.MessageType]
+}
+
+// connection accepted by Server
+type mockConn struct {
+	server *Server
+	conn   net.Conn
+	id     int
+
+	writing sync.Mutex // responses may be written by multiple goroutines
+}
+
+// read requests until connection closed
+func (c *mockConn) serve() {
+	var wg sync.WaitGroup
+	defer func() {
+		c.conn.Close()
+		wg.Wait()
+
+		c.server.lock.Lock()
+		delete(c.server.conns, c)
+		c.server.lock.Unlock()
+		c.server.wg.Done()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		req, err := c.readRequest(r)
+		if err != nil {
+			return
+		}
+
+		responder := c.server.requestRecord(req)
+		if responder == nil {
+			continue
+		}
+		action := responder(req)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.respond(req, action)
+		}()
+	}
+}
+
+// read header and body of request
+func (c *mockConn) readRequest(r io.Reader) (*Request, error) {
+	req := &Request{Conn: c.id}
+	if err := binary.Read(r, binary.BigEndian, &req.Header); err != nil {
+		return nil, err
+	}
+	if req.Header.MagicStr != remote.MAGIC_STR {
+		return nil, remote.ErrMagicStr
+	}
+	size := int(req.Header.MessageSize) - remote.HEADER_LEN
+	if size < 0 || req.Header.MessageSize > remote.MAX_MESSAGE_SIZE {
+		return nil, remote.ErrMessageSize
+	}
+
+	req.Body = make([]byte, size)
+	if _, err := io.ReadFull(r, req.Body); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// respond to request by action
+func (c *mockConn) respond(req *Request, action Action) {
+	if action.Delay > 0 {
+		select {
+		case <-time.After(action.Delay):
+		case <-c.server.done:
+			return
+		}
+	}
+
+	if action.Reset {
+		c.reset()
+		return
+	}
+	if action.Drop {
+		return
+	}
+
+	header := remote.Header{
+		MagicStr:    remote.MAGIC_STR,
+		MessageType: remote.MSG_TYPE_RESPONSE,
+		MessageSize: uint32(remote.HEADER_LEN + len(action.Body)),
+		Seq:         req.Header.Seq + action.SeqOffset,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, header)
+	buf.Write(action.Body)
+	data := buf.Bytes()
+
+	c.writing.Lock()
+	defer c.writing.Unlock()
+
+	if action.PartialWrite > 0 && action.PartialWrite < len(data) {
+		c.conn.Write(data[:action.PartialWrite])
+		c.reset()
+		return
+	}
+	c.conn.Write(data)
+}
+
+// close connection; for tcp, RST is sent instead of FIN
+func (c *mockConn) reset() {
+	if conn, ok := c.conn.(*net.TCPConn); ok {
+		conn.SetLinger(0)
+	}
+	c.conn.Close()
+}
@@ -0,0 +1,192 @@
+package remotetest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/remote"
+	"www.baidu.com/golang-lib/remote/test_pb"
+)
+
+func wafRequestNew() *test_pb.WafRequest {
+	service := "test"
+	return &test_pb.WafRequest{Service: &service}
+}
+
+func wafResponseBody() []byte {
+	code := test_pb.ResponseCode_OK
+	return Pb(&test_pb.WafResponse{Code: &code})
+}
+
+// dial to server, fail test if dial fails
+func dial(t *testing.T, s *Server) *remote.InternalClient {
+	client, err := remote.Dial(s.Network(), s.Addr(), time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	return client
+}
+
+// wait until f returns true
+func wait(f func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if f() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// test of scripted responses
+func TestScript(t *testing.T) {
+	for _, s := range []*Server{NewUnixServer(), NewTCPServer()} {
+		s.Handle(remote.MSG_TYPE_REQUEST, Script(
+			Action{Drop: true},
+			Respond(wafResponseBody()),
+		))
+		client := dial(t, s)
+
+		// first request dropped
+		err := client.Call(wafRequestNew(), new(test_pb.WafResponse), 50*time.Millisecond)
+		if err != remote.ErrTimeout {
+			t.Errorf("%s: err should be ErrTimeout, got %v", s.Network(), err)
+		}
+
+		// the last action is repeated
+		for i := 0; i < 2; i++ {
+			res := new(test_pb.WafResponse)
+			if err := client.Call(wafRequestNew(), res, time.Second); err != nil {
+				t.Fatalf("%s: Call(): %s", s.Network(), err.Error())
+			}
+			if res.GetCode() != test_pb.ResponseCode_OK {
+				t.Errorf("%s: unexpected response: %v", s.Network(), res)
+			}
+		}
+
+		requests := s.Requests()
+		if len(requests) != 3 || requests[0].Header.Seq == requests[1].Header.Seq {
+			t.Errorf("%s: unexpected requests: %v", s.Network(), requests)
+		}
+
+		client.Close()
+		s.Close()
+	}
+}
+
+// test of out of order responses, by delay
+func TestOutOfOrder(t *testing.T) {
+	s := NewUnixServer()
+	defer s.Close()
+	s.Handle(remote.MSG_TYPE_REQUEST, Script(
+		Action{Body: wafResponseBody(), Delay: 100 * time.Millisecond},
+		Respond(wafResponseBody()),
+	))
+	client := dial(t, s)
+	defer client.Close()
+
+	slow := client.Go(wafRequestNew(), new(test_pb.WafResponse), nil, remote.MSG_TYPE_REQUEST)
+	if !wait(func() bool { return s.RequestNum() == 1 }) {
+		t.Fatalf("request should be received")
+	}
+	fast := client.Go(wafRequestNew(), new(test_pb.WafResponse), nil, remote.MSG_TYPE_REQUEST)
+
+	select {
+	case <-fast.Done:
+	case <-slow.Done:
+		t.Fatalf("slow call should be done later")
+	}
+	<-slow.Done
+	if slow.Error != nil || fast.Error != nil {
+		t.Errorf("calls should succeed: %v, %v", slow.Error, fast.Error)
+	}
+}
+
+// test of response with unknown seq, pending call is removed on timeout
+func TestSeqOffset(t *testing.T) {
+	s := NewUnixServer()
+	defer s.Close()
+	s.Handle(remote.MSG_TYPE_REQUEST, Script(
+		Action{Body: wafResponseBody(), SeqOffset: 1000},
+		Respond(wafResponseBody()),
+	))
+	client := dial(t, s)
+	defer client.Close()
+
+	err := client.Call(wafRequestNew(), new(test_pb.WafResponse), 50*time.Millisecond)
+	if err != remote.ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+
+	// response with unknown seq is discarded, connection still works
+	if err := client.Call(wafRequestNew(), new(test_pb.WafResponse), time.Second); err != nil {
+		t.Errorf("Call(): %s", err.Error())
+	}
+}
+
+// test of partial write and reset, pending calls are terminated
+func TestConnFaults(t *testing.T) {
+	actions := []Action{
+		{Body: wafResponseBody(), PartialWrite: 10},
+		{Reset: true},
+	}
+	for _, action := range actions {
+		s := NewTCPServer()
+		s.Handle(remote.MSG_TYPE_REQUEST, Script(action))
+		client := dial(t, s)
+
+		err := client.Call(wafRequestNew(), new(test_pb.WafResponse), time.Second)
+		if err == nil || err == remote.ErrTimeout {
+			t.Errorf("call should fail with connection error, got %v", err)
+		}
+		if client.WaitClose() {
+			t.Errorf("client should not be closed by user")
+		}
+
+		client.Close()
+		s.Close()
+	}
+}
+
+// test of reconnect of remote.Client after connections reset
+func TestReconnect(t *testing.T) {
+	s := NewUnixServer()
+	defer s.Close()
+	var dropped int32
+	s.Handle(remote.MSG_TYPE_REQUEST, func(req *Request) Action {
+		if req.Conn == 0 {
+			atomic.AddInt32(&dropped, 1)
+			return Action{Reset: true}
+		}
+		return Respond(wafResponseBody())
+	})
+
+	conf := remote.DialConf{BaseInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond}
+	client := remote.NewClient(s.Network(), s.Addr(), time.Second, 1, nil, 100, remote.WithDial(conf))
+	defer client.Close()
+
+	// first connection is reset on request
+	if !wait(func() bool { return s.ConnNum() == 1 }) {
+		t.Fatalf("client should connect")
+	}
+	wait(func() bool {
+		return client.Call(wafRequestNew(), new(test_pb.WafResponse), time.Second) == nil
+	})
+	if n := atomic.LoadInt32(&dropped); n != 1 || s.ConnNum() != 2 {
+		t.Errorf("client should reconnect after reset, dropped %d, conns %d", n, s.ConnNum())
+	}
+
+	// all connections reset by server
+	s.ResetConns()
+	if !wait(func() bool { return s.ConnNum() == 3 }) {
+		t.Fatalf("client should reconnect after ResetConns()")
+	}
+	if !wait(func() bool {
+		return client.Call(wafRequestNew(), new(test_pb.WafResponse), time.Second) == nil
+	}) {
+		t.Errorf("Call() should succeed after reconnect")
+	}
+}
@@ -0,0 +1,233 @@
+/* retry.go - retry and hedged requests across backends for Client */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+If retry is enabled for Client, a failed call is sent again, until it
+succeeds, MaxAttempts is reached, or the budget of ctx is used up:
+- Only errors classified by Retryable are retried.
+- Each attempt is sent to a backend (address) not tried before. For
+  HashBalancer, the next backend on the hash ring is used. If no untried
+  backend is available, no more attempt is sent, and the call fails with
+  error of the last attempt.
+
+If HedgeDelay > 0, another attempt is sent if no response is received in
+HedgeDelay after the last attempt, and the first successful response is
+used. Hedged attempts are also counted in MaxAttempts.
+
+Note: requests may be processed more than once by backends, so retry and
+hedging should only be enabled for idempotent requests.
+
+Usage:
+    conf := RetryConf{
+        MaxAttempts:   3,
+        PerTryTimeout: 20 * time.Millisecond,
+        HedgeDelay:    10 * time.Millisecond,
+    }
+    client := NewClientByAddr("tcp", addrInfo, 1*time.Second, 8, nil, 100,
+        WithRetry(conf))
+
+    err := client.Call(request, response, 50*time.Millisecond)
+*/
+
+package remote
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"time"
+)
+
+// config of retry and hedging
+type RetryConf struct {
+	MaxAttempts   int                  // max attempts of a call, including the first one
+	PerTryTimeout time.Duration        // timeout of each attempt, 0 for the whole budget
+	HedgeDelay    time.Duration        // delay before hedged attempt, 0 for no hedging
+	Retryable     func(err error) bool // whether error is retryable, DefaultRetryable if nil
+}
+
+// result of an attempt
+type attemptResult struct {
+	res interface{} // response of the attempt
+	err error       // error of the attempt
+}
+
+// WithRetry enables retry and hedging for calls of Client
+func WithRetry(conf RetryConf) ClientOption {
+	return func(rec *Client) {
+		if conf.MaxAttempts <= 1 && conf.HedgeDelay <= 0 {
+			return
+		}
+		if conf.MaxAttempts < 1 {
+			conf.MaxAttempts = 1
+		}
+		if conf.Retryable == nil {
+			conf.Retryable = DefaultRetryable
+		}
+		rec.retryConf = &conf
+	}
+}
+
+/*
+DefaultRetryable - check whether error of call is retryable
+
+Connection errors and timeouts are retryable; errors of codec, balancer
+and context are not.
+
+Params:
+    - err: error of call
+
+Returns:
+    true if retryable
+*/
+func DefaultRetryable(err error) bool {
+	switch err {
+	case ErrTimeout, ErrShutdown, ErrFull, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// create a new response of the same type as res, for an attempt
+func responseNew(res interface{}) interface{} {
+	if res == nil {
+		return nil
+	}
+	return reflect.New(reflect.TypeOf(res).Elem()).Interface()
+}
+
+// copy response of attempt to res given by caller
+func responseCopy(dst interface{}, src interface{}) {
+	if dst == nil || dst == src {
+		return
+	}
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+}
+
+// check whether separate response is needed for each attempt
+func responseSeparate(res interface{}) bool {
+	return res != nil && reflect.TypeOf(res).Kind() == reflect.Ptr
+}
+
+/*
+callRetry - send call with retry and hedging
+
+Params:
+    - ctx: context for budget of all attempts
+    - key: key for balancer
+    - req: request message
+    - res: response message
+
+Returns:
+    error of the last attempt
+*/
+func (rec *Client) callRetry(ctx context.Context, key string, req interface{},
+	res interface{}) error {
+	conf := rec.retryConf
+
+	// each attempt uses its own response, since response of a timeout attempt
+	// may still be written by InternalClient.input()
+	separate := responseSeparate(res)
+
+	// hedging is possible only if response can be duplicated
+	hedging := conf.HedgeDelay > 0 && (res == nil || separate)
+
+	// pending attempts are cancelled on return
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, conf.MaxAttempts)
+	tried := make(map[string]bool)
+	maxAttempts := conf.MaxAttempts
+	attempts := 0
+	pending := 0
+
+	// send a new attempt to a backend not tried
+	attemptStart := func() error {
+		client, err := rec.balanceExclude(key, tried, true)
+		if err != nil {
+			return err
+		}
+		tried[client.Address] = true
+		attempts++
+		pending++
+
+		attemptRes := res
+		if separate {
+			attemptRes = responseNew(res)
+		}
+		go func() {
+			attemptCtx := ctx
+			if conf.PerTryTimeout > 0 {
+				var attemptCancel context.CancelFunc
+				attemptCtx, attemptCancel = context.WithTimeout(ctx, conf.PerTryTimeout)
+				defer attemptCancel()
+			}
+			err := rec.callClient(attemptCtx, client, req, attemptRes)
+			results <- attemptResult{attemptRes, err}
+		}()
+		return nil
+	}
+
+	if err := attemptStart(); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for pending > 0 {
+		// timer for hedged attempt
+		var hedgeTimer *time.Timer
+		var hedgeC <-chan time.Time
+		if hedging && attempts < maxAttempts {
+			hedgeTimer = time.NewTimer(conf.HedgeDelay)
+			hedgeC = hedgeTimer.C
+		}
+
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				responseCopy(res, result.res)
+				return nil
+			}
+			lastErr = result.err
+
+			// no more attempts, but wait for pending ones
+			if !conf.Retryable(lastErr) {
+				maxAttempts = attempts
+			}
+			if ctx.Err() == nil && attempts < maxAttempts && pending == 0 {
+				if err := attemptStart(); err != nil {
+					return lastErr
+				}
+			}
+
+		case <-hedgeC:
+			// no untried backend, stop hedging and wait for pending attempts
+			if err := attemptStart(); err != nil {
+				maxAttempts = attempts
+			}
+
+		case <-ctx.Done():
+			if hedgeTimer != nil {
+				hedgeTimer.Stop()
+			}
+			return contextErrConvert(ctx.Err())
+		}
+
+		if hedgeTimer != nil {
+			hedgeTimer.Stop()
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,223 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/remote/test_pb"
+)
+
+// handler for test: respond after delay, or no response if drop is set
+type delayHandler struct {
+	delay    time.Duration
+	drop     bool
+	received int32
+}
+
+func (h *delayHandler) NewRequest() interface{} {
+	return new(test_pb.WafRequest)
+}
+
+func (h *delayHandler) Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error) {
+	atomic.AddInt32(&h.received, 1)
+	if h.drop {
+		return nil, errors.New("dropped")
+	}
+
+	select {
+	case <-time.After(h.delay):
+	case <-ctx.Done():
+	}
+	code := test_pb.ResponseCode_OK
+	return &test_pb.WafResponse{Code: &code}, nil
+}
+
+// start servers with given handlers, and create client to them
+func prepareRetryClient(t *testing.T, handlers []Handler, opts ...ClientOption) (*Client, []string, func()) {
+	dir, err := ioutil.TempDir("", "remote_retry")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+
+	servers := make([]*Server, 0)
+	paths := make([]string, 0)
+	addrInfo := make(map[string]int32)
+	for i, handler := range handlers {
+		path := filepath.Join(dir, string(rune('a'+i))+".sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("Listen(): %s", err.Error())
+		}
+		server := NewServer(nil)
+		server.Handle(MSG_TYPE_REQUEST, handler)
+		go server.Serve(l)
+
+		servers = append(servers, server)
+		paths = append(paths, path)
+		addrInfo[path] = 1
+	}
+
+	client := NewClientByAddr("unix", addrInfo, time.Second, 1, nil, 100, opts...)
+
+	// wait until all connected
+	for i := 0; i < 100; i++ {
+		connected := 0
+		for _, sclient := range client.clients {
+			if atomic.LoadInt32(&sclient.Status) == CONNECTED {
+				connected++
+			}
+		}
+		if connected == len(client.clients) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return client, paths, func() {
+		client.Close()
+		for _, server := range servers {
+			server.Close()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+// test of DefaultRetryable
+func TestDefaultRetryable(t *testing.T) {
+	retryable := []error{ErrTimeout, ErrShutdown, ErrFull, io.EOF, io.ErrUnexpectedEOF,
+		&net.OpError{Op: "read", Err: errors.New("reset")}}
+	for _, err := range retryable {
+		if !DefaultRetryable(err) {
+			t.Errorf("%v should be retryable", err)
+		}
+	}
+
+	notRetryable := []error{nil, context.Canceled, ErrCodecType, ErrAllBroken,
+		errors.New("reading body")}
+	for _, err := range notRetryable {
+		if DefaultRetryable(err) {
+			t.Errorf("%v should not be retryable", err)
+		}
+	}
+}
+
+// test of retry, on a different backend
+func TestCallRetry(t *testing.T) {
+	drop := &delayHandler{drop: true}
+	good := &delayHandler{}
+	conf := RetryConf{MaxAttempts: 2, PerTryTimeout: 30 * time.Millisecond}
+	client, _, cleanup := prepareRetryClient(t, []Handler{drop, good}, WithRetry(conf))
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		res := new(test_pb.WafResponse)
+		if err := client.Call(wafRequestNew("test"), res, time.Second); err != nil {
+			t.Fatalf("Call() should succeed with retry: %s", err.Error())
+		}
+		if res.Code == nil {
+			t.Errorf("response should be set")
+		}
+	}
+
+	if atomic.LoadInt32(&good.received) != 4 {
+		t.Errorf("all calls should be sent to good backend, got %d", atomic.LoadInt32(&good.received))
+	}
+	if atomic.LoadInt32(&drop.received) == 0 {
+		t.Errorf("calls should be sent to drop backend first")
+	}
+}
+
+// test of retry, with error not retryable or budget used up
+func TestCallRetryStop(t *testing.T) {
+	drop1 := &delayHandler{drop: true}
+	drop2 := &delayHandler{drop: true}
+	conf := RetryConf{
+		MaxAttempts:   2,
+		PerTryTimeout: 20 * time.Millisecond,
+		Retryable:     func(err error) bool { return false },
+	}
+	client, _, cleanup := prepareRetryClient(t, []Handler{drop1, drop2}, WithRetry(conf))
+	defer cleanup()
+
+	if err := client.Call(wafRequestNew("test"), new(test_pb.WafResponse), time.Second); err != ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+	if atomic.LoadInt32(&drop1.received)+atomic.LoadInt32(&drop2.received) != 1 {
+		t.Errorf("call should not be retried")
+	}
+
+	// retry does not overrun the budget
+	client.retryConf.Retryable = DefaultRetryable
+	start := time.Now()
+	if err := client.Call(wafRequestNew("test"), new(test_pb.WafResponse), 30*time.Millisecond); err != ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Errorf("call should stop in budget, cost %v", time.Since(start))
+	}
+}
+
+// test of hedged requests
+func TestCallHedge(t *testing.T) {
+	slow := &delayHandler{delay: 500 * time.Millisecond}
+	fast := &delayHandler{}
+	conf := RetryConf{MaxAttempts: 2, HedgeDelay: 10 * time.Millisecond}
+	client, _, cleanup := prepareRetryClient(t, []Handler{slow, fast}, WithRetry(conf))
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		res := new(test_pb.WafResponse)
+		if err := client.Call(wafRequestNew("test"), res, 200*time.Millisecond); err != nil {
+			t.Fatalf("Call() should succeed with hedging: %s", err.Error())
+		}
+		if res.Code == nil {
+			t.Errorf("response should be set")
+		}
+		if time.Since(start) > 150*time.Millisecond {
+			t.Errorf("hedged call should return soon, cost %v", time.Since(start))
+		}
+	}
+}
+
+// test of retry and hedging, with no untried backend
+func TestCallRetryNoUntried(t *testing.T) {
+	drop := &delayHandler{drop: true}
+	conf := RetryConf{MaxAttempts: 3, PerTryTimeout: 20 * time.Millisecond}
+	client, _, cleanup := prepareRetryClient(t, []Handler{drop}, WithRetry(conf))
+	defer cleanup()
+
+	if err := client.Call(wafRequestNew("test"), new(test_pb.WafResponse), time.Second); err != ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+	if atomic.LoadInt32(&drop.received) != 1 {
+		t.Errorf("call should not be retried on tried backend, got %d", atomic.LoadInt32(&drop.received))
+	}
+
+	// hedging stops, and the pending attempt is used
+	slow := &delayHandler{delay: 50 * time.Millisecond}
+	conf = RetryConf{MaxAttempts: 3, HedgeDelay: 10 * time.Millisecond}
+	client, _, cleanup = prepareRetryClient(t, []Handler{slow}, WithRetry(conf))
+	defer cleanup()
+
+	res := new(test_pb.WafResponse)
+	if err := client.Call(wafRequestNew("test"), res, time.Second); err != nil {
+		t.Fatalf("Call(): %s", err.Error())
+	}
+	if res.Code == nil {
+		t.Errorf("response should be set")
+	}
+	if atomic.LoadInt32(&slow.received) != 1 {
+		t.Errorf("call should not be hedged on tried backend, got %d", atomic.LoadInt32(&slow.received))
+	}
+}
@@ -0,0 +1,475 @@
+/* server.go - server side of remote protocol, process requests by ServerCodec */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+Server reads requests from connections by ServerCodec, dispatches each
+request to the handler registered for its message type, and writes the
+response back with the same Seq.
+
+- Requests on a connection are processed concurrently, at most
+  concurrency requests at the same time.
+- No response is written for MSG_TYPE_REQUEST_NO_RESPONSE, or if the
+  handler returns error.
+- Shutdown() stops accepting new connections, waits for requests in process
+  to finish, and then closes all connections.
+
+server example:
+    type echoHandler struct{}
+
+    func (h echoHandler) NewRequest() interface{} {
+        return new(pb.EchoRequest)
+    }
+
+    func (h echoHandler) Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error) {
+        res := new(pb.EchoResponse)
+        res.Msg = req.(*pb.EchoRequest).Msg
+        return res, nil
+    }
+
+    // NewServer(fn), if fn is nil, pbcodec is used as default
+    server := NewServer(nil)
+    server.Handle(MSG_TYPE_REQUEST, echoHandler{})
+    go server.ListenAndServe("unix", "/tmp/echo.sock")
+
+    // graceful shutdown, wait for 5 seconds at most
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    server.Shutdown(ctx)
+*/
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/log"
+	"www.baidu.com/golang-lib/module_state2"
+)
+
+// default max number of requests in process for each connection
+const DEFAULT_SERVER_CONCURRENCY = 64
+
+// interval for checking connections in Shutdown()
+const SHUTDOWN_POLL_INTERVAL = 10 * time.Millisecond
+
+var ErrServerClosed = errors.New("remote: server closed")
+
+// counters of server
+var serverCounterKeys = []string{
+	"SERVER_CONN_ACCEPT",   // connections accepted
+	"SERVER_CONN_CLOSE",    // connections closed
+	"SERVER_ACCEPT_ERR",    // errors in accept
+	"SERVER_REQ_TOTAL",     // requests received
+	"SERVER_REQ_UNKNOWN",   // requests with unknown message type
+	"SERVER_REQ_READ_ERR",  // errors in reading request
+	"SERVER_REQ_SERVE_ERR", // errors returned by handler
+	"SERVER_REQ_PANIC",     // panics in handler
+	"SERVER_RES_WRITE_ERR", // errors in writing response
+}
+
+// Handler processes requests of a message type
+type Handler interface {
+	// NewRequest creates message for decoding request body
+	NewRequest() interface{}
+
+	// Serve processes request, and returns response
+	// ctx is cancelled when the connection is closed. Response is ignored
+	// for MSG_TYPE_REQUEST_NO_RESPONSE.
+	Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error)
+}
+
+// connection of server
+type serverConn struct {
+	codec  ServerCodec
+	active int32 // number of requests in process
+	closed int32 // whether codec is closed
+}
+
+// close codec of the connection, only once
+func (c *serverConn) close() {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.codec.Close()
+	}
+}
+
+type Server struct {
+	fn          fnCreateServerCodec // function to create codec
+	concurrency int                 // max requests in process for each connection
+
+	lock       sync.Mutex
+	handlers   map[uint16]Handler    // handler for each message type
+	listeners  map[net.Listener]bool // listeners
+	conns      map[*serverConn]bool  // connections
+	inShutdown bool                  // Shutdown() or Close() called
+
+	state module_state2.State // state of server
+}
+
+/* NewServer - create a server
+ *
+ * Params:
+ *     - fn: function to create codec (pbcodec default)
+ *
+ * Return:
+ *     - server
+ */
+func NewServer(fn fnCreateServerCodec) *Server {
+	if fn == nil {
+		fn = DefaultCreateServerCodec
+	}
+
+	s := new(Server)
+	s.fn = fn
+	s.concurrency = DEFAULT_SERVER_CONCURRENCY
+	s.handlers = make(map[uint16]Handler)
+	s.listeners = make(map[net.Listener]bool)
+	s.conns = make(map[*serverConn]bool)
+	s.state.Init()
+	s.state.CountersInit(serverCounterKeys)
+	return s
+}
+
+// Handle registers handler for given message type
+func (s *Server) Handle(msgType uint16, handler Handler) {
+	s.lock.Lock()
+	s.handlers[msgType] = handler
+	s.lock.Unlock()
+}
+
+// SetConcurrency sets max requests in process for each connection
+func (s *Server) SetConcurrency(concurrency int) {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_SERVER_CONCURRENCY
+	}
+
+	s.lock.Lock()
+	s.concurrency = concurrency
+	s.lock.Unlock()
+}
+
+// StateGet returns state of server
+func (s *Server) StateGet() *module_state2.State {
+	return &s.state
+}
+
+/* ListenAndServe - listen on address and serve connections
+ *
+ * Params:
+ *     - network: "tcp", "tcp4", "tcp6" or "unix"
+ *     - address: address to listen, e.g., ":8080" or "/tmp/echo.sock"
+ *
+ * Return:
+ *     - error: ErrServerClosed after Shutdown() or Close()
+ */
+func (s *Server) ListenAndServe(network, address string) error {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+/* Serve - accept connections on listener and serve them
+ *
+ * Params:
+ *     - l: listener
+ *
+ * Return:
+ *     - error: ErrServerClosed after Shutdown() or Close()
+ */
+func (s *Server) Serve(l net.Listener) error {
+	if !s.listenerAdd(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.listenerRemove(l)
+
+	var delay time.Duration // delay on temporary accept error
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+
+			s.state.Inc("SERVER_ACCEPT_ERR", 1)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				log.Logger.Warn("remote: accept error: %s; retrying in %v", err.Error(), delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		s.state.Inc("SERVER_CONN_ACCEPT", 1)
+		go s.ServeConn(conn)
+	}
+}
+
+/* ServeConn - serve requests on a connection, until the connection is closed
+ *
+ * Params:
+ *     - conn: connection
+ */
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	c := &serverConn{codec: s.fn(conn)}
+	if !s.connAdd(c) {
+		c.close()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	s.lock.Lock()
+	sem := make(chan bool, s.concurrency)
+	s.lock.Unlock()
+
+	for {
+		header, req, handler, err := s.requestRead(c)
+		if err != nil {
+			break
+		}
+		if handler == nil {
+			atomic.AddInt32(&c.active, -1)
+			continue
+		}
+
+		// limit requests in process
+		sem <- true
+		wg.Add(1)
+		go func() {
+			s.requestServe(ctx, c, header, req, handler)
+			atomic.AddInt32(&c.active, -1)
+			<-sem
+			wg.Done()
+		}()
+	}
+
+	// connection is closed, notify requests in process and wait for them
+	cancel()
+	wg.Wait()
+	c.close()
+	s.connRemove(c)
+	s.state.Inc("SERVER_CONN_CLOSE", 1)
+}
+
+/* requestRead - read a request from connection
+ *
+ * Params:
+ *     - c: connection
+ *
+ * Return:
+ *     - (header, req, handler, error)
+ *       handler is nil if no handler for the message type
+ *       c.active is increased, unless error is returned
+ */
+func (s *Server) requestRead(c *serverConn) (*Header, interface{}, Handler, error) {
+	header := new(Header)
+	if err := c.codec.ReadRequestHeader(header); err != nil {
+		if err != io.EOF && atomic.LoadInt32(&c.closed) == 0 {
+			s.state.Inc("SERVER_REQ_READ_ERR", 1)
+			log.Logger.Debug("remote: read request header: %s", err.Error())
+		}
+		return nil, nil, nil, err
+	}
+	s.state.Inc("SERVER_REQ_TOTAL", 1)
+
+	// connection is not idle from now on
+	atomic.AddInt32(&c.active, 1)
+
+	s.lock.Lock()
+	handler := s.handlers[header.MessageType]
+	s.lock.Unlock()
+
+	// discard body of unknown message type
+	if handler == nil {
+		s.state.Inc("SERVER_REQ_UNKNOWN", 1)
+		if err := c.codec.ReadRequestBody(nil); err != nil {
+			s.state.Inc("SERVER_REQ_READ_ERR", 1)
+			atomic.AddInt32(&c.active, -1)
+			return nil, nil, nil, err
+		}
+		return header, nil, nil, nil
+	}
+
+	req := handler.NewRequest()
+	if err := c.codec.ReadRequestBody(req); err != nil {
+		s.state.Inc("SERVER_REQ_READ_ERR", 1)
+		log.Logger.Debug("remote: read request body: %s", err.Error())
+		atomic.AddInt32(&c.active, -1)
+		return nil, nil, nil, err
+	}
+
+	return header, req, handler, nil
+}
+
+// process request by handler, and write response
+func (s *Server) requestServe(ctx context.Context, c *serverConn, header *Header,
+	req interface{}, handler Handler) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.state.Inc("SERVER_REQ_PANIC", 1)
+			log.Logger.Warn("remote: panic in handler for type %d: %v", header.MessageType, err)
+		}
+	}()
+
+	res, err := handler.Serve(ctx, header, req)
+	if err != nil {
+		s.state.Inc("SERVER_REQ_SERVE_ERR", 1)
+		log.Logger.Debug("remote: serve request of type %d: %s", header.MessageType, err.Error())
+		return
+	}
+	if header.MessageType == MSG_TYPE_REQUEST_NO_RESPONSE {
+		return
+	}
+
+	resHeader := Header{
+		MagicStr:    MAGIC_STR,
+		MessageType: MSG_TYPE_RESPONSE,
+		Seq:         header.Seq,
+	}
+	if err := c.codec.WriteResponse(&resHeader, res); err != nil {
+		s.state.Inc("SERVER_RES_WRITE_ERR", 1)
+		log.Logger.Debug("remote: write response: %s", err.Error())
+	}
+}
+
+/* Shutdown - gracefully shutdown the server
+ *
+ * Listeners are closed at first, then idle connections are closed as soon as
+ * all requests in process on them are finished.
+ *
+ * Params:
+ *     - ctx: if ctx is done before all connections are closed, the remaining
+ *            connections are closed, and ctx.Err() is returned
+ *
+ * Return:
+ *     - error
+ */
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	s.inShutdown = true
+	s.listenersClose()
+	s.lock.Unlock()
+
+	ticker := time.NewTicker(SHUTDOWN_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if s.idleConnsClose() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.connsClose()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes all listeners and connections immediately
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.inShutdown = true
+	s.listenersClose()
+	s.lock.Unlock()
+
+	s.connsClose()
+	return nil
+}
+
+// check whether Shutdown() or Close() is called
+func (s *Server) shuttingDown() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.inShutdown
+}
+
+// add listener, return false if server is shutting down
+func (s *Server) listenerAdd(l net.Listener) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.inShutdown {
+		return false
+	}
+	s.listeners[l] = true
+	return true
+}
+
+func (s *Server) listenerRemove(l net.Listener) {
+	s.lock.Lock()
+	delete(s.listeners, l)
+	s.lock.Unlock()
+}
+
+// close all listeners, with lock held
+func (s *Server) listenersClose() {
+	for l := range s.listeners {
+		l.Close()
+	}
+}
+
+// add connection, return false if server is shutting down
+func (s *Server) connAdd(c *serverConn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.inShutdown {
+		return false
+	}
+	s.conns[c] = true
+	return true
+}
+
+func (s *Server) connRemove(c *serverConn) {
+	s.lock.Lock()
+	delete(s.conns, c)
+	s.lock.Unlock()
+}
+
+// close connections without requests in process, return true if no connection left
+func (s *Server) idleConnsClose() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for c := range s.conns {
+		if atomic.LoadInt32(&c.active) == 0 {
+			c.close()
+			delete(s.conns, c)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// close all connections
+func (s *Server) connsClose() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for c := range s.conns {
+		c.close()
+		delete(s.conns, c)
+	}
+}
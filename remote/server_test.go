@@ -0,0 +1,277 @@
+package remote
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/remote/test_pb"
+)
+
+// handler for test: FORBIDDEN for service "bad", and sleep for service "slow"
+type wafHandler struct {
+	received chan string
+}
+
+func (h *wafHandler) NewRequest() interface{} {
+	return new(test_pb.WafRequest)
+}
+
+func (h *wafHandler) Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error) {
+	service := req.(*test_pb.WafRequest).GetService()
+	if h.received != nil {
+		h.received <- service
+	}
+
+	code := test_pb.ResponseCode_OK
+	switch service {
+	case "bad":
+		code = test_pb.ResponseCode_FORBIDDEN
+	case "slow":
+		time.Sleep(100 * time.Millisecond)
+	case "panic":
+		panic("test")
+	}
+
+	res := new(test_pb.WafResponse)
+	res.Code = &code
+	return res, nil
+}
+
+func wafRequestNew(service string) *test_pb.WafRequest {
+	req := new(test_pb.WafRequest)
+	req.Service = &service
+	return req
+}
+
+// start server on unix socket in temp dir
+func prepareServer(t *testing.T, handler Handler) (*Server, string, func()) {
+	dir, err := ioutil.TempDir("", "remote_server")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	path := filepath.Join(dir, "server.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen(): %s", err.Error())
+	}
+
+	server := NewServer(nil)
+	server.Handle(MSG_TYPE_REQUEST, handler)
+	server.Handle(MSG_TYPE_REQUEST_NO_RESPONSE, handler)
+	go server.Serve(l)
+
+	return server, path, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// test of Server, with Dial() and Call()
+func TestServer_1(t *testing.T) {
+	server, path, cleanup := prepareServer(t, new(wafHandler))
+	defer cleanup()
+
+	client, err := Dial("unix", path, time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	defer client.Close()
+
+	res := new(test_pb.WafResponse)
+	if err := client.Call(wafRequestNew("good"), res, time.Second); err != nil {
+		t.Fatalf("Call(): %s", err.Error())
+	}
+	if res.GetCode() != test_pb.ResponseCode_OK {
+		t.Errorf("code should be OK, got %v", res.GetCode())
+	}
+
+	res = new(test_pb.WafResponse)
+	if err := client.Call(wafRequestNew("bad"), res, time.Second); err != nil {
+		t.Fatalf("Call(): %s", err.Error())
+	}
+	if res.GetCode() != test_pb.ResponseCode_FORBIDDEN {
+		t.Errorf("code should be FORBIDDEN, got %v", res.GetCode())
+	}
+
+	// panic in handler, no response
+	if err := client.Call(wafRequestNew("panic"), res, 50*time.Millisecond); err != ErrTimeout {
+		t.Errorf("err should be ErrTimeout, got %v", err)
+	}
+
+	// unknown message type, no response
+	call := client.Go(wafRequestNew("good"), res, nil, 100)
+	select {
+	case <-call.Done:
+		t.Errorf("no response should be sent for unknown message type")
+	case <-time.After(50 * time.Millisecond):
+		client.RemovePendingOnCall(call)
+	}
+
+	counters := server.StateGet().GetCounters()
+	if counters["SERVER_REQ_TOTAL"] != 4 || counters["SERVER_REQ_PANIC"] != 1 ||
+		counters["SERVER_REQ_UNKNOWN"] != 1 {
+		t.Errorf("unexpected counters: %v", counters)
+	}
+}
+
+// test of Server, concurrent requests
+func TestServer_2(t *testing.T) {
+	_, path, cleanup := prepareServer(t, new(wafHandler))
+	defer cleanup()
+
+	client, err := Dial("unix", path, time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	defer client.Close()
+
+	// 10 slow requests are processed concurrently
+	start := time.Now()
+	calls := make([]*Call, 10)
+	for i := range calls {
+		calls[i] = client.Go(wafRequestNew("slow"), new(test_pb.WafResponse), nil, MSG_TYPE_REQUEST)
+	}
+	for _, call := range calls {
+		<-call.Done
+		if call.Error != nil {
+			t.Errorf("call error: %s", call.Error.Error())
+		}
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("requests should be processed concurrently, cost %v", time.Since(start))
+	}
+}
+
+// test of Server, request without response
+func TestServer_3(t *testing.T) {
+	handler := &wafHandler{received: make(chan string, 1)}
+	_, path, cleanup := prepareServer(t, handler)
+	defer cleanup()
+
+	client, err := Dial("unix", path, time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	defer client.Close()
+
+	call := client.Go(wafRequestNew("oneway"), nil, nil, MSG_TYPE_REQUEST_NO_RESPONSE)
+	client.RemovePendingOnCall(call)
+
+	select {
+	case service := <-handler.received:
+		if service != "oneway" {
+			t.Errorf("service should be oneway, got %s", service)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("request should be received")
+	}
+}
+
+// handler for test: block until ctx is cancelled
+type ctxHandler struct {
+	started chan bool
+	done    chan bool
+}
+
+func (h *ctxHandler) NewRequest() interface{} {
+	return new(test_pb.WafRequest)
+}
+
+func (h *ctxHandler) Serve(ctx context.Context, header *Header, req interface{}) (interface{}, error) {
+	h.started <- true
+	<-ctx.Done()
+	h.done <- true
+	return nil, ctx.Err()
+}
+
+// test of Server, ctx of handler is cancelled when connection is closed by peer
+func TestServerConnClose(t *testing.T) {
+	handler := &ctxHandler{started: make(chan bool, 1), done: make(chan bool, 1)}
+	server, path, cleanup := prepareServer(t, handler)
+	defer cleanup()
+
+	client, err := Dial("unix", path, time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	client.Go(wafRequestNew("good"), new(test_pb.WafResponse), nil, MSG_TYPE_REQUEST)
+	<-handler.started
+	client.Close()
+
+	select {
+	case <-handler.done:
+	case <-time.After(time.Second):
+		t.Fatalf("ctx of handler should be cancelled")
+	}
+	for i := 0; i < 100 && server.StateGet().GetCounters()["SERVER_CONN_CLOSE"] != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.StateGet().GetCounters()["SERVER_CONN_CLOSE"] != 1 {
+		t.Errorf("connection should be closed")
+	}
+}
+
+// test of Server.Shutdown, requests in process are finished
+func TestServerShutdown(t *testing.T) {
+	handler := &wafHandler{received: make(chan string, 1)}
+	server, path, cleanup := prepareServer(t, handler)
+	defer cleanup()
+
+	client, err := Dial("unix", path, time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	defer client.Close()
+
+	call := client.Go(wafRequestNew("slow"), new(test_pb.WafResponse), nil, MSG_TYPE_REQUEST)
+	<-handler.received
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown(): %s", err.Error())
+	}
+
+	<-call.Done
+	if call.Error != nil {
+		t.Errorf("request in process should be finished: %s", call.Error.Error())
+	}
+
+	// new connection is refused
+	if _, err := Dial("unix", path, time.Second, nil, 100); err == nil {
+		t.Errorf("Dial() should fail after Shutdown()")
+	}
+	if err := server.ListenAndServe("unix", path+".new"); err != ErrServerClosed {
+		t.Errorf("ListenAndServe() should return ErrServerClosed, got %v", err)
+	}
+}
+
+// test of Server.Shutdown, ctx done before requests finished
+func TestServerShutdownTimeout(t *testing.T) {
+	handler := &wafHandler{received: make(chan string, 1)}
+	server, path, cleanup := prepareServer(t, handler)
+	defer cleanup()
+
+	client, err := Dial("unix", path, time.Second, nil, 100)
+	if err != nil {
+		t.Fatalf("Dial(): %s", err.Error())
+	}
+	defer client.Close()
+
+	client.Go(wafRequestNew("slow"), new(test_pb.WafResponse), nil, MSG_TYPE_REQUEST)
+	<-handler.received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() should return DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+/* stats.go - request and latency statistics of Client, per backend and aggregate */
+/*
+modification history
+--------------------
+2026/10/18, by agent, create
+*/
+/*
+DESCRIPTION
+If enabled by WithStats(), Client keeps statistics of calls (Call, CallByKey
+and CallContext):
+- aggregate: one record for each call, including all retries
+- per backend: one record for each attempt sent to the backend address
+
+Counters (in StatsGet() and StatsDiffGet()):
+- CALL_SUCC, CALL_TIMEOUT, CALL_ERR, CALL_CANCEL      : aggregate
+- CALL_SUCC_<addr>, CALL_TIMEOUT_<addr>, CALL_ERR_<addr>,
+  CALL_CANCEL_<addr>                                  : per backend
+
+CALL_CANCEL counts calls cancelled by caller, and attempts cancelled after
+another attempt of the same call succeeded (hedged requests), they are not
+errors of backend. Delays of cancelled calls are not recorded.
+
+Counters and delays of a backend are deleted when its address is removed
+by Update().
+
+Usage:
+    client := NewClientByAddr("tcp", addrInfo, 1*time.Second, 8, nil, 100,
+        WithStats(DefaultStatsConf()))
+
+    // register handlers to monitor server:
+    //   <prefix>_state, <prefix>_state_diff, <prefix>_delay, <prefix>_backend_delay
+    err := client.MonitorHandlersRegister(monitorServer, "waf_client")
+*/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/delay_counter"
+	"www.baidu.com/golang-lib/module_state2"
+	"www.baidu.com/golang-lib/web_monitor"
+)
+
+// counter keys of call statistics
+const (
+	CALL_SUCC    = "CALL_SUCC"
+	CALL_TIMEOUT = "CALL_TIMEOUT"
+	CALL_ERR     = "CALL_ERR"
+	CALL_CANCEL  = "CALL_CANCEL"
+)
+
+// counter keys of call statistics, for each backend with suffix of address
+var callCounterKeys = []string{CALL_SUCC, CALL_TIMEOUT, CALL_ERR, CALL_CANCEL}
+
+var ErrStatsDisabled = errors.New("remote: stats not enabled")
+
+// config for call statistics
+type StatsConf struct {
+	Interval      int    // interval (in second) for DelayRecent and CounterDiff
+	BucketSize    int    // size of delay bucket, in ms
+	BucketNum     int    // number of delay bucket
+	NoahKeyPrefix string // prefix of noah key, may be empty
+}
+
+// DefaultStatsConf returns default config for call statistics
+func DefaultStatsConf() StatsConf {
+	return StatsConf{
+		Interval:   20,
+		BucketSize: 1,
+		BucketNum:  10,
+	}
+}
+
+// WithStats enables call statistics of Client
+func WithStats(conf StatsConf) ClientOption {
+	return func(rec *Client) {
+		defaultConf := DefaultStatsConf()
+		if conf.Interval <= 0 {
+			conf.Interval = defaultConf.Interval
+		}
+		if conf.BucketSize <= 0 {
+			conf.BucketSize = defaultConf.BucketSize
+		}
+		if conf.BucketNum <= 0 {
+			conf.BucketNum = defaultConf.BucketNum
+		}
+		rec.stats = newClientStats(conf)
+	}
+}
+
+// statistics of calls
+type clientStats struct {
+	conf StatsConf
+
+	state module_state2.State        // counters of calls
+	slice module_state2.CounterSlice // diff of counters in last interval
+	delay delay_counter.DelayRecent  // aggregate delay
+
+	lock          sync.Mutex                            // protect backendDelays
+	backendDelays map[string]*delay_counter.DelayRecent // delay of each backend address
+}
+
+func newClientStats(conf StatsConf) *clientStats {
+	s := new(clientStats)
+	s.conf = conf
+
+	s.state.Init()
+	s.state.CountersInit(callCounterKeys)
+	s.state.SetNoahKeyPrefix(conf.NoahKeyPrefix)
+	s.slice.SetNoahKeyPrefix(conf.NoahKeyPrefix)
+	s.slice.Init(&s.state, conf.Interval)
+
+	s.delay.Init(conf.Interval, conf.BucketSize, conf.BucketNum)
+	s.delay.SetNoahKeyPrefix(s.keyPrefixGen("delay"))
+
+	s.backendDelays = make(map[string]*delay_counter.DelayRecent)
+	return s
+}
+
+// generate noah key prefix with NoahKeyPrefix of conf
+func (s *clientStats) keyPrefixGen(key string) string {
+	if s.conf.NoahKeyPrefix == "" {
+		return key
+	}
+	return fmt.Sprintf("%s_%s", s.conf.NoahKeyPrefix, key)
+}
+
+// get counter key for result of call
+func callCounterKey(err error) string {
+	switch err {
+	case nil:
+		return CALL_SUCC
+	case ErrTimeout:
+		return CALL_TIMEOUT
+	case context.Canceled:
+		return CALL_CANCEL
+	default:
+		return CALL_ERR
+	}
+}
+
+// record result of a call; s may be nil
+func (s *clientStats) callRecord(start time.Time, err error) {
+	if s == nil {
+		return
+	}
+
+	key := callCounterKey(err)
+	s.state.Inc(key, 1)
+	if key != CALL_CANCEL {
+		s.delay.AddBySub(start, time.Now())
+	}
+}
+
+// record result of an attempt sent to backend address; s may be nil
+func (s *clientStats) backendRecord(address string, start time.Time, err error) {
+	if s == nil {
+		return
+	}
+
+	key := callCounterKey(err)
+	s.state.Inc(backendCounterKey(key, address), 1)
+	delay := s.backendDelayGet(address, true)
+	if key != CALL_CANCEL {
+		delay.AddBySub(start, time.Now())
+	}
+}
+
+// get counter key for backend address
+func backendCounterKey(key string, address string) string {
+	return fmt.Sprintf("%s_%s", key, address)
+}
+
+// get DelayRecent of backend, create it if not exist and create is true
+func (s *clientStats) backendDelayGet(address string, create bool) *delay_counter.DelayRecent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delay, ok := s.backendDelays[address]
+	if !ok && create {
+		delay = new(delay_counter.DelayRecent)
+		delay.Init(s.conf.Interval, s.conf.BucketSize, s.conf.BucketNum)
+		delay.SetNoahKeyPrefix(s.keyPrefixGen("delay_" + address))
+		s.backendDelays[address] = delay
+	}
+	return delay
+}
+
+// delete counters and delay of backend, for address removed from Client; s may be nil
+func (s *clientStats) backendDelete(address string) {
+	if s == nil {
+		return
+	}
+
+	for _, key := range callCounterKeys {
+		s.state.CounterDelete(backendCounterKey(key, address))
+	}
+
+	s.lock.Lock()
+	delete(s.backendDelays, address)
+	s.lock.Unlock()
+}
+
+// get addresses of backends, in order
+func (s *clientStats) backendAddresses() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	addresses := make([]string, 0, len(s.backendDelays))
+	for address := range s.backendDelays {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// StatsGet returns counters of calls, nil if stats not enabled
+func (rec *Client) StatsGet() *module_state2.StateData {
+	if rec.stats == nil {
+		return nil
+	}
+	return rec.stats.state.GetAll()
+}
+
+// StatsDiffGet returns diff of call counters in last interval, nil if stats not enabled
+func (rec *Client) StatsDiffGet() *module_state2.CounterDiff {
+	if rec.stats == nil {
+		return nil
+	}
+	diff := rec.stats.slice.Get()
+	return &diff
+}
+
+// DelayGet returns aggregate delay of calls, nil if stats not enabled
+func (rec *Client) DelayGet() *delay_counter.DelayOutput {
+	if rec.stats == nil {
+		return nil
+	}
+	delay := rec.stats.delay.Get()
+	return &delay
+}
+
+// BackendDelayGet returns delay of calls to given backend address,
+// nil if stats not enabled or no call to address
+func (rec *Client) BackendDelayGet(address string) *delay_counter.DelayOutput {
+	if rec.stats == nil {
+		return nil
+	}
+	delayRecent := rec.stats.backendDelayGet(address, false)
+	if delayRecent == nil {
+		return nil
+	}
+	delay := delayRecent.Get()
+	return &delay
+}
+
+// BackendDelaysGet returns delays of calls to all backends, nil if stats not enabled
+func (rec *Client) BackendDelaysGet() map[string]*delay_counter.DelayOutput {
+	if rec.stats == nil {
+		return nil
+	}
+
+	delays := make(map[string]*delay_counter.DelayOutput)
+	for _, address := range rec.stats.backendAddresses() {
+		if delay := rec.BackendDelayGet(address); delay != nil {
+			delays[address] = delay
+		}
+	}
+	return delays
+}
+
+/*
+backendDelayHandler - monitor handler for delays of backends
+
+Params:
+    - params: "format" for json or noah; "address" for a backend, all
+              backends if not set
+
+Returns:
+    (data, error)
+*/
+func (rec *Client) backendDelayHandler(params map[string][]string) ([]byte, error) {
+	if rec.stats == nil {
+		return nil, ErrStatsDisabled
+	}
+
+	var delays map[string]*delay_counter.DelayOutput
+	address, err := web_monitor.ParamsValueGet(params, "address")
+	if err == nil {
+		delay := rec.BackendDelayGet(address)
+		if delay == nil {
+			return nil, fmt.Errorf("no delay for address:%s", address)
+		}
+		delays = map[string]*delay_counter.DelayOutput{address: delay}
+	} else {
+		delays = rec.BackendDelaysGet()
+	}
+
+	format := web_monitor.GetFormatParam(params)
+	switch format {
+	case "json":
+		if address != "" {
+			return delays[address].GetJson()
+		}
+		return json.Marshal(delays)
+	case "noah", "noah_with_program_name":
+		addresses := make([]string, 0, len(delays))
+		for address := range delays {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+
+		var buf bytes.Buffer
+		for _, address := range addresses {
+			delay := delays[address]
+			if format == "noah" {
+				buf.Write(delay.GetNoah())
+			} else {
+				buf.Write(delay.GetNoahWithProgramName())
+			}
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("invalid format:%s", format)
+	}
+}
+
+/*
+MonitorHandlersRegister - register monitor handlers for stats of Client
+
+Params:
+    - srv: monitor server
+    - prefix: prefix of command; handlers are <prefix>_state, <prefix>_state_diff,
+              <prefix>_delay and <prefix>_backend_delay
+
+Returns:
+    error, ErrStatsDisabled if stats not enabled
+*/
+func (rec *Client) MonitorHandlersRegister(srv *web_monitor.MonitorServer, prefix string) error {
+	if rec.stats == nil {
+		return ErrStatsDisabled
+	}
+
+	handlers := map[string]interface{}{
+		prefix + "_state":         web_monitor.CreateStateDataHandler(rec.StatsGet),
+		prefix + "_state_diff":    web_monitor.CreateCounterDiffHandler(rec.StatsDiffGet),
+		prefix + "_delay":         web_monitor.CreateDelayOutputHandler(rec.DelayGet),
+		prefix + "_backend_delay": rec.backendDelayHandler,
+	}
+	return srv.RegisterHandlers(web_monitor.WEB_HANDLE_MONITOR, handlers)
+}
@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+import (
+	"www.baidu.com/golang-lib/delay_counter"
+	"www.baidu.com/golang-lib/remote/test_pb"
+	"www.baidu.com/golang-lib/web_monitor"
+)
+
+// test of stats of calls, per backend and aggregate
+func TestClientStats(t *testing.T) {
+	drop := &delayHandler{drop: true}
+	good := &delayHandler{}
+	conf := RetryConf{MaxAttempts: 2, PerTryTimeout: 30 * time.Millisecond}
+	client, paths, cleanup := prepareRetryClient(t, []Handler{drop, good}, WithRetry(conf),
+		WithStats(StatsConf{NoahKeyPrefix: "waf_client"}))
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		if err := client.Call(wafRequestNew("test"), new(test_pb.WafResponse), time.Second); err != nil {
+			t.Fatalf("Call(): %s", err.Error())
+		}
+	}
+
+	counters := client.StatsGet().SCounters
+	if counters[CALL_SUCC] != 4 || counters[CALL_ERR] != 0 {
+		t.Errorf("unexpected aggregate counters: %v", counters)
+	}
+	if counters[CALL_SUCC+"_"+paths[1]] != 4 {
+		t.Errorf("unexpected counters of good backend: %v", counters)
+	}
+	if counters[CALL_TIMEOUT+"_"+paths[0]] == 0 {
+		t.Errorf("unexpected counters of drop backend: %v", counters)
+	}
+
+	if delay := client.DelayGet(); delay.Current.Count != 4 {
+		t.Errorf("aggregate delay count should be 4, got %d", delay.Current.Count)
+	}
+	if delay := client.BackendDelayGet(paths[1]); delay == nil || delay.Current.Count != 4 {
+		t.Errorf("delay of good backend should be recorded: %v", delay)
+	}
+	if delay := client.BackendDelayGet("notexist"); delay != nil {
+		t.Errorf("delay of unknown backend should be nil")
+	}
+
+	// backend removed
+	client.Update(map[string]int32{paths[1]: 1})
+	if delay := client.BackendDelayGet(paths[0]); delay != nil {
+		t.Errorf("delay of removed backend should be deleted")
+	}
+	counters = client.StatsGet().SCounters
+	for _, key := range callCounterKeys {
+		if _, ok := counters[key+"_"+paths[0]]; ok {
+			t.Errorf("counters of removed backend should be deleted: %v", counters)
+		}
+	}
+	if counters[CALL_SUCC+"_"+paths[1]] != 4 {
+		t.Errorf("counters of remaining backend should be kept: %v", counters)
+	}
+}
+
+// test of stats of cancelled attempts of hedged requests
+func TestClientStatsHedge(t *testing.T) {
+	slow := &delayHandler{delay: 500 * time.Millisecond}
+	fast := &delayHandler{}
+	conf := RetryConf{MaxAttempts: 2, HedgeDelay: 10 * time.Millisecond}
+	client, paths, cleanup := prepareRetryClient(t, []Handler{slow, fast}, WithRetry(conf),
+		WithStats(DefaultStatsConf()))
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		if err := client.Call(wafRequestNew("test"), new(test_pb.WafResponse), time.Second); err != nil {
+			t.Fatalf("Call(): %s", err.Error())
+		}
+	}
+
+	// cancelled attempts are recorded after call returns
+	var counters map[string]int64
+	for i := 0; i < 100; i++ {
+		counters = client.StatsGet().SCounters
+		if counters[CALL_CANCEL+"_"+paths[0]] > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if counters[CALL_CANCEL+"_"+paths[0]] == 0 {
+		t.Errorf("cancelled attempts of slow backend should be counted: %v", counters)
+	}
+	if counters[CALL_ERR+"_"+paths[0]] != 0 || counters[CALL_ERR] != 0 || counters[CALL_SUCC] != 4 {
+		t.Errorf("cancelled attempts should not be counted as errors: %v", counters)
+	}
+	if delay := client.BackendDelayGet(paths[0]); delay == nil || delay.Current.Count != 0 {
+		t.Errorf("delay of cancelled attempts should not be recorded: %v", delay)
+	}
+}
+
+// test of counter key for result of call
+func TestCallCounterKey(t *testing.T) {
+	cases := map[error]string{
+		nil:              CALL_SUCC,
+		ErrTimeout:       CALL_TIMEOUT,
+		context.Canceled: CALL_CANCEL,
+		ErrShutdown:      CALL_ERR,
+	}
+	for err, key := range cases {
+		if callCounterKey(err) != key {
+			t.Errorf("counter key of %v should be %s, got %s", err, key, callCounterKey(err))
+		}
+	}
+}
+
+// test of stats not enabled
+func TestClientStatsDisabled(t *testing.T) {
+	client := NewClientByAddr("unix", map[string]int32{}, time.Second, 1, nil, 100)
+
+	if client.StatsGet() != nil || client.StatsDiffGet() != nil || client.DelayGet() != nil ||
+		client.BackendDelaysGet() != nil {
+		t.Errorf("stats should be nil if not enabled")
+	}
+
+	srv := web_monitor.NewMonitorServer("test", "1.0", 0)
+	if err := client.MonitorHandlersRegister(srv, "remote"); err != ErrStatsDisabled {
+		t.Errorf("err should be ErrStatsDisabled, got %v", err)
+	}
+}
+
+// test of MonitorHandlersRegister
+func TestMonitorHandlersRegister(t *testing.T) {
+	client, paths, cleanup := prepareRetryClient(t, []Handler{&delayHandler{}},
+		WithStats(DefaultStatsConf()))
+	defer cleanup()
+
+	if err := client.Call(wafRequestNew("test"), new(test_pb.WafResponse), time.Second); err != nil {
+		t.Fatalf("Call(): %s", err.Error())
+	}
+
+	srv := web_monitor.NewMonitorServer("test", "1.0", 0)
+	if err := client.MonitorHandlersRegister(srv, "remote"); err != nil {
+		t.Fatalf("MonitorHandlersRegister(): %s", err.Error())
+	}
+	// register twice
+	if err := client.MonitorHandlersRegister(srv, "remote"); err == nil {
+		t.Errorf("handlers should not be registered twice")
+	}
+
+	// json of backend delays
+	data, err := client.backendDelayHandler(map[string][]string{})
+	if err != nil {
+		t.Fatalf("backendDelayHandler(): %s", err.Error())
+	}
+	var delays map[string]delay_counter.DelayOutput
+	if err := json.Unmarshal(data, &delays); err != nil {
+		t.Fatalf("json.Unmarshal(): %s", err.Error())
+	}
+	if delays[paths[0]].Current.Count != 1 {
+		t.Errorf("unexpected backend delays: %s", data)
+	}
+
+	// noah of a backend
+	params := map[string][]string{"format": {"noah"}, "address": {paths[0]}}
+	data, err = client.backendDelayHandler(params)
+	if err != nil {
+		t.Fatalf("backendDelayHandler(): %s", err.Error())
+	}
+	if !bytes.Contains(data, []byte("delay_")) || bytes.Contains(data, []byte("/")) {
+		t.Errorf("unexpected noah output: %s", data)
+	}
+
+	params = map[string][]string{"address": {"notexist"}}
+	if _, err := client.backendDelayHandler(params); err == nil {
+		t.Errorf("err should not be nil for unknown address")
+	}
+	params = map[string][]string{"format": {"xml"}}
+	if _, err := client.backendDelayHandler(params); err == nil {
+		t.Errorf("err should not be nil for invalid format")
+	}
+}
@@ -3,6 +3,8 @@
 modification history
 --------------------
 2014/12/16, by Sijie Yang, create
+2026/10/18, by agent, modify
+    - add format prometheus for StateData, DelayOutput and CounterDiff
 */
 /*
 DESCRIPTION
@@ -56,6 +58,8 @@ func CreateStateDataHandler(getter GetStateDataFunc) interface{} {
                 buff = state.NoahString()
             case "noah_with_program_name":
                 buff = state.NoahStringWithProgramName()
+            case "prometheus":
+                buff = state.PrometheusString()
 			default:
                 err = fmt.Errorf("invalid format:%s", format)
         }
@@ -91,6 +95,8 @@ func CreateDelayOutputHandler(getter GetDelayOutputFunc) interface{} {
                 buff = delay.GetNoah()
             case "noah_with_program_name":
                 buff = delay.GetNoahWithProgramName()
+            case "prometheus":
+                buff = delay.GetPrometheus()
             default:
                 err = fmt.Errorf("invalid format:%s", format)
         }
@@ -126,6 +132,8 @@ func CreateCounterDiffHandler(getter GetCounterDiffFunc) interface{}  {
                 buff = diff.NoahString()
 			case "noah_with_program_name":
 				buff = diff.NoahStringWithProgramName()
+            case "prometheus":
+                buff = diff.PrometheusString()
             default:
                 err = fmt.Errorf("invalid format:%s", format)
         }